@@ -0,0 +1,283 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import "math"
+
+// extent is implemented by the bounding volumes of the trees built on
+// basicTree: *BBox3 for Rtree3 and Interval for IntervalTree.
+type extent[B any] interface {
+	// union returns the smallest extent containing both the receiver and
+	// other.
+	union(other B) B
+	// size returns the volume of the extent, or the length of an interval.
+	size() float64
+	// enlargement returns how much the size of the receiver grows when it
+	// is enlarged to include add.
+	enlargement(add B) float64
+	// containsExtent reports whether other lies entirely within the
+	// receiver.
+	containsExtent(other B) bool
+	// touchesExtent reports whether the receiver and other share at least
+	// one point, including points on their boundaries.
+	touchesExtent(other B) bool
+}
+
+// basicTree holds the nodes of an R-tree over extents of type B storing
+// objects of type T, and implements the insertion and deletion shared by
+// Rtree3 and IntervalTree using Guttman's quadratic split.  Those trees
+// guard it with their locks and pass in their branching factors.
+type basicTree[B extent[B], T any] struct {
+	root *basicNode[B, T]
+	size int
+}
+
+// basicNode represents a tree node of a basicTree.
+type basicNode[B extent[B], T any] struct {
+	parent  *basicNode[B, T]
+	leaf    bool
+	entries []basicEntry[B, T]
+}
+
+// basicEntry represents an index record stored in a basicNode.
+type basicEntry[B extent[B], T any] struct {
+	bb    B
+	child *basicNode[B, T]
+	obj   T
+}
+
+// clear resets tree to a single empty leaf.
+func (tree *basicTree[B, T]) clear() {
+	tree.root = &basicNode[B, T]{leaf: true}
+	tree.size = 0
+}
+
+// computeBoundingBox returns the smallest extent containing the entries of
+// n, which must not be empty.
+func (n *basicNode[B, T]) computeBoundingBox() B {
+	bb := n.entries[0].bb
+	for _, e := range n.entries[1:] {
+		bb = bb.union(e.bb)
+	}
+	return bb
+}
+
+// insert adds the entry e, rebalancing the tree as needed.
+func (tree *basicTree[B, T]) insert(e basicEntry[B, T], minChildren, maxChildren int) {
+	leaf := tree.chooseLeaf(tree.root, e)
+	leaf.entries = append(leaf.entries, e)
+
+	var split *basicNode[B, T]
+	if len(leaf.entries) > maxChildren {
+		leaf, split = leaf.split(minChildren)
+	}
+	if split = tree.adjustTree(leaf, split, minChildren, maxChildren); split != nil {
+		oldRoot := tree.root
+		tree.root = &basicNode[B, T]{entries: []basicEntry[B, T]{
+			{bb: oldRoot.computeBoundingBox(), child: oldRoot},
+			{bb: split.computeBoundingBox(), child: split},
+		}}
+		oldRoot.parent, split.parent = tree.root, tree.root
+	}
+}
+
+// chooseLeaf finds the leaf whose extent needs least enlargement to include
+// e, breaking ties by smallest size.
+func (tree *basicTree[B, T]) chooseLeaf(n *basicNode[B, T], e basicEntry[B, T]) *basicNode[B, T] {
+	for !n.leaf {
+		chosen := n.entries[0]
+		diff := math.MaxFloat64
+		for _, en := range n.entries {
+			d := en.bb.enlargement(e.bb)
+			if d < diff || (d == diff && en.bb.size() < chosen.bb.size()) {
+				diff = d
+				chosen = en
+			}
+		}
+		n = chosen.child
+	}
+	return n
+}
+
+// adjustTree propagates extent changes and splits from n up to the root.  If
+// the root was split, it returns the new sibling of the root.
+func (tree *basicTree[B, T]) adjustTree(n, nn *basicNode[B, T], minChildren, maxChildren int) *basicNode[B, T] {
+	for n != tree.root {
+		parent := n.parent
+		for i := range parent.entries {
+			if parent.entries[i].child == n {
+				parent.entries[i].bb = n.computeBoundingBox()
+				break
+			}
+		}
+		if nn == nil {
+			n = parent
+			continue
+		}
+
+		nn.parent = parent
+		parent.entries = append(parent.entries, basicEntry[B, T]{bb: nn.computeBoundingBox(), child: nn})
+		n, nn = parent, nil
+		if len(parent.entries) > maxChildren {
+			n, nn = parent.split(minChildren)
+		}
+	}
+	return nn
+}
+
+// split divides the entries of n between n and a new sibling, seeding the
+// groups with the pair of entries that waste the most size together and then
+// assigning each remaining entry to the group it enlarges least.
+func (n *basicNode[B, T]) split(minGroupSize int) (left, right *basicNode[B, T]) {
+	entries := n.entries
+	s1, s2 := 0, 1
+	maxWaste := math.Inf(-1)
+	for i := range entries {
+		for j := i + 1; j < len(entries); j++ {
+			d := entries[i].bb.union(entries[j].bb).size() - entries[i].bb.size() - entries[j].bb.size()
+			if d > maxWaste {
+				maxWaste = d
+				s1, s2 = i, j
+			}
+		}
+	}
+
+	left, right = n, &basicNode[B, T]{parent: n.parent, leaf: n.leaf}
+	left.entries = nil
+	left.assign(entries[s1])
+	right.assign(entries[s2])
+	leftBB, rightBB := entries[s1].bb, entries[s2].bb
+
+	remaining := len(entries) - 2
+	for i, e := range entries {
+		if i == s1 || i == s2 {
+			continue
+		}
+		dl, dr := leftBB.enlargement(e.bb), rightBB.enlargement(e.bb)
+		toLeft := dl < dr || (dl == dr && len(left.entries) <= len(right.entries))
+		if remaining+len(left.entries) <= minGroupSize {
+			toLeft = true
+		} else if remaining+len(right.entries) <= minGroupSize {
+			toLeft = false
+		}
+
+		if toLeft {
+			left.assign(e)
+			leftBB = leftBB.union(e.bb)
+		} else {
+			right.assign(e)
+			rightBB = rightBB.union(e.bb)
+		}
+		remaining--
+	}
+	return
+}
+
+func (n *basicNode[B, T]) assign(e basicEntry[B, T]) {
+	if e.child != nil {
+		e.child.parent = n
+	}
+	n.entries = append(n.entries, e)
+}
+
+// delete removes obj, which is stored with extent bb, and reports whether it
+// was found.  Objects are compared as by sameObject.
+func (tree *basicTree[B, T]) delete(obj T, bb B, minChildren, maxChildren int) bool {
+	leaf := tree.findLeaf(tree.root, bb, obj)
+	if leaf == nil {
+		return false
+	}
+	for i, e := range leaf.entries {
+		if sameObject(e.obj, obj) {
+			leaf.entries = append(leaf.entries[:i], leaf.entries[i+1:]...)
+			break
+		}
+	}
+	tree.condenseTree(leaf, minChildren, maxChildren)
+	tree.size--
+	return true
+}
+
+// findLeaf finds the leaf below n storing obj, searching only subtrees whose
+// extents contain bb.
+func (tree *basicTree[B, T]) findLeaf(n *basicNode[B, T], bb B, obj T) *basicNode[B, T] {
+	if n.leaf {
+		for _, e := range n.entries {
+			if sameObject(e.obj, obj) {
+				return n
+			}
+		}
+		return nil
+	}
+	for _, e := range n.entries {
+		if e.bb.containsExtent(bb) {
+			if leaf := tree.findLeaf(e.child, bb, obj); leaf != nil {
+				return leaf
+			}
+		}
+	}
+	return nil
+}
+
+// condenseTree removes underfull nodes on the path from n to the root,
+// reinserting the objects stored below them, and shrinks the extents along
+// the way.
+func (tree *basicTree[B, T]) condenseTree(n *basicNode[B, T], minChildren, maxChildren int) {
+	var orphans []basicEntry[B, T]
+	for n != tree.root {
+		parent := n.parent
+		for i := range parent.entries {
+			if parent.entries[i].child != n {
+				continue
+			}
+			if len(n.entries) < minChildren || len(n.entries) == 0 {
+				parent.entries = append(parent.entries[:i], parent.entries[i+1:]...)
+				orphans = n.objects(orphans)
+			} else {
+				parent.entries[i].bb = n.computeBoundingBox()
+			}
+			break
+		}
+		n = parent
+	}
+
+	for !tree.root.leaf && len(tree.root.entries) == 1 {
+		tree.root = tree.root.entries[0].child
+		tree.root.parent = nil
+	}
+	if !tree.root.leaf && len(tree.root.entries) == 0 {
+		tree.root = &basicNode[B, T]{leaf: true}
+	}
+
+	for _, e := range orphans {
+		tree.insert(e, minChildren, maxChildren)
+	}
+}
+
+// objects appends the object entries stored below n to entries.
+func (n *basicNode[B, T]) objects(entries []basicEntry[B, T]) []basicEntry[B, T] {
+	if n.leaf {
+		return append(entries, n.entries...)
+	}
+	for _, e := range n.entries {
+		entries = e.child.objects(entries)
+	}
+	return entries
+}
+
+// search appends to results the objects below n whose extents touch bb.
+func (tree *basicTree[B, T]) search(results []T, n *basicNode[B, T], bb B) []T {
+	for _, e := range n.entries {
+		if !e.bb.touchesExtent(bb) {
+			continue
+		}
+		if n.leaf {
+			results = append(results, e.obj)
+		} else {
+			results = tree.search(results, e.child, bb)
+		}
+	}
+	return results
+}
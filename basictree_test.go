@@ -0,0 +1,82 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"reflect"
+	"testing"
+)
+
+// verifyBasic checks that all leaves are at the same depth, that every node
+// except the root respects the branching factors and that every entry's
+// extent is exactly that of its child.  It returns the depth of n.
+func verifyBasic[B extent[B], T any](t *testing.T, tree *basicTree[B, T], n *basicNode[B, T], minChildren, maxChildren int) int {
+	if n != tree.root && (len(n.entries) < minChildren || len(n.entries) > maxChildren) {
+		t.Errorf("node has %d entries", len(n.entries))
+	}
+	if n.leaf {
+		return 1
+	}
+	depth := -1
+	for _, e := range n.entries {
+		if e.child.parent != n {
+			t.Errorf("child of %v has the wrong parent", e.bb)
+		}
+		if bb := e.child.computeBoundingBox(); !reflect.DeepEqual(e.bb, bb) {
+			t.Errorf("entry extent %v does not fit child extent %v", e.bb, bb)
+		}
+		d := verifyBasic(t, tree, e.child, minChildren, maxChildren)
+		if depth >= 0 && d != depth {
+			t.Errorf("leaves at depths %d and %d", depth, d)
+		}
+		depth = d
+	}
+	return depth + 1
+}
+
+// taggedSpan and taggedBox are values of types that == cannot compare.
+type taggedSpan struct {
+	iv   Interval
+	tags []string
+}
+
+func (s taggedSpan) Bounds() Interval {
+	return s.iv
+}
+
+type taggedBox struct {
+	bb   *BBox3
+	tags []string
+}
+
+func (b taggedBox) Bounds() *BBox3 {
+	return b.bb
+}
+
+func TestBasicTreeUncomparable(t *testing.T) {
+	it := NewIntervalTree(2, 3)
+	rt := NewTree3(2, 3)
+	for i := 0; i < 10; i++ {
+		x := float64(i)
+		it.Insert(taggedSpan{Interval{x, x + 1}, []string{"a"}})
+		rt.Insert(taggedBox{mustBBox3(PointZ{x, x, x}, 1, 1, 1), []string{"a"}})
+	}
+
+	// such values are never found, rather than causing a panic
+	if it.Delete(taggedSpan{Interval{3, 4}, []string{"a"}}) {
+		t.Errorf("expected an uncomparable span not to be deleted")
+	}
+	if rt.Delete(taggedBox{mustBBox3(PointZ{3, 3, 3}, 1, 1, 1), []string{"a"}}) {
+		t.Errorf("expected an uncomparable box not to be deleted")
+	}
+	if it.Size() != 10 || rt.Size() != 10 {
+		t.Errorf("expected sizes 10 and 10, got %d and %d", it.Size(), rt.Size())
+	}
+	if found := it.SearchPoint(3.5); len(found) != 1 {
+		t.Errorf("expected one span to contain 3.5, got %v", found)
+	}
+	verifyBasic(t, &it.basicTree, it.root, it.MinChildren, it.MaxChildren)
+	verifyBasic(t, &rt.basicTree, rt.root, rt.MinChildren, rt.MaxChildren)
+}
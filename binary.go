@@ -0,0 +1,304 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SpatialCodec encodes and decodes the objects stored in a tree for
+// WriteTo and ReadFrom.
+type SpatialCodec interface {
+	// Marshal encodes obj.
+	Marshal(obj Spatial) ([]byte, error)
+	// Unmarshal decodes an object encoded by Marshal.
+	Unmarshal(data []byte) (Spatial, error)
+}
+
+// Codec sets the codec WriteTo and ReadFrom use for the stored objects.
+func Codec(c SpatialCodec) Option {
+	return func(tree *Rtree) {
+		tree.codec = c
+	}
+}
+
+// binaryMagic identifies the binary tree format, and binaryVersion its
+// revision.
+const (
+	binaryMagic   = "RTRB"
+	binaryVersion = 1
+)
+
+// binaryHeader is the fixed-size header of the binary tree format.
+type binaryHeader struct {
+	Magic       [4]byte
+	Version     uint32
+	Dims        uint32
+	MinChildren uint32
+	MaxChildren uint32
+	Height      uint32
+	Count       uint64
+}
+
+// WriteTo writes tree to w in a compact binary format, encoding the stored
+// objects with the tree's codec, and returns the number of bytes written.
+//
+// All values are little-endian.  The format is a header of
+//
+//	magic "RTRB", uint32 version (1), uint32 dimensions (2),
+//	uint32 MinChildren, uint32 MaxChildren, uint32 height, uint64 count
+//
+// followed by the nodes in depth-first order.  Each node is a uint32 level
+// (1 for leaves) and a uint32 number of entries, then for each entry its
+// bounding box as four float64s, min X, min Y, max X, max Y.  Leaf entries
+// are followed by a uint64 offset of the object's payload in the payload
+// section; the children of a branch node follow the node itself, in order.
+// The payload section is a uint64 length and then, for each object, a uint32
+// length and the bytes returned by the codec.
+func (tree *Rtree) WriteTo(w io.Writer) (int64, error) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	if tree.codec == nil {
+		return 0, errors.New("rtree: no codec to encode objects")
+	}
+
+	var nodes, payloads bytes.Buffer
+	if err := tree.encodeNode(&nodes, &payloads, tree.root); err != nil {
+		return 0, err
+	}
+
+	hdr := binaryHeader{
+		Version:     binaryVersion,
+		Dims:        2,
+		MinChildren: uint32(tree.MinChildren),
+		MaxChildren: uint32(tree.MaxChildren),
+		Height:      uint32(tree.height),
+		Count:       uint64(tree.size),
+	}
+	copy(hdr.Magic[:], binaryMagic)
+
+	cw := &countingWriter{w: w}
+	binary.Write(cw, binary.LittleEndian, &hdr)
+	cw.Write(nodes.Bytes())
+	binary.Write(cw, binary.LittleEndian, uint64(payloads.Len()))
+	cw.Write(payloads.Bytes())
+	return cw.n, cw.err
+}
+
+// encodeNode appends n and its subtree to nodes, and the payloads of its
+// objects to payloads.
+func (tree *Rtree) encodeNode(nodes, payloads *bytes.Buffer, n *node) error {
+	binary.Write(nodes, binary.LittleEndian, [2]uint32{uint32(n.level), uint32(len(n.entries))})
+	for _, e := range n.entries {
+		binary.Write(nodes, binary.LittleEndian, [4]float64{e.bb.min.X, e.bb.min.Y, e.bb.max.X, e.bb.max.Y})
+		if !n.leaf {
+			continue
+		}
+		data, err := tree.codec.Marshal(e.obj)
+		if err != nil {
+			return err
+		}
+		binary.Write(nodes, binary.LittleEndian, uint64(payloads.Len()))
+		binary.Write(payloads, binary.LittleEndian, uint32(len(data)))
+		payloads.Write(data)
+	}
+	if n.leaf {
+		return nil
+	}
+	for _, e := range n.entries {
+		if err := tree.encodeNode(nodes, payloads, e.child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadFrom replaces the contents of tree with a tree read from r in the
+// format written by WriteTo, decoding the stored objects with the tree's
+// codec, and returns the number of bytes read.  MinChildren and MaxChildren
+// are set from the stream.  The stream does not record the capacity set by
+// LeafCapacity, so a tree written with one must be read into a tree with the
+// same LeafCapacity.  If the stream is malformed or truncated, an error
+// is returned and tree is left unchanged.
+func (tree *Rtree) ReadFrom(r io.Reader) (int64, error) {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if tree.codec == nil {
+		return 0, errors.New("rtree: no codec to decode objects")
+	}
+
+	cr := &countingReader{r: r}
+	var hdr binaryHeader
+	if err := readBinary(cr, &hdr); err != nil {
+		return cr.n, err
+	}
+	switch {
+	case string(hdr.Magic[:]) != binaryMagic:
+		return cr.n, errors.New("rtree: not a binary tree stream")
+	case hdr.Version != binaryVersion:
+		return cr.n, fmt.Errorf("rtree: unsupported binary tree version %d", hdr.Version)
+	case hdr.Dims != 2:
+		return cr.n, fmt.Errorf("rtree: unsupported number of dimensions %d", hdr.Dims)
+	case hdr.MaxChildren < 2 || hdr.MinChildren > hdr.MaxChildren || hdr.Height < 1:
+		return cr.n, fmt.Errorf("rtree: invalid tree parameters min %d, max %d, height %d",
+			hdr.MinChildren, hdr.MaxChildren, hdr.Height)
+	}
+
+	d := decoder{r: cr, max: int(hdr.MaxChildren), leafMax: int(hdr.MaxChildren)}
+	if tree.leafMax > 0 {
+		d.leafMax = tree.leafMax
+	}
+	root, err := d.node(int(hdr.Height))
+	if err != nil {
+		return cr.n, err
+	}
+	if uint64(len(d.leaves)) != hdr.Count {
+		return cr.n, fmt.Errorf("rtree: stream has %d objects, header says %d", len(d.leaves), hdr.Count)
+	}
+
+	var length uint64
+	if err := readBinary(cr, &length); err != nil {
+		return cr.n, err
+	}
+	var payloads bytes.Buffer
+	if m, err := payloads.ReadFrom(io.LimitReader(cr, int64(length))); err != nil {
+		return cr.n, err
+	} else if uint64(m) != length {
+		return cr.n, io.ErrUnexpectedEOF
+	}
+	data := payloads.Bytes()
+	for _, leaf := range d.leaves {
+		off := leaf.offset
+		if off > uint64(len(data)) || uint64(len(data))-off < 4 {
+			return cr.n, fmt.Errorf("rtree: payload offset %d out of range", off)
+		}
+		size := uint64(binary.LittleEndian.Uint32(data[off:]))
+		if uint64(len(data))-off-4 < size {
+			return cr.n, fmt.Errorf("rtree: payload at offset %d out of range", off)
+		}
+		obj, err := tree.codec.Unmarshal(data[off+4 : off+4+size])
+		if err != nil {
+			return cr.n, err
+		}
+		leaf.n.entries[leaf.i].obj = obj
+	}
+
+	tree.MinChildren = int(hdr.MinChildren)
+	tree.MaxChildren = int(hdr.MaxChildren)
+	tree.root = root
+	tree.height = int(hdr.Height)
+	tree.size = int(hdr.Count)
+	tree.reinserted = nil
+	tree.extentValid = false
+	return cr.n, nil
+}
+
+// decoder reads the nodes of a binary tree stream, remembering the leaf
+// entries whose objects are still to be decoded.
+type decoder struct {
+	r       io.Reader
+	max     int
+	leafMax int
+	leaves  []leafPayload
+}
+
+// leafPayload locates the object of entry i of leaf n in the payload section.
+type leafPayload struct {
+	n      *node
+	i      int
+	offset uint64
+}
+
+// node reads a node and its subtree, which must be at the given level.
+func (d *decoder) node(level int) (*node, error) {
+	var head [2]uint32
+	if err := readBinary(d.r, &head); err != nil {
+		return nil, err
+	}
+	if int(head[0]) != level {
+		return nil, fmt.Errorf("rtree: node at level %d, expected %d", head[0], level)
+	}
+	max := d.max
+	if level == 1 {
+		max = d.leafMax
+	}
+	if int(head[1]) > max || head[1] == 0 && level > 1 {
+		return nil, fmt.Errorf("rtree: node with %d entries", head[1])
+	}
+
+	n := &node{leaf: level == 1, level: level, entries: make([]entry, head[1])}
+	for i := range n.entries {
+		var c [4]float64
+		if err := readBinary(d.r, &c); err != nil {
+			return nil, err
+		}
+		if !(c[0] <= c[2] && c[1] <= c[3]) {
+			return nil, fmt.Errorf("rtree: invalid bounding box %v", c)
+		}
+		n.entries[i].bb = &BBox{Point{c[0], c[1]}, Point{c[2], c[3]}}
+		if n.leaf {
+			var off uint64
+			if err := readBinary(d.r, &off); err != nil {
+				return nil, err
+			}
+			d.leaves = append(d.leaves, leafPayload{n, i, off})
+		}
+	}
+	if n.leaf {
+		return n, nil
+	}
+	for i := range n.entries {
+		child, err := d.node(level - 1)
+		if err != nil {
+			return nil, err
+		}
+		child.parent = n
+		n.entries[i].child = child
+	}
+	return n, nil
+}
+
+// readBinary reads a little-endian value from r, reporting a stream that ends
+// early as io.ErrUnexpectedEOF.
+func readBinary(r io.Reader, v interface{}) error {
+	err := binary.Read(r, binary.LittleEndian, v)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// countingWriter counts the bytes written to w and keeps the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,159 @@
+package rtree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// placeCodec encodes places as their coordinates followed by their name.
+type placeCodec struct{}
+
+func (placeCodec) Marshal(obj Spatial) ([]byte, error) {
+	p, ok := obj.(place)
+	if !ok {
+		return nil, errors.New("not a place")
+	}
+	data := make([]byte, 16, 16+len(p.name))
+	binary.LittleEndian.PutUint64(data, math.Float64bits(p.x))
+	binary.LittleEndian.PutUint64(data[8:], math.Float64bits(p.y))
+	return append(data, p.name...), nil
+}
+
+func (placeCodec) Unmarshal(data []byte) (Spatial, error) {
+	if len(data) < 16 {
+		return nil, errors.New("short place")
+	}
+	return place{
+		name: string(data[16:]),
+		x:    math.Float64frombits(binary.LittleEndian.Uint64(data)),
+		y:    math.Float64frombits(binary.LittleEndian.Uint64(data[8:])),
+	}, nil
+}
+
+func binaryTestTree() *Rtree {
+	rt := NewTree(3, 6, Codec(placeCodec{}))
+	r := rand.New(rand.NewSource(17))
+	names := []string{"", "a", "bc", "def"}
+	for i := 0; i < 200; i++ {
+		rt.Insert(place{names[i%len(names)], r.Float64()*100 - 50, r.Float64()*100 - 50})
+	}
+	return rt
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	for _, rt := range []*Rtree{binaryTestTree(), NewTree(2, 5, Codec(placeCodec{}))} {
+		var buf bytes.Buffer
+		n, err := rt.WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("WriteTo: %v", err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("WriteTo reported %d bytes, wrote %d", n, buf.Len())
+		}
+
+		read := NewTree(1, 2, Codec(placeCodec{}))
+		read.Insert(place{"stale", 0, 0})
+		if n, err = read.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatalf("ReadFrom: %v", err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("ReadFrom reported %d bytes, read %d", n, buf.Len())
+		}
+
+		if read.MinChildren != rt.MinChildren || read.MaxChildren != rt.MaxChildren {
+			t.Errorf("expected children %d-%d, got %d-%d", rt.MinChildren, rt.MaxChildren, read.MinChildren, read.MaxChildren)
+		}
+		if read.Size() != rt.Size() || read.Depth() != rt.Depth() {
+			t.Errorf("expected size %d and depth %d, got %d and %d", rt.Size(), rt.Depth(), read.Size(), read.Depth())
+		}
+		if read.String() != rt.String() {
+			t.Errorf("expected tree\n%v\ngot\n%v", rt, read)
+		}
+		verify(t, read.root)
+
+		want := map[Spatial]int{}
+		for _, obj := range rt.All() {
+			want[obj]++
+		}
+		for _, obj := range read.All() {
+			want[obj]--
+		}
+		for obj, n := range want {
+			if n != 0 {
+				t.Errorf("object %v count differs by %d", obj, n)
+			}
+		}
+
+		// the decoded tree is fully usable
+		read.Insert(place{"new", 60, 60})
+		if obj := read.NearestNeighbor(Point{61, 61}); obj != (place{"new", 60, 60}) {
+			t.Errorf("expected the new place to be nearest, got %v", obj)
+		}
+	}
+}
+
+func TestBinaryTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := binaryTestTree().WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	data := buf.Bytes()
+
+	for i := 0; i < len(data); i++ {
+		rt := NewTree(2, 5, Codec(placeCodec{}))
+		rt.Insert(place{"kept", 1, 1})
+		_, err := rt.ReadFrom(bytes.NewReader(data[:i]))
+		if err == nil {
+			t.Fatalf("expected error reading %d of %d bytes", i, len(data))
+		}
+		if rt.Size() != 1 || rt.MaxChildren != 5 {
+			t.Fatalf("tree changed by failed read of %d bytes", i)
+		}
+	}
+	if _, err := NewTree(2, 5, Codec(placeCodec{})).ReadFrom(bytes.NewReader(data[:20])); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestBinaryErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewTree(2, 5).WriteTo(&buf); err == nil {
+		t.Errorf("expected error writing without a codec")
+	}
+	if _, err := NewTree(2, 5).ReadFrom(&buf); err == nil {
+		t.Errorf("expected error reading without a codec")
+	}
+
+	rt := NewTree(2, 5, Codec(placeCodec{}))
+	rt.Insert(mustBBox(Point{0, 0}, []float64{1, 1}))
+	if _, err := rt.WriteTo(&buf); err == nil {
+		t.Errorf("expected codec error to be returned")
+	}
+
+	buf.Reset()
+	if _, err := binaryTestTree().WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	corrupt := append([]byte(nil), buf.Bytes()...)
+	corrupt[0] = 'X'
+	if _, err := NewTree(2, 5, Codec(placeCodec{})).ReadFrom(bytes.NewReader(corrupt)); err == nil {
+		t.Errorf("expected error for bad magic")
+	}
+
+	// point the first payload offset past the end of the payloads
+	corrupt = append([]byte(nil), buf.Bytes()...)
+	off := 32 + 8
+	for level := binary.LittleEndian.Uint32(corrupt[32:]); level > 1; level-- {
+		entries := int(binary.LittleEndian.Uint32(corrupt[off-4:]))
+		off += entries*32 + 8
+	}
+	binary.LittleEndian.PutUint64(corrupt[off+32:], 1<<40)
+	if _, err := NewTree(2, 5, Codec(placeCodec{})).ReadFrom(bytes.NewReader(corrupt)); err == nil {
+		t.Errorf("expected error for bad payload offset")
+	}
+}
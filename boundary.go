@@ -0,0 +1,122 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import "math"
+
+// BoundaryMode selects which parts of their boundaries bounding boxes
+// include, and so whether boxes that merely touch intersect and whether
+// points on a boundary are contained.  A box with zero length in some
+// dimension is taken to contain its boundary in that dimension in every mode,
+// so that points stored as degenerate boxes are never empty.
+//
+// The zero BoundaryMode is Closed, which is also the mode of a tree not
+// configured with Boundary.
+type BoundaryMode int
+
+const (
+	// Closed boxes include their whole boundary, [min, max] in each
+	// dimension, so boxes that touch intersect.
+	Closed BoundaryMode = iota
+	// HalfOpen boxes include their lower but not their upper boundary,
+	// [min, max) in each dimension, so boxes that touch do not intersect and
+	// each point of a grid of adjacent boxes lies in exactly one of them.
+	HalfOpen
+	// Open boxes exclude their boundary, (min, max) in each dimension.
+	Open
+)
+
+func (m BoundaryMode) String() string {
+	switch m {
+	case Closed:
+		return "Closed"
+	case HalfOpen:
+		return "HalfOpen"
+	case Open:
+		return "Open"
+	}
+	return "BoundaryMode(?)"
+}
+
+// Boundary sets the BoundaryMode that governs the queries, region deletions
+// and spatial joins of a tree, Closed by default.  Subtrees are always pruned
+// by their closed bounding boxes, which is correct for every mode.
+func Boundary(mode BoundaryMode) Option {
+	return func(tree *Rtree) {
+		tree.boundary = mode
+	}
+}
+
+// ContainsPoint reports whether bb contains p under m.
+func (m BoundaryMode) ContainsPoint(bb *BBox, p Point) bool {
+	return m.coordIn(p.X, bb.min.X, bb.max.X) && m.coordIn(p.Y, bb.min.Y, bb.max.Y)
+}
+
+// ContainsBBox reports whether bb contains all of other under m.
+func (m BoundaryMode) ContainsBBox(bb, other *BBox) bool {
+	return m.axisContains(bb.min.X, bb.max.X, other.min.X, other.max.X) &&
+		m.axisContains(bb.min.Y, bb.max.Y, other.min.Y, other.max.Y)
+}
+
+// Overlaps reports whether bb1 and bb2 share at least one point under m.  If
+// either box is nil, they do not.
+func (m BoundaryMode) Overlaps(bb1, bb2 *BBox) bool {
+	return bb1 != nil && bb2 != nil &&
+		m.axisOverlaps(bb1.min.X, bb1.max.X, bb2.min.X, bb2.max.X) &&
+		m.axisOverlaps(bb1.min.Y, bb1.max.Y, bb2.min.Y, bb2.max.Y)
+}
+
+// Intersect computes the closure of the intersection of bb1 and bb2 under m,
+// or nil if they do not overlap.
+func (m BoundaryMode) Intersect(bb1, bb2 *BBox) *BBox {
+	if !m.Overlaps(bb1, bb2) {
+		return nil
+	}
+	return &BBox{
+		min: Point{X: math.Max(bb1.min.X, bb2.min.X), Y: math.Max(bb1.min.Y, bb2.min.Y)},
+		max: Point{X: math.Min(bb1.max.X, bb2.max.X), Y: math.Min(bb1.max.Y, bb2.max.Y)},
+	}
+}
+
+// coordIn reports whether x lies in the interval from lo to hi under m.
+func (m BoundaryMode) coordIn(x, lo, hi float64) bool {
+	switch {
+	case lo == hi:
+		return x == lo
+	case m == HalfOpen:
+		return lo <= x && x < hi
+	case m == Open:
+		return lo < x && x < hi
+	}
+	return lo <= x && x <= hi
+}
+
+// axisOverlaps reports whether the intervals from lo1 to hi1 and from lo2 to
+// hi2 share a point under m.
+func (m BoundaryMode) axisOverlaps(lo1, hi1, lo2, hi2 float64) bool {
+	switch {
+	case m == Closed:
+		return lo1 <= hi2 && lo2 <= hi1
+	case lo1 == hi1:
+		return m.coordIn(lo1, lo2, hi2)
+	case lo2 == hi2:
+		return m.coordIn(lo2, lo1, hi1)
+	}
+	return lo1 < hi2 && lo2 < hi1
+}
+
+// axisContains reports whether the interval from lo1 to hi1 contains the
+// interval from lo2 to hi2 under m.
+func (m BoundaryMode) axisContains(lo1, hi1, lo2, hi2 float64) bool {
+	switch {
+	case m == Closed:
+		return lo1 <= lo2 && hi2 <= hi1
+	case lo2 == hi2:
+		return m.coordIn(lo2, lo1, hi1)
+	case lo1 == hi1:
+		return false
+	}
+	return lo1 <= lo2 && hi2 <= hi1
+}
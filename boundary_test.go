@@ -0,0 +1,151 @@
+package rtree
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBoundaryModeBoxes(t *testing.T) {
+	a := mustBBox(Point{0, 0}, []float64{2, 2})
+	tests := []struct {
+		name     string
+		b        *BBox
+		overlaps [3]bool // Closed, HalfOpen, Open
+		contains [3]bool
+	}{
+		{"overlapping", mustBBox(Point{1, 1}, []float64{2, 2}), [3]bool{true, true, true}, [3]bool{false, false, false}},
+		{"touching edge", mustBBox(Point{2, 0}, []float64{1, 2}), [3]bool{true, false, false}, [3]bool{false, false, false}},
+		{"touching corner", mustBBox(Point{-1, -1}, []float64{1, 1}), [3]bool{true, false, false}, [3]bool{false, false, false}},
+		{"inside touching edge", mustBBox(Point{0, 0.5}, []float64{1, 1}), [3]bool{true, true, true}, [3]bool{true, true, true}},
+		{"equal", mustBBox(Point{0, 0}, []float64{2, 2}), [3]bool{true, true, true}, [3]bool{true, true, true}},
+		{"point on lower edge", mustBBox(Point{0, 1}, []float64{0, 0}), [3]bool{true, true, false}, [3]bool{true, true, false}},
+		{"point on upper edge", mustBBox(Point{2, 1}, []float64{0, 0}), [3]bool{true, false, false}, [3]bool{true, false, false}},
+		{"line on upper edge", mustBBox(Point{0, 2}, []float64{2, 0}), [3]bool{true, false, false}, [3]bool{true, false, false}},
+		{"line across", mustBBox(Point{-1, 1}, []float64{4, 0}), [3]bool{true, true, true}, [3]bool{false, false, false}},
+		{"disjoint", mustBBox(Point{3, 3}, []float64{1, 1}), [3]bool{false, false, false}, [3]bool{false, false, false}},
+	}
+	for _, test := range tests {
+		for i, mode := range []BoundaryMode{Closed, HalfOpen, Open} {
+			if actual := mode.Overlaps(a, test.b); actual != test.overlaps[i] {
+				t.Errorf("%s: expected %v.Overlaps(%v, %v) == %v, got %v", test.name, mode, a, test.b, test.overlaps[i], actual)
+			}
+			if actual := mode.Overlaps(test.b, a); actual != test.overlaps[i] {
+				t.Errorf("%s: expected %v.Overlaps(%v, %v) == %v, got %v", test.name, mode, test.b, a, test.overlaps[i], actual)
+			}
+			if actual := mode.Intersect(a, test.b) != nil; actual != test.overlaps[i] {
+				t.Errorf("%s: expected %v.Intersect(%v, %v) != nil to be %v", test.name, mode, a, test.b, test.overlaps[i])
+			}
+			if actual := mode.ContainsBBox(a, test.b); actual != test.contains[i] {
+				t.Errorf("%s: expected %v.ContainsBBox(%v, %v) == %v, got %v", test.name, mode, a, test.b, test.contains[i], actual)
+			}
+		}
+	}
+
+	if Closed.Overlaps(a, nil) || Closed.Intersect(nil, a) != nil {
+		t.Errorf("expected nil boxes not to overlap")
+	}
+	if r := HalfOpen.Intersect(a, mustBBox(Point{1, -1}, []float64{3, 2})); !r.Equal(mustBBox(Point{1, 0}, []float64{1, 1}), EPS) {
+		t.Errorf("expected intersection [1, 0]x[2, 1], got %v", r)
+	}
+}
+
+func TestBoundaryModePoints(t *testing.T) {
+	bb := mustBBox(Point{0, 0}, []float64{2, 2})
+	tests := []struct {
+		p        Point
+		contains [3]bool // Closed, HalfOpen, Open
+	}{
+		{Point{1, 1}, [3]bool{true, true, true}},
+		{Point{0, 0}, [3]bool{true, true, false}},
+		{Point{0, 1}, [3]bool{true, true, false}},
+		{Point{2, 1}, [3]bool{true, false, false}},
+		{Point{1, 2}, [3]bool{true, false, false}},
+		{Point{2, 2}, [3]bool{true, false, false}},
+		{Point{2, 0}, [3]bool{true, false, false}},
+		{Point{3, 1}, [3]bool{false, false, false}},
+	}
+	for _, test := range tests {
+		for i, mode := range []BoundaryMode{Closed, HalfOpen, Open} {
+			if actual := mode.ContainsPoint(bb, test.p); actual != test.contains[i] {
+				t.Errorf("Expected %v.ContainsPoint(%v, %v) == %v, got %v", mode, bb, test.p, test.contains[i], actual)
+			}
+		}
+		if actual := bb.containsPoint(test.p); actual != test.contains[0] {
+			t.Errorf("Expected containsPoint to match Closed for %v", test.p)
+		}
+	}
+
+	// a degenerate box contains its own point in every mode
+	p := Point{1, 1}
+	for _, mode := range []BoundaryMode{Closed, HalfOpen, Open} {
+		if !mode.ContainsPoint(p.ToBBox(0), p) {
+			t.Errorf("Expected %v to contain a point in its degenerate box", mode)
+		}
+	}
+}
+
+// names returns the sorted names of objs.
+func names(objs []Spatial) []string {
+	var result []string
+	for _, obj := range objs {
+		result = append(result, obj.(*named).name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+type named struct {
+	name string
+	bb   *BBox
+}
+
+func (n *named) Bounds() *BBox {
+	return n.bb
+}
+
+func TestBoundaryModeTree(t *testing.T) {
+	// a 2x2 grid of unit cells, and a point on the edge between two cells
+	objs := []Spatial{
+		&named{"a", mustBBox(Point{0, 0}, []float64{1, 1})},
+		&named{"b", mustBBox(Point{1, 0}, []float64{1, 1})},
+		&named{"c", mustBBox(Point{0, 1}, []float64{1, 1})},
+		&named{"d", mustBBox(Point{1, 1}, []float64{1, 1})},
+		&named{"p", mustBBox(Point{1, 0.5}, []float64{0, 0})},
+	}
+	query := mustBBox(Point{0, 0}, []float64{1, 1})
+	tests := []struct {
+		opts      []Option
+		intersect string
+		contained string
+		point     string
+	}{
+		// the default mode is Closed
+		{nil, "a b c d p", "a p", "a b c d"},
+		{[]Option{Boundary(Closed)}, "a b c d p", "a p", "a b c d"},
+		{[]Option{Boundary(HalfOpen)}, "a", "a", "d"},
+		{[]Option{Boundary(Open)}, "a", "a", ""},
+	}
+	for _, test := range tests {
+		rt := NewTree(2, 3, test.opts...)
+		for _, obj := range objs {
+			rt.Insert(obj)
+		}
+		mode := rt.boundary
+		check := func(what string, actual []Spatial, expected string) {
+			if s := strings.Join(names(actual), " "); s != expected {
+				t.Errorf("%v: expected %s %q, got %q", mode, what, expected, s)
+			}
+		}
+		check("intersecting", rt.SearchIntersect(query), test.intersect)
+		if n := rt.CountIntersect(query); n != len(strings.Fields(test.intersect)) {
+			t.Errorf("%v: expected count %d, got %d", mode, len(strings.Fields(test.intersect)), n)
+		}
+		check("contained", rt.SearchContained(query), test.contained)
+		check("containing", rt.SearchContainingPoint(Point{1, 1}), test.point)
+
+		if n := rt.DeleteIntersecting(query); n != len(strings.Fields(test.intersect)) {
+			t.Errorf("%v: expected to delete %d, deleted %d", mode, len(strings.Fields(test.intersect)), n)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// DefaultFillFactor is a sensible fill factor for NewTreeBulk when the tree
+// will receive further insertions: it leaves nearly a third of each node free,
+// so that new objects rarely cause splits.
+const DefaultFillFactor = 0.7
+
+// BulkWorkers sets the number of goroutines that NewTreeBulk, InsertBatch and
+// Rebuild use to sort and pack the vertical slices of Sort-Tile-Recursive
+// packing, which dominates the time taken for large numbers of objects.  The
+// tree built is the same for any number of workers; with fewer than two, it
+// is built on the calling goroutine, as by default.
+func BulkWorkers(n int) Option {
+	return func(tree *Rtree) {
+		tree.bulkWorkers = n
+	}
+}
+
+// NewTreeBulk creates a new R-tree holding objs, built by Sort-Tile-Recursive
+// packing as InsertBatch does for an empty tree.  Nodes are packed to
+// round(fillFactor*MaxChildren) entries, clamped to lie between MinChildren
+// and MaxChildren, or likewise for the capacity set by LeafCapacity in the
+// case of leaves, rather than filled completely.  A fill factor of 1 gives
+// the smallest, fastest tree for static data, while DefaultFillFactor leaves
+// room for later insertions.
+func NewTreeBulk(MinChildren, MaxChildren int, fillFactor float64, objs []Spatial, opts ...Option) *Rtree {
+	tree := NewTree(MinChildren, MaxChildren, opts...)
+	if len(objs) == 0 {
+		return tree
+	}
+	entries := make([]entry, len(objs))
+	for i, obj := range objs {
+		entries[i] = entry{obj.Bounds(), nil, obj}
+	}
+	tree.bulkLoadFill(entries, fillFactor)
+	return tree
+}
+
+// BuildFromChan creates a new R-tree holding every object received from ch.
+// The objects are buffered until ch is closed and then packed as InsertBatch
+// does, which is faster than inserting them as they arrive.
+func BuildFromChan(MinChildren, MaxChildren int, ch <-chan Spatial, opts ...Option) *Rtree {
+	var objs []Spatial
+	for obj := range ch {
+		objs = append(objs, obj)
+	}
+	return NewTreeBulk(MinChildren, MaxChildren, 1, objs, opts...)
+}
+
+// InsertBatch inserts many spatial objects into the tree.  If the tree is
+// empty, it is built directly from objs by Sort-Tile-Recursive packing, which
+// is much faster than inserting the objects one at a time and produces nodes
+// with little overlap.  Otherwise the objects are inserted one at a time.
+//
+// STR packing is described in "STR: A Simple and Efficient Algorithm for
+// R-Tree Packing" by S. Leutenegger, M. Lopez and J. Edgington, Proceedings
+// of ICDE, pages 497-506, 1997.
+func (tree *Rtree) InsertBatch(objs []Spatial) {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	if tree.size == 0 && len(objs) > 0 {
+		entries := make([]entry, len(objs))
+		for i, obj := range objs {
+			entries[i] = entry{obj.Bounds(), nil, obj}
+		}
+		tree.bulkLoad(entries)
+		return
+	}
+
+	for _, obj := range objs {
+		tree.reinserted = nil
+		tree.insert(entry{obj.Bounds(), nil, obj}, 1)
+		tree.size++
+	}
+}
+
+// Rebuild repacks all objects in tree by Sort-Tile-Recursive packing, as
+// InsertBatch does for an empty tree.  It is useful as periodic maintenance
+// after many deletions, which can leave the tree deeper and sparser than
+// necessary.
+func (tree *Rtree) Rebuild() {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	tree.rebuild()
+}
+
+func (tree *Rtree) rebuild() {
+	tree.deletions = 0
+	entries := tree.leafEntries(tree.root, make([]entry, 0, tree.size))
+	if len(entries) == 0 {
+		tree.clear()
+		return
+	}
+	tree.bulkLoad(entries)
+}
+
+// AutoRebuild makes the tree Rebuild itself once deleteThreshold objects have
+// been removed from it since it was last rebuilt, counting objects removed by
+// Delete, DeleteWithComparator, DeleteWithin, DeleteIntersecting and
+// PopNearest.  The rebuild happens within the call that reaches the
+// threshold, while the tree is locked, so it never interrupts a query.  A
+// threshold of zero or less disables it, as by default.
+func AutoRebuild(deleteThreshold int) Option {
+	return func(tree *Rtree) {
+		tree.autoRebuild = deleteThreshold
+	}
+}
+
+// deleted records that n objects were removed from tree, rebuilding it if
+// that reaches the threshold set by AutoRebuild.
+func (tree *Rtree) deleted(n int) {
+	if tree.autoRebuild <= 0 {
+		return
+	}
+	tree.deletions += n
+	if tree.deletions >= tree.autoRebuild {
+		tree.rebuild()
+	}
+}
+
+// Merge moves all objects from other into tree, leaving other empty.  If the
+// trees have the same branching factors, the subtrees below the root of the
+// shorter tree are grafted whole into the taller one, which is much faster
+// than reinserting their objects; otherwise the objects of other are
+// inserted one at a time.  Merging a tree into itself does nothing.
+//
+// Merge locks tree and then other, so two trees must not be merged into each
+// other concurrently.
+func (tree *Rtree) Merge(other *Rtree) {
+	if other == tree {
+		return
+	}
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	other.mu.Lock()
+	defer other.mu.Unlock()
+
+	if other.size == 0 {
+		return
+	}
+	size := tree.size + other.size
+	if !tree.sameCapacity(other) {
+		for _, e := range tree.leafEntries(other.root, make([]entry, 0, other.size)) {
+			tree.reinserted = nil
+			tree.insert(e, 1)
+		}
+		tree.size = size
+		other.clear()
+		return
+	}
+
+	// graft the shorter tree into the taller one, which becomes tree's
+	graft := other.root
+	if other.height > tree.height {
+		graft = tree.root
+		tree.root, tree.height = other.root, other.height
+		// the objects of other bypass insert, so the extent must be
+		// recomputed
+		tree.extentValid = false
+	}
+	for _, e := range graft.entries {
+		tree.reinserted = nil
+		if graft.leaf {
+			tree.insert(e, 1)
+		} else {
+			// e.child is at level graft.level-1, so it joins a node at
+			// graft.level, which exists since tree is at least as tall
+			tree.insert(e, graft.level)
+		}
+	}
+	tree.size = size
+	other.clear()
+}
+
+// sameCapacity reports whether tree and other allow the same numbers of
+// entries at every level.
+func (tree *Rtree) sameCapacity(other *Rtree) bool {
+	for _, level := range []int{1, 2} {
+		if tree.minChildren(level) != other.minChildren(level) || tree.maxChildren(level) != other.maxChildren(level) {
+			return false
+		}
+	}
+	return true
+}
+
+// leafEntries appends the object entries in the subtree rooted at n to
+// entries.
+func (tree *Rtree) leafEntries(n *node, entries []entry) []entry {
+	if n.leaf {
+		return append(entries, n.entries...)
+	}
+	for _, e := range n.entries {
+		entries = tree.leafEntries(e.child, entries)
+	}
+	return entries
+}
+
+// bulkLoad replaces the contents of tree with a tree packed from the given
+// leaf entries.
+func (tree *Rtree) bulkLoad(entries []entry) {
+	tree.bulkLoadFill(entries, 1)
+}
+
+// bulkLoadFill replaces the contents of tree with a tree packed from the
+// given leaf entries, filling nodes to the given fraction of their maximum
+// number of entries where possible.
+func (tree *Rtree) bulkLoadFill(entries []entry, fillFactor float64) {
+	nodes := tree.pack(entries, 1, tree.packCapacity(1, fillFactor))
+	for len(nodes) > 1 {
+		parents := make([]entry, len(nodes))
+		for i, n := range nodes {
+			parents[i] = entry{bb: n.computeBoundingBox(), child: n}
+		}
+		level := nodes[0].level + 1
+		nodes = tree.pack(parents, level, tree.packCapacity(level, fillFactor))
+	}
+
+	tree.root = nodes[0]
+	tree.root.parent = nil
+	tree.height = tree.root.level
+	tree.size = len(entries)
+	tree.reinserted = nil
+	tree.extentValid = false
+}
+
+// packCapacity returns the number of entries to pack into nodes at level, the
+// given fraction of their maximum clamped to the allowed range.
+func (tree *Rtree) packCapacity(level int, fillFactor float64) int {
+	max := tree.maxChildren(level)
+	capacity := int(math.Round(fillFactor * float64(max)))
+	if capacity > max {
+		capacity = max
+	}
+	if min := tree.minChildren(level); capacity < min {
+		capacity = min
+	}
+	if capacity < 2 {
+		capacity = 2
+	}
+	return capacity
+}
+
+// pack groups entries into nodes at the specified level by sorting them into
+// vertical slices by the X coordinate of their centers, then sorting each
+// slice by the Y coordinate and cutting it into runs of at most capacity
+// entries.  Where that would leave a slice or run with fewer than the minimum
+// number of entries, fewer, larger ones are used instead.
+func (tree *Rtree) pack(entries []entry, level, capacity int) []*node {
+	leaves := int(math.Ceil(float64(len(entries)) / float64(capacity)))
+	slices := tree.limitChunks(len(entries), int(math.Ceil(math.Sqrt(float64(leaves)))), level)
+
+	sortEntriesBy(entries, func(bb *BBox) float64 { return bb.min.X + bb.max.X })
+	chunks := evenChunks(entries, slices)
+	packed := make([][]*node, len(chunks))
+	packSlice := func(i int) {
+		slice := chunks[i]
+		sortEntriesBy(slice, func(bb *BBox) float64 { return bb.min.Y + bb.max.Y })
+		runs := tree.limitChunks(len(slice), int(math.Ceil(float64(len(slice))/float64(capacity))), level)
+		for _, run := range evenChunks(slice, runs) {
+			n := &node{leaf: level == 1, level: level}
+			n.entries = make([]entry, 0, len(run))
+			for _, e := range run {
+				assign(e, n)
+			}
+			packed[i] = append(packed[i], n)
+		}
+	}
+
+	// the slices are disjoint, so they can be sorted and cut concurrently
+	// without affecting the result
+	if tree.bulkWorkers < 2 || len(chunks) < 2 {
+		for i := range chunks {
+			packSlice(i)
+		}
+	} else {
+		indices := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < tree.bulkWorkers && w < len(chunks); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indices {
+					packSlice(i)
+				}
+			}()
+		}
+		for i := range chunks {
+			indices <- i
+		}
+		close(indices)
+		wg.Wait()
+	}
+
+	nodes := []*node{}
+	for _, p := range packed {
+		nodes = append(nodes, p...)
+	}
+	return nodes
+}
+
+// limitChunks reduces n, the number of chunks to cut count entries into, so
+// that each chunk holds at least the minimum number of entries of nodes at
+// level, unless that would make chunks larger than their maximum.
+func (tree *Rtree) limitChunks(count, n, level int) int {
+	min := tree.minChildren(level)
+	if min <= 0 {
+		return n
+	}
+	if m := count / min; n > m && m >= 1 && (count+m-1)/m <= tree.maxChildren(level) {
+		n = m
+	}
+	return n
+}
+
+// sortEntriesBy sorts entries in place by key applied to their bounding boxes.
+func sortEntriesBy(entries []entry, key func(bb *BBox) float64) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return key(entries[i].bb) < key(entries[j].bb)
+	})
+}
+
+// evenChunks cuts entries into n consecutive chunks whose sizes differ by at
+// most one, so that no chunk is left underfull.
+func evenChunks(entries []entry, n int) [][]entry {
+	if n < 1 {
+		n = 1
+	}
+	chunks := make([][]entry, 0, n)
+	size, extra := len(entries)/n, len(entries)%n
+	for i := 0; i < n; i++ {
+		k := size
+		if i < extra {
+			k++
+		}
+		chunks = append(chunks, entries[:k])
+		entries = entries[k:]
+	}
+	return chunks
+}
@@ -0,0 +1,481 @@
+package rtree
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func randomBBoxes(r *rand.Rand, n int) []Spatial {
+	objs := make([]Spatial, n)
+	for i := range objs {
+		p := Point{r.Float64()*1000 - 500, r.Float64()*1000 - 500}
+		objs[i] = mustBBox(p, []float64{r.Float64() * 5, r.Float64() * 5})
+	}
+	return objs
+}
+
+func TestInsertBatch(t *testing.T) {
+	objs := randomBBoxes(rand.New(rand.NewSource(1)), 500)
+	original := append([]Spatial{}, objs...)
+
+	rt := NewTree(3, 8)
+	rt.InsertBatch(objs)
+
+	if !reflect.DeepEqual(objs, original) {
+		t.Errorf("InsertBatch modified its argument")
+	}
+	if rt.Size() != len(objs) {
+		t.Errorf("expected size %d, got %d", len(objs), rt.Size())
+	}
+	verify(t, rt.root)
+	verifyStructure(t, rt, rt.root)
+	for _, obj := range objs {
+		if rt.findLeaf(rt.root, obj, defaultComparator) == nil {
+			t.Errorf("unable to find leaf containing %v", obj)
+		}
+	}
+
+	all := mustBBox(Point{-1000, -1000}, []float64{2000, 2000})
+	if q := rt.SearchIntersect(all); len(q) != len(objs) {
+		t.Errorf("expected %d results, got %d", len(objs), len(q))
+	}
+
+	rt.InsertBatch(nil)
+	if rt.Size() != len(objs) {
+		t.Errorf("expected empty InsertBatch to keep size %d, got %d", len(objs), rt.Size())
+	}
+}
+
+func TestInsertBatchNonEmpty(t *testing.T) {
+	objs := randomBBoxes(rand.New(rand.NewSource(2)), 100)
+
+	rt := NewTree(3, 8)
+	rt.InsertBatch(objs[:30])
+	rt.InsertBatch(objs[30:])
+
+	if rt.Size() != len(objs) {
+		t.Errorf("expected size %d, got %d", len(objs), rt.Size())
+	}
+	verify(t, rt.root)
+	for _, obj := range objs {
+		if q := rt.SearchIntersect(obj.Bounds()); indexOf(q, obj) < 0 {
+			t.Errorf("SearchIntersect failed to find %v", obj)
+		}
+	}
+}
+
+func TestInsertBatchSmall(t *testing.T) {
+	for n := 1; n <= 30; n++ {
+		objs := randomBBoxes(rand.New(rand.NewSource(int64(n))), n)
+		rt := NewTree(3, 8)
+		rt.InsertBatch(objs)
+		if rt.Size() != n {
+			t.Errorf("expected size %d, got %d", n, rt.Size())
+		}
+		verify(t, rt.root)
+		verifyStructure(t, rt, rt.root)
+	}
+}
+
+func countNodes(rt *Rtree) int {
+	nodes := 0
+	rt.Walk(func(level int, bb *BBox, isLeaf bool) {
+		if !isLeaf {
+			nodes++
+		}
+	})
+	return nodes
+}
+
+func TestRebuild(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	objs := randomBBoxes(r, 1000)
+	rt := NewTree(3, 8)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	for _, obj := range objs[:900] {
+		if !rt.Delete(obj) {
+			t.Fatalf("failed to delete %v", obj)
+		}
+	}
+	remaining := objs[900:]
+
+	queries := randomBBoxes(r, 50)
+	for i, q := range queries {
+		queries[i] = q.Bounds().Expand(50)
+	}
+	before := make([][]Spatial, len(queries))
+	for i, q := range queries {
+		before[i] = rt.SearchIntersect(q.Bounds())
+	}
+	depth, nodes := rt.Depth(), countNodes(rt)
+
+	rt.Rebuild()
+
+	if rt.Size() != len(remaining) {
+		t.Errorf("expected size %d, got %d", len(remaining), rt.Size())
+	}
+	verify(t, rt.root)
+	verifyStructure(t, rt, rt.root)
+	if rt.Depth() > depth {
+		t.Errorf("expected depth at most %d, got %d", depth, rt.Depth())
+	}
+	if n := countNodes(rt); n >= nodes {
+		t.Errorf("expected fewer than %d nodes, got %d", nodes, n)
+	}
+	for i, q := range queries {
+		after := rt.SearchIntersect(q.Bounds())
+		if len(after) != len(before[i]) {
+			t.Errorf("expected %d results for %v, got %d", len(before[i]), q, len(after))
+		}
+		for _, obj := range before[i] {
+			if indexOf(after, obj) < 0 {
+				t.Errorf("lost %v from the results for %v", obj, q)
+			}
+		}
+	}
+
+	for _, obj := range remaining {
+		rt.Delete(obj)
+	}
+	rt.Rebuild()
+	if rt.Size() != 0 || rt.Depth() != 0 {
+		t.Errorf("expected an empty tree, got size %d and depth %d", rt.Size(), rt.Depth())
+	}
+	rt.Insert(objs[0])
+	if q := rt.SearchIntersect(objs[0].Bounds()); len(q) != 1 {
+		t.Errorf("expected an emptied tree to remain usable, got %v", q)
+	}
+}
+
+func TestAutoRebuild(t *testing.T) {
+	objs := randomBBoxes(rand.New(rand.NewSource(139)), 1000)
+	rt := NewTree(2, 8, AutoRebuild(300))
+	plain := NewTree(2, 8)
+	for _, obj := range objs {
+		rt.Insert(obj)
+		plain.Insert(obj)
+	}
+
+	for _, obj := range objs[:299] {
+		rt.Delete(obj)
+		plain.Delete(obj)
+	}
+	if !sameNodes(rt.root, plain.root) {
+		t.Fatalf("expected no rebuild before the threshold")
+	}
+	rt.Delete(objs[299])
+	plain.Delete(objs[299])
+	if sameNodes(rt.root, plain.root) {
+		t.Fatalf("expected a rebuild at the threshold")
+	}
+	if err := rt.Validate(); err != nil {
+		t.Fatalf("after rebuild: %v", err)
+	}
+	remaining := objs[300:]
+	if all := rt.All(); !sameObjects(all, remaining) {
+		t.Errorf("expected %d objects after rebuild, got %d", len(remaining), len(all))
+	}
+	stats, plainStats := rt.LevelStats(), plain.LevelStats()
+	if leaves, plainLeaves := stats[len(stats)-1], plainStats[len(plainStats)-1]; leaves.Nodes >= plainLeaves.Nodes {
+		t.Errorf("expected a rebuild to pack the leaves, got %+v and %+v without", leaves, plainLeaves)
+	}
+	plain.Rebuild()
+	if !sameNodes(rt.root, plain.root) {
+		t.Errorf("expected the same tree as an explicit Rebuild")
+	}
+
+	// the count restarts after a rebuild, and region deletions count too
+	if rt.deletions != 0 {
+		t.Errorf("expected the count to restart after a rebuild, got %d", rt.deletions)
+	}
+	removed := rt.DeleteIntersecting(remaining[0].Bounds().Expand(100))
+	if removed == 0 || removed >= 300 {
+		t.Fatalf("expected to delete some but fewer than 300 objects, deleted %d", removed)
+	}
+	if rt.deletions != removed {
+		t.Errorf("expected %d deletions to be counted, got %d", removed, rt.deletions)
+	}
+	for ; removed < 300; removed++ {
+		if _, ok := rt.PopNearest(Point{0, 0}); !ok {
+			t.Fatalf("expected an object to pop")
+		}
+	}
+	if rt.deletions != 0 {
+		t.Errorf("expected a second rebuild, got %d deletions counted", rt.deletions)
+	}
+	if err := rt.Validate(); err != nil {
+		t.Errorf("after second rebuild: %v", err)
+	}
+	if rt.Size() != len(remaining)-300 {
+		t.Errorf("expected size %d, got %d", len(remaining)-300, rt.Size())
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	objs := randomBBoxes(rand.New(rand.NewSource(1)), 10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rt := NewTree(10, 25)
+		for _, obj := range objs {
+			rt.Insert(obj)
+		}
+	}
+}
+
+func BenchmarkInsertBatch(b *testing.B) {
+	objs := randomBBoxes(rand.New(rand.NewSource(1)), 10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rt := NewTree(10, 25)
+		rt.InsertBatch(objs)
+	}
+}
+
+func BenchmarkNewTreeBulk(b *testing.B) {
+	objs := randomBBoxes(rand.New(rand.NewSource(1)), 200000)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				NewTreeBulk(10, 25, 1, objs, BulkWorkers(workers))
+			}
+		})
+	}
+}
+
+// sameNodes reports whether the subtrees rooted at a and b have the same
+// shape, bounding boxes and objects.
+func sameNodes(a, b *node) bool {
+	if a.level != b.level || a.leaf != b.leaf || len(a.entries) != len(b.entries) {
+		return false
+	}
+	for i, e := range a.entries {
+		f := b.entries[i]
+		if !e.bb.Equal(f.bb, 0) || e.obj != f.obj {
+			return false
+		}
+		if !a.leaf && !sameNodes(e.child, f.child) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBulkWorkers(t *testing.T) {
+	objs := randomBBoxes(rand.New(rand.NewSource(101)), 5000)
+	for _, fill := range []float64{1, DefaultFillFactor} {
+		sequential := NewTreeBulk(3, 12, fill, objs)
+		for _, workers := range []int{0, 2, 3, 8, 100} {
+			rt := NewTreeBulk(3, 12, fill, objs, BulkWorkers(workers))
+			if err := rt.Validate(); err != nil {
+				t.Fatalf("fill %v, %d workers: %v", fill, workers, err)
+			}
+			if !sameNodes(rt.root, sequential.root) {
+				t.Errorf("fill %v, %d workers: expected the same tree as a sequential build", fill, workers)
+			}
+		}
+	}
+
+	// InsertBatch into an empty tree packs the same way
+	rt := NewTree(3, 12, BulkWorkers(4))
+	rt.InsertBatch(objs)
+	sequential := NewTree(3, 12)
+	sequential.InsertBatch(objs)
+	if !sameNodes(rt.root, sequential.root) {
+		t.Errorf("expected InsertBatch to build the same tree with workers")
+	}
+}
+
+// countingSplitter counts the splits made by QuadraticSplit.
+type countingSplitter struct {
+	splits int
+}
+
+func (s *countingSplitter) Split(boxes []*BBox, minFill int) (left, right []int) {
+	s.splits++
+	return QuadraticSplit{}.Split(boxes, minFill)
+}
+
+func TestNewTreeBulk(t *testing.T) {
+	r := rand.New(rand.NewSource(37))
+	objs := randomBBoxes(r, 2000)
+	extra := randomBBoxes(r, 500)
+
+	splits := map[float64]int{}
+	for _, fill := range []float64{1, DefaultFillFactor, 0.5} {
+		s := &countingSplitter{}
+		rt := NewTreeBulk(4, 10, fill, objs, Splitter(s))
+		if rt.Size() != len(objs) {
+			t.Errorf("fill %v: expected size %d, got %d", fill, len(objs), rt.Size())
+		}
+		if err := rt.Validate(); err != nil {
+			t.Errorf("fill %v: %v", fill, err)
+		}
+
+		// leaves hold round(fill*MaxChildren) entries, give or take one from
+		// spreading the entries evenly
+		capacity := int(fill*10 + 0.5)
+		leaves, total := 0, 0
+		rt.Walk(func(level int, bb *BBox, isLeaf bool) {
+			if level == 1 {
+				leaves++
+			}
+			if isLeaf {
+				total++
+			}
+		})
+		if min := (total + capacity - 1) / capacity; leaves < min || leaves > min+min/4 {
+			t.Errorf("fill %v: expected about %d leaves, got %d", fill, min, leaves)
+		}
+		checkLeafSizes(t, rt.root, capacity)
+
+		for _, obj := range extra {
+			rt.Insert(obj)
+		}
+		splits[fill] = s.splits
+		if err := rt.Validate(); err != nil {
+			t.Errorf("fill %v after inserts: %v", fill, err)
+		}
+	}
+	if splits[DefaultFillFactor] >= splits[1] || splits[0.5] >= splits[DefaultFillFactor] {
+		t.Errorf("expected fewer splits with lower fill factors, got %v", splits)
+	}
+
+	if rt := NewTreeBulk(2, 5, DefaultFillFactor, nil); rt.Size() != 0 || rt.Validate() != nil {
+		t.Errorf("expected an empty, valid tree")
+	}
+	// out of range fill factors are clamped to the branching factors
+	for _, fill := range []float64{0, 0.1, 2} {
+		rt := NewTreeBulk(3, 6, fill, objs[:200])
+		if err := rt.Validate(); err != nil {
+			t.Errorf("fill %v: %v", fill, err)
+		}
+	}
+}
+
+// checkLeafSizes checks that no leaf below n holds more than capacity
+// entries.
+func checkLeafSizes(t *testing.T, n *node, capacity int) {
+	if n.leaf {
+		if len(n.entries) > capacity {
+			t.Errorf("leaf holds %d entries, more than %d", len(n.entries), capacity)
+		}
+		return
+	}
+	for _, e := range n.entries {
+		checkLeafSizes(t, e.child, capacity)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(41))
+	tests := []struct {
+		name   string
+		a, b   *Rtree
+		na, nb int
+	}{
+		{"same height", NewTree(3, 8), NewTree(3, 8), 300, 300},
+		{"taller source", NewTree(3, 8), NewTree(3, 8), 20, 600},
+		{"taller target", NewTreeRStar(3, 8), NewTreeRStar(3, 8), 600, 20},
+		{"leaf source", NewTree(3, 8), NewTree(3, 8), 200, 5},
+		{"empty target", NewTree(3, 8), NewTree(3, 8), 0, 200},
+		{"empty source", NewTree(3, 8), NewTree(3, 8), 200, 0},
+		{"different fan-out", NewTree(2, 5), NewTree(3, 8), 200, 200},
+	}
+	for _, test := range tests {
+		objsA, objsB := randomBBoxes(r, test.na), randomBBoxes(r, test.nb)
+		for _, obj := range objsA {
+			test.a.Insert(obj)
+		}
+		for _, obj := range objsB {
+			test.b.Insert(obj)
+		}
+
+		test.a.Merge(test.b)
+		objs := append(objsA, objsB...)
+		if test.a.Size() != len(objs) {
+			t.Errorf("%s: expected size %d, got %d", test.name, len(objs), test.a.Size())
+		}
+		if test.b.Size() != 0 || test.b.Depth() != 0 {
+			t.Errorf("%s: expected the source to be empty, got size %d", test.name, test.b.Size())
+		}
+		if err := test.a.Validate(); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if err := test.b.Validate(); err != nil {
+			t.Errorf("%s: source: %v", test.name, err)
+		}
+
+		for i := 0; i < 20; i++ {
+			q := mustBBox(Point{r.Float64()*1000 - 500, r.Float64()*1000 - 500}, []float64{100, 100})
+			expected := 0
+			for _, obj := range objs {
+				if Closed.Overlaps(obj.Bounds(), q) {
+					expected++
+				}
+			}
+			if found := test.a.SearchIntersect(q); len(found) != expected {
+				t.Errorf("%s: expected %d results for %v, got %d", test.name, expected, q, len(found))
+			}
+		}
+		for _, obj := range objs {
+			if !test.a.Delete(obj) {
+				t.Errorf("%s: failed to delete %v", test.name, obj)
+			}
+		}
+
+		// the emptied source is still usable
+		test.b.Insert(mustBBox(Point{0, 0}, []float64{1, 1}))
+		if test.b.Size() != 1 {
+			t.Errorf("%s: expected the source to be reusable", test.name)
+		}
+	}
+
+	rt := NewTree(3, 8)
+	rt.Insert(mustBBox(Point{0, 0}, []float64{1, 1}))
+	rt.Merge(rt)
+	if rt.Size() != 1 {
+		t.Errorf("expected merging a tree into itself to do nothing, got size %d", rt.Size())
+	}
+}
+
+func TestBuildFromChan(t *testing.T) {
+	objs := randomBBoxes(rand.New(rand.NewSource(89)), 1000)
+	ch := make(chan Spatial)
+	go func() {
+		for _, obj := range objs {
+			ch <- obj
+		}
+		close(ch)
+	}()
+
+	rt := BuildFromChan(3, 8, ch)
+	if rt.Size() != len(objs) {
+		t.Errorf("expected size %d, got %d", len(objs), rt.Size())
+	}
+	if err := rt.Validate(); err != nil {
+		t.Errorf("%v", err)
+	}
+	r := rand.New(rand.NewSource(97))
+	for i := 0; i < 20; i++ {
+		q := mustBBox(Point{r.Float64()*1000 - 500, r.Float64()*1000 - 500}, []float64{100, 100})
+		var expected []Spatial
+		for _, obj := range objs {
+			if Closed.Overlaps(obj.Bounds(), q) {
+				expected = append(expected, obj)
+			}
+		}
+		if found := rt.SearchIntersect(q); !sameObjects(found, expected) {
+			t.Errorf("expected %d results for %v, got %d", len(expected), q, len(found))
+		}
+	}
+
+	empty := make(chan Spatial)
+	close(empty)
+	if rt := BuildFromChan(3, 8, empty, Splitter(LinearSplit{})); rt.Size() != 0 || rt.splitter == nil {
+		t.Errorf("expected an empty tree with the given options")
+	}
+}
@@ -0,0 +1,59 @@
+package rtree
+
+import "fmt"
+
+func ExampleBoxItem() {
+	rt := NewTree(2, 4)
+	for _, p := range []Point{{0, 0}, {2, 1}, {5, 5}, {1, 3}, {8, 0}} {
+		b, err := NewBoxItem(p, 1, 1)
+		if err != nil {
+			panic(err)
+		}
+		rt.Insert(b)
+	}
+
+	query, _ := NewBBox(Point{0.5, 0.5}, 2, 3)
+	byCorner := func(a, b Spatial) bool {
+		p, q := a.Bounds().min, b.Bounds().min
+		return p.X < q.X || (p.X == q.X && p.Y < q.Y)
+	}
+	for _, obj := range rt.SearchIntersectSorted(query, byCorner) {
+		fmt.Println(obj.Bounds())
+	}
+	// Output:
+	// [0.00, 0.00]x[1.00, 1.00]
+	// [1.00, 3.00]x[2.00, 4.00]
+	// [2.00, 1.00]x[3.00, 2.00]
+}
+
+func ExamplePointItem() {
+	rt := NewTree(2, 4)
+	for _, p := range []Point{{0, 0}, {2, 1}, {5, 5}, {1, 3}, {8, 0}} {
+		rt.Insert(NewPointItem(p))
+	}
+
+	for _, obj := range rt.NearestNeighbors(2, Point{1, 1}) {
+		fmt.Println(obj.(PointItem).Point())
+	}
+	// Output:
+	// [2.00, 1.00]
+	// [0.00, 0.00]
+}
+
+func ExampleRecord() {
+	rt := NewTree(2, 4)
+	rooms := map[string]Point{"kitchen": {0, 0}, "hall": {4, 0}, "study": {4, 3}}
+	for name, corner := range rooms {
+		bb, err := NewBBox(corner, 4, 3)
+		if err != nil {
+			panic(err)
+		}
+		rt.Insert(Record{BBox: bb, Data: name})
+	}
+
+	for _, obj := range rt.SearchContainingPoint(Point{5, 4}) {
+		fmt.Println(obj.(Record).Data)
+	}
+	// Output:
+	// study
+}
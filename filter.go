@@ -3,7 +3,8 @@ package rtree
 // Filter is an interface for filtering leaves during search. The parameters
 // should be treated as read-only. If refuse is true, the currenty entry will
 // not be added to the result set. If abort is true, the search is aborted and
-// the current result set will be returned.
+// the current result set will be returned. Filters are called while the
+// tree is locked, so they must not call methods of the tree.
 type Filter func(results []Spatial, object Spatial) (refuse, abort bool)
 
 // ApplyFilters applies the given filters and returns their consensus.
@@ -0,0 +1,130 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// GeoJSONFeature is a GeoJSON feature indexed by the bounding box of its
+// geometry.  Longitude is stored as X and latitude as Y.
+type GeoJSONFeature struct {
+	ID         interface{}
+	Properties map[string]interface{}
+	bb         *BBox
+}
+
+// Bounds returns the bounding box of the feature's geometry.
+func (f *GeoJSONFeature) Bounds() *BBox {
+	return f.bb
+}
+
+type geoJSONObject struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id"`
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   *geoJSONGeometry       `json:"geometry"`
+	Features   []geoJSONObject        `json:"features"`
+}
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// FromGeoJSON reads a GeoJSON FeatureCollection or Feature from r and returns
+// its features as Spatial objects of type *GeoJSONFeature.  Point geometries
+// become zero-size boxes and Polygon geometries are reduced to the
+// axis-aligned bounding box of their coordinates.  Other geometry types are
+// rejected with an error.
+func FromGeoJSON(r io.Reader) ([]Spatial, error) {
+	var obj geoJSONObject
+	if err := json.NewDecoder(r).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("rtree: invalid GeoJSON: %v", err)
+	}
+
+	var features []geoJSONObject
+	switch obj.Type {
+	case "FeatureCollection":
+		features = obj.Features
+	case "Feature":
+		features = []geoJSONObject{obj}
+	default:
+		return nil, fmt.Errorf("rtree: unsupported GeoJSON object type %q", obj.Type)
+	}
+
+	objs := make([]Spatial, 0, len(features))
+	for i, f := range features {
+		if f.Type != "Feature" {
+			return nil, fmt.Errorf("rtree: GeoJSON feature %d has type %q", i, f.Type)
+		}
+		if f.Geometry == nil {
+			return nil, fmt.Errorf("rtree: GeoJSON feature %d has no geometry", i)
+		}
+		bb, err := f.Geometry.bounds()
+		if err != nil {
+			return nil, fmt.Errorf("rtree: GeoJSON feature %d: %v", i, err)
+		}
+		objs = append(objs, &GeoJSONFeature{ID: f.ID, Properties: f.Properties, bb: bb})
+	}
+	return objs, nil
+}
+
+// bounds computes the bounding box of a Point or Polygon geometry.
+func (g *geoJSONGeometry) bounds() (*BBox, error) {
+	switch g.Type {
+	case "Point":
+		var pos []float64
+		if err := json.Unmarshal(g.Coordinates, &pos); err != nil {
+			return nil, fmt.Errorf("invalid Point coordinates: %v", err)
+		}
+		p, err := geoJSONPosition(pos)
+		if err != nil {
+			return nil, err
+		}
+		return p.ToBBox(0), nil
+	case "Polygon":
+		var rings [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+			return nil, fmt.Errorf("invalid Polygon coordinates: %v", err)
+		}
+		bb := &BBox{
+			min: Point{X: math.Inf(1), Y: math.Inf(1)},
+			max: Point{X: math.Inf(-1), Y: math.Inf(-1)},
+		}
+		n := 0
+		for _, ring := range rings {
+			for _, pos := range ring {
+				p, err := geoJSONPosition(pos)
+				if err != nil {
+					return nil, err
+				}
+				bb = boundingBox(bb, p.ToBBox(0))
+				n++
+			}
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("Polygon has no coordinates")
+		}
+		return bb, nil
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q", g.Type)
+	}
+}
+
+// geoJSONPosition converts a GeoJSON position, [longitude, latitude] with an
+// optional altitude, into a Point.
+func geoJSONPosition(pos []float64) (Point, error) {
+	if len(pos) < 2 || len(pos) > 3 {
+		return Point{}, fmt.Errorf("position %v must have 2 or 3 coordinates", pos)
+	}
+	if pos[0] < -180 || pos[0] > 180 || pos[1] < -90 || pos[1] > 90 {
+		return Point{}, fmt.Errorf("position %v is out of range", pos)
+	}
+	return Point{X: pos[0], Y: pos[1]}, nil
+}
@@ -0,0 +1,95 @@
+package rtree
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleGeoJSON = `{
+  "type": "FeatureCollection",
+  "features": [
+    {
+      "type": "Feature",
+      "id": "tower",
+      "properties": {"name": "Eiffel Tower"},
+      "geometry": {"type": "Point", "coordinates": [2.2945, 48.8584]}
+    },
+    {
+      "type": "Feature",
+      "properties": {"name": "block"},
+      "geometry": {
+        "type": "Polygon",
+        "coordinates": [[[2.0, 48.0], [3.0, 48.5], [2.5, 49.0], [2.0, 48.0]]]
+      }
+    }
+  ]
+}`
+
+func TestFromGeoJSON(t *testing.T) {
+	objs, err := FromGeoJSON(strings.NewReader(sampleGeoJSON))
+	if err != nil {
+		t.Fatalf("FromGeoJSON failed: %v", err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("Expected 2 features, got %d", len(objs))
+	}
+
+	tower := objs[0].(*GeoJSONFeature)
+	if tower.ID != "tower" || tower.Properties["name"] != "Eiffel Tower" {
+		t.Errorf("Unexpected feature %v", tower)
+	}
+	p := Point{2.2945, 48.8584}
+	if bb := tower.Bounds(); p.dist(bb.min) > EPS || p.dist(bb.max) > EPS {
+		t.Errorf("Expected point feature bounds at %v, got %v", p, bb)
+	}
+
+	block := objs[1].(*GeoJSONFeature)
+	min, max := Point{2.0, 48.0}, Point{3.0, 49.0}
+	if bb := block.Bounds(); min.dist(bb.min) > EPS || max.dist(bb.max) > EPS {
+		t.Errorf("Expected polygon feature bounds %v, %v, got %v", min, max, bb)
+	}
+
+	rt := NewTree(3, 3)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	if q := rt.SearchIntersect(mustBBox(Point{2.9, 48.4}, []float64{1, 1})); len(q) != 1 || q[0] != block {
+		t.Errorf("Expected query to find the polygon feature, got %v", q)
+	}
+}
+
+func TestFromGeoJSONSingleFeature(t *testing.T) {
+	objs, err := FromGeoJSON(strings.NewReader(`{"type": "Feature", "geometry": {"type": "Point", "coordinates": [1, 2, 30]}}`))
+	if err != nil {
+		t.Fatalf("FromGeoJSON failed: %v", err)
+	}
+	if len(objs) != 1 {
+		t.Fatalf("Expected 1 feature, got %d", len(objs))
+	}
+}
+
+func TestFromGeoJSONErrors(t *testing.T) {
+	tests := []struct {
+		input, msg string
+	}{
+		{`{"type": "FeatureCollection", "features": [`, "invalid GeoJSON"},
+		{`{"type": "Point", "coordinates": [1, 2]}`, "unsupported GeoJSON object type"},
+		{`{"type": "Feature", "geometry": {"type": "Point", "coordinates": [1]}}`, "must have 2 or 3 coordinates"},
+		{`{"type": "Feature", "geometry": {"type": "Point", "coordinates": [200, 2]}}`, "out of range"},
+		{`{"type": "Feature", "geometry": {"type": "Point", "coordinates": ["a", 2]}}`, "invalid Point coordinates"},
+		{`{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1]]]}}`, "must have 2 or 3 coordinates"},
+		{`{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": []}}`, "no coordinates"},
+		{`{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[0, 0], [1, 1]]}}`, "unsupported geometry type"},
+		{`{"type": "Feature"}`, "no geometry"},
+	}
+	for _, test := range tests {
+		objs, err := FromGeoJSON(strings.NewReader(test.input))
+		if err == nil {
+			t.Errorf("Expected error for %s, got %v", test.input, objs)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.msg) {
+			t.Errorf("Expected error for %s to mention %q, got %q", test.input, test.msg, err)
+		}
+	}
+}
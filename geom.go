@@ -7,14 +7,16 @@ package rtree
 import (
 	"fmt"
 	"math"
+	"sort"
 )
 
 // DistError is an improper distance measurement.  It implements the error
-// and is generated when a distance-related assertion fails.
+// and is generated when a distance-related assertion fails.  Its value is
+// the offending distance.
 type DistError float64
 
 func (err DistError) Error() string {
-	return "rtree: improper distance"
+	return fmt.Sprintf("rtree: improper distance %v", float64(err))
 }
 
 // Point represents a point in n-dimensional Euclidean space.
@@ -22,6 +24,20 @@ type Point struct {
 	X, Y float64
 }
 
+// PointsFromFlat pairs consecutive values of coords, interleaved as
+// x0, y0, x1, y1, ..., into Points.  It returns an error if coords has an odd
+// length.
+func PointsFromFlat(coords []float64) ([]Point, error) {
+	if len(coords)%2 != 0 {
+		return nil, fmt.Errorf("rtree: odd number of coordinates %d", len(coords))
+	}
+	points := make([]Point, len(coords)/2)
+	for i := range points {
+		points[i] = Point{coords[2*i], coords[2*i+1]}
+	}
+	return points, nil
+}
+
 // Dist computes the Euclidean distance between two points p and q.
 func (p Point) dist(q Point) float64 {
 	dx := p.X - q.X
@@ -29,8 +45,59 @@ func (p Point) dist(q Point) float64 {
 	return math.Sqrt(dx*dx + dy*dy)
 }
 
+// Add returns the vector sum p + q.
+func (p Point) Add(q Point) Point {
+	return Point{X: p.X + q.X, Y: p.Y + q.Y}
+}
+
+// Sub returns the vector difference p - q.
+func (p Point) Sub(q Point) Point {
+	return Point{X: p.X - q.X, Y: p.Y - q.Y}
+}
+
+// Scale returns p with each coordinate multiplied by f.
+func (p Point) Scale(f float64) Point {
+	return Point{X: p.X * f, Y: p.Y * f}
+}
+
+// Equal reports whether p and q differ by at most eps in every coordinate.
+func (p Point) Equal(q Point, eps float64) bool {
+	return math.Abs(p.X-q.X) <= eps && math.Abs(p.Y-q.Y) <= eps
+}
+
+// Snap returns p with each coordinate rounded to the nearest multiple of
+// cellSize, so that nearly coincident points snap to the same grid point.
+// Coordinates exactly halfway between two multiples round away from zero.  If
+// cellSize is not positive, p is returned unchanged.
+func (p Point) Snap(cellSize float64) Point {
+	if !(cellSize > 0) {
+		return p
+	}
+	return Point{
+		X: math.Round(p.X/cellSize) * cellSize,
+		Y: math.Round(p.Y/cellSize) * cellSize,
+	}
+}
+
+// Rotate returns p rotated counterclockwise by radians about the origin.
+//
+// Rotating a BBox by rotating its corners does not give its rotated bounds,
+// since an axis-aligned box is not axis-aligned once rotated; rotate all four
+// corners and take the bounding box of the results instead.
+func (p Point) Rotate(radians float64) Point {
+	sin, cos := math.Sincos(radians)
+	return Point{X: p.X*cos - p.Y*sin, Y: p.X*sin + p.Y*cos}
+}
+
+// RotateAbout returns p rotated counterclockwise by radians about center.
+func (p Point) RotateAbout(center Point, radians float64) Point {
+	return p.Sub(center).Rotate(radians).Add(center)
+}
+
 // minDist computes the square of the distance from a point to a bounding box.
 // If the point is contained in the bounding box then the distance is zero.
+// Pruning during searches compares these squared distances, avoiding square
+// roots; use DistToPoint for the true distance.
 //
 // Implemented per Definition 2 of "Nearest Neighbor Queries" by
 // N. Roussopoulos, S. Kelley and F. Vincent, ACM SIGMOD, pages 71-79, 1995.
@@ -55,6 +122,34 @@ func (p Point) minDist(bb *BBox) float64 {
 	return sum
 }
 
+// DistToPoint computes the Euclidean distance from bb to p, which is zero if
+// p is contained in bb.  Unlike minDist, the result is not squared.
+func (bb *BBox) DistToPoint(p Point) float64 {
+	return math.Sqrt(p.minDist(bb))
+}
+
+// DistToPointSquared computes the square of the Euclidean distance from bb to
+// p, which is cheaper than DistToPoint when only comparing distances.
+func (bb *BBox) DistToPointSquared(p Point) float64 {
+	return p.minDist(bb)
+}
+
+// BBoxDist computes the Euclidean distance between the closest points of a
+// and b, which is zero if they overlap or touch.
+func BBoxDist(a, b *BBox) float64 {
+	dx := math.Max(0, math.Max(a.min.X-b.max.X, b.min.X-a.max.X))
+	dy := math.Max(0, math.Max(a.min.Y-b.max.Y, b.min.Y-a.max.Y))
+	return math.Sqrt(dx*dx + dy*dy)
+}
+
+// maxDist computes the square of the greatest distance from p to any point of
+// bb, which is attained at the corner of bb farthest from p.
+func (p Point) maxDist(bb *BBox) float64 {
+	dx := math.Max(math.Abs(p.X-bb.min.X), math.Abs(p.X-bb.max.X))
+	dy := math.Max(math.Abs(p.Y-bb.min.Y), math.Abs(p.Y-bb.max.Y))
+	return dx*dx + dy*dy
+}
+
 // minMaxDist computes the minimum of the maximum distances from p to points
 // on r.  If r is the bounding box of some geometric objects, then there is
 // at least one object contained in r within minMaxDist(p, r) of p.
@@ -64,59 +159,59 @@ func (p Point) minDist(bb *BBox) float64 {
 func (p Point) minMaxDist(bb *BBox) float64 {
 	// by definition, MinMaxDist(p, r) =
 	// min{1<=k<=n}(|pk - rmk|^2 + sum{1<=i<=n, i != k}(|pi - rMi|^2))
-	// where rmk and rMk are defined as follows:
-
-	var rmx, rmy, rMx, rMy float64
-	if p.X <= (bb.min.X+bb.max.X)/2 {
-		rmx = bb.min.X
-	} else {
-		rmx = bb.max.X
-	}
-
-	if p.Y <= (bb.min.Y+bb.max.Y)/2 {
-		rmy = bb.min.Y
-	} else {
-		rmy = bb.max.Y
-	}
-
-	if p.X >= (bb.min.X+bb.max.X)/2 {
-		rMx = bb.min.X
-	} else {
-		rMx = bb.max.X
-	}
-
-	if p.Y >= (bb.min.Y+bb.max.Y)/2 {
-		rMy = bb.min.Y
-	} else {
-		rMy = bb.max.Y
-	}
-
-	// This formula can be computed in linear time by precomputing
+	// where rmk is the face of bb nearer to p in dimension k and rMk the farther.
+	// The formula can be computed in linear time by precomputing
 	// S = sum{1<=i<=n}(|pi - rMi|^2).
-
+	pc := [2]float64{p.X, p.Y}
+	lo := [2]float64{bb.min.X, bb.min.Y}
+	hi := [2]float64{bb.max.X, bb.max.Y}
+	var rm, rM [2]float64
 	s := 0.0
-	d := p.X - rMx
-	s += d * d
-	d = p.Y - rMy
-	s += d * d
-
-	// Compute MinMaxDist using the precomputed s for X.
-	d1 := p.X - rMx
-	d2 := p.X - rmx
-	d = s - d1*d1 + d2*d2
-	min := d
-
-	// and for Y
-	d1 = p.Y - rMy
-	d2 = p.Y - rmy
-	d = s - d1*d1 + d2*d2
-	if d < min {
-		min = d
+	for i := range pc {
+		mid := (lo[i] + hi[i]) / 2
+		if pc[i] <= mid {
+			rm[i] = lo[i]
+		} else {
+			rm[i] = hi[i]
+		}
+		if pc[i] >= mid {
+			rM[i] = lo[i]
+		} else {
+			rM[i] = hi[i]
+		}
+		d := pc[i] - rM[i]
+		s += d * d
 	}
 
+	min := math.MaxFloat64
+	for i := range pc {
+		dM, dm := pc[i]-rM[i], pc[i]-rm[i]
+		if d := s - dM*dM + dm*dm; d < min {
+			min = d
+		}
+	}
 	return min
 }
 
+// MinDist returns the square of the distance from p to the nearest point of
+// bb, which is zero if bb contains p.  No object stored below a node is
+// closer to p than the MinDist of the node's bounding box, so a search for
+// the nearest object can skip nodes whose MinDist exceeds the squared
+// distance of the best object found so far.
+func (p Point) MinDist(bb *BBox) float64 {
+	return p.minDist(bb)
+}
+
+// MinMaxDist returns the squared distance from p within which at least one
+// object bounded by bb must lie, since every side of a minimal bounding box
+// touches some object: if bb is the bounding box of a node, some object
+// below the node is at most that far from p.  A search for the nearest
+// object can skip nodes whose MinDist exceeds the least MinMaxDist of their
+// siblings.
+func (p Point) MinMaxDist(bb *BBox) float64 {
+	return p.minMaxDist(bb)
+}
+
 // BBox represents a subset of 2-dimensional Euclidean space of the form
 // min:[a1, b1] x max:[a2, b2], where a1 < a2 and b1 < b2
 type BBox struct {
@@ -127,7 +222,7 @@ func (bb *BBox) String() string {
 	return fmt.Sprintf("%sx%s", bb.min, bb.max)
 }
 
-func (p *Point) String() string {
+func (p Point) String() string {
 	return fmt.Sprintf("[%.2f, %.2f]", p.X, p.Y)
 }
 
@@ -148,36 +243,125 @@ func NewBBox(p Point, x, y float64) (*BBox, error) {
 	}, nil
 }
 
+// NewBBoxFromCorners constructs and returns a pointer to a BBox spanning the
+// two given corner points, which may be any two opposite corners in any
+// order.
+func NewBBoxFromCorners(a, b Point) *BBox {
+	return &BBox{
+		min: Point{X: math.Min(a.X, b.X), Y: math.Min(a.Y, b.Y)},
+		max: Point{X: math.Max(a.X, b.X), Y: math.Max(a.Y, b.Y)},
+	}
+}
+
+// NewBBoxAbs constructs and returns a pointer to a BBox with a corner at p
+// and lengths |x| and |y|.  Unlike with NewBBox, the signs of x and y may
+// give the direction in which the box extends from p: a negative length puts
+// p on the maximum side of the box in that dimension.
+func NewBBoxAbs(p Point, x, y float64) *BBox {
+	return NewBBoxFromCorners(p, Point{X: p.X + x, Y: p.Y + y})
+}
+
+// Equal reports whether the corners of bb and other differ by at most eps in
+// every coordinate.  A nil box equals only another nil box.
+func (bb *BBox) Equal(other *BBox, eps float64) bool {
+	if bb == nil || other == nil {
+		return bb == other
+	}
+	return bb.min.Equal(other.min, eps) && bb.max.Equal(other.max, eps)
+}
+
 // size computes the measure of a bounding box
 func (bb *BBox) size() float64 {
 	return (bb.max.X - bb.min.X) * (bb.max.Y - bb.min.Y)
 }
 
+// Area returns the measure of bb, which in two dimensions is its area.
+func (bb *BBox) Area() float64 {
+	return bb.size()
+}
+
+// Perimeter returns the sum of the lengths of the edges of bb.
+func (bb *BBox) Perimeter() float64 {
+	return bb.margin()
+}
+
 // margin computes the sum of the edge lengths of a bounding box.
 func (bb *BBox) margin() float64 {
 	return 2 * ((bb.max.X - bb.min.X) + (bb.max.Y - bb.min.Y))
 }
 
+// center returns the point at the center of bb.
+func (bb *BBox) center() Point {
+	return Point{X: (bb.min.X + bb.max.X) / 2, Y: (bb.min.Y + bb.max.Y) / 2}
+}
+
 // containsPoint tests whether p is located inside or on the boundary of bb.
 func (bb *BBox) containsPoint(p Point) bool {
 	return bb.min.X <= p.X && bb.max.X >= p.X && bb.min.Y <= p.Y && bb.max.Y >= p.Y
 }
 
+// In reports whether p is located inside or on the boundary of bb.
+func (p Point) In(bb *BBox) bool {
+	return bb.containsPoint(p)
+}
+
 // containsBBox tests whether bb2 is is located inside bb.
 func (bb *BBox) containsBBox(bb2 *BBox) bool {
 	return bb.min.X <= bb2.min.X && bb.max.X >= bb2.max.X && bb.min.Y <= bb2.min.Y && bb.max.Y >= bb2.max.Y
 }
 
-// intersect computes the intersection of two bounding boxes.  If no
-// intersection exists, the intersection is nil.
-func intersect(bb1, bb2 *BBox) *BBox {
-	if bb1.max.X <= bb2.min.X || bb2.max.X <= bb1.min.X || bb1.max.Y <= bb2.min.Y || bb2.max.Y < bb1.min.Y {
-		return nil
+// ContainsBBoxTol reports whether other lies inside bb, allowing other to
+// extend past each side of bb by up to eps.  It accepts boxes that are
+// contained in bb but for rounding error, such as bounds recomputed after a
+// transform.
+func (bb *BBox) ContainsBBoxTol(other *BBox, eps float64) bool {
+	return bb.min.X-eps <= other.min.X && other.max.X <= bb.max.X+eps &&
+		bb.min.Y-eps <= other.min.Y && other.max.Y <= bb.max.Y+eps
+}
+
+// enlargement computes how much the area of bb grows when it is enlarged to
+// include add.
+func enlargement(bb, add *BBox) float64 {
+	return boundingBox(bb, add).size() - bb.size()
+}
+
+// touches reports whether bb1 and bb2 share at least one point, including
+// points on their boundaries.
+func touches(bb1, bb2 *BBox) bool {
+	return bb1.min.X <= bb2.max.X && bb2.min.X <= bb1.max.X &&
+		bb1.min.Y <= bb2.max.Y && bb2.min.Y <= bb1.max.Y
+}
+
+// overlapArea computes the area of the intersection of two bounding boxes,
+// which is zero if they do not intersect.
+func overlapArea(bb1, bb2 *BBox) float64 {
+	dx := math.Min(bb1.max.X, bb2.max.X) - math.Max(bb1.min.X, bb2.min.X)
+	dy := math.Min(bb1.max.Y, bb2.max.Y) - math.Max(bb1.min.Y, bb2.min.Y)
+	if dx <= 0 || dy <= 0 {
+		return 0
 	}
-	return &BBox{
-		min: Point{X: math.Max(bb1.min.X, bb2.min.X), Y: math.Max(bb1.min.Y, bb2.min.Y)},
-		max: Point{X: math.Min(bb1.max.X, bb2.max.X), Y: math.Min(bb1.max.Y, bb2.max.Y)},
+	return dx * dy
+}
+
+// IntersectionArea returns the area of the region shared by bb and other, or
+// zero if they do not overlap.
+func (bb *BBox) IntersectionArea(other *BBox) float64 {
+	return overlapArea(bb, other)
+}
+
+// IoU returns the intersection over union of bb and other: the area they
+// share divided by the area they cover together.  The result ranges from 0
+// for disjoint boxes to 1 for identical ones.
+func (bb *BBox) IoU(other *BBox) float64 {
+	if bb.min == other.min && bb.max == other.max {
+		return 1
 	}
+	inter := overlapArea(bb, other)
+	union := bb.size() + other.size() - inter
+	if union <= 0 {
+		return 0
+	}
+	return inter / union
 }
 
 // ToBBox constructs a bounding box containing p with side lengths 2*tol.
@@ -188,22 +372,178 @@ func (p Point) ToBBox(tol float64) *BBox {
 	}
 }
 
+// Translate returns a new bounding box with both corners of bb shifted by
+// offset.
+func (bb *BBox) Translate(offset Point) *BBox {
+	return &BBox{min: bb.min.Add(offset), max: bb.max.Add(offset)}
+}
+
+// Expand returns a new bounding box grown by margin on every side.  A
+// negative margin shrinks the box instead; if a side would become shorter
+// than zero, it collapses onto the center of bb in that dimension.
+func (bb *BBox) Expand(margin float64) *BBox {
+	c := bb.center()
+	return &BBox{
+		min: Point{X: math.Min(bb.min.X-margin, c.X), Y: math.Min(bb.min.Y-margin, c.Y)},
+		max: Point{X: math.Max(bb.max.X+margin, c.X), Y: math.Max(bb.max.Y+margin, c.Y)},
+	}
+}
+
+// Clip returns the part of bb that lies within bounds or on its boundary, as
+// a new box.  It returns nil if bb lies entirely outside bounds or either box
+// is nil; a box that only touches bounds is clipped to the shared edge or
+// corner.
+func (bb *BBox) Clip(bounds *BBox) *BBox {
+	return Closed.Intersect(bb, bounds)
+}
+
+// Subtract returns the part of bb not covered by other, as up to four
+// disjoint boxes: slabs to the left and right of other spanning the full
+// height of bb, and slabs below and above other between them.  The result is
+// empty if other covers bb, and holds a copy of bb if other covers none of
+// its area.  Pieces with zero area are omitted unless bb itself has zero
+// area.
+func (bb *BBox) Subtract(other *BBox) []*BBox {
+	inter := Closed.Intersect(bb, other)
+	if inter == nil || (inter.size() == 0 && bb.size() > 0) {
+		// other covers none of the area of bb
+		return []*BBox{{bb.min, bb.max}}
+	}
+
+	pieces := []*BBox{}
+	add := func(min, max Point) {
+		piece := &BBox{min, max}
+		if piece.size() > 0 || bb.size() == 0 {
+			pieces = append(pieces, piece)
+		}
+	}
+	if inter.min.X > bb.min.X {
+		add(bb.min, Point{inter.min.X, bb.max.Y})
+	}
+	if inter.max.X < bb.max.X {
+		add(Point{inter.max.X, bb.min.Y}, bb.max)
+	}
+	if inter.min.Y > bb.min.Y {
+		add(Point{inter.min.X, bb.min.Y}, Point{inter.max.X, inter.min.Y})
+	}
+	if inter.max.Y < bb.max.Y {
+		add(Point{inter.min.X, inter.max.Y}, Point{inter.max.X, bb.max.Y})
+	}
+	return pieces
+}
+
+// Split divides bb into a grid of nx columns and ny rows of equal boxes,
+// returned row by row from the bottom, each from left to right.  Adjacent
+// boxes share their edges exactly, so they cover bb without gaps or overlaps.
+// It returns nil if nx or ny is less than 1.
+func (bb *BBox) Split(nx, ny int) []*BBox {
+	if nx < 1 || ny < 1 {
+		return nil
+	}
+	xs, ys := gridEdges(bb.min.X, bb.max.X, nx), gridEdges(bb.min.Y, bb.max.Y, ny)
+	cells := make([]*BBox, 0, nx*ny)
+	for j := 0; j < ny; j++ {
+		for i := 0; i < nx; i++ {
+			cells = append(cells, &BBox{
+				min: Point{X: xs[i], Y: ys[j]},
+				max: Point{X: xs[i+1], Y: ys[j+1]},
+			})
+		}
+	}
+	return cells
+}
+
+// gridEdges returns the n+1 edges of n equal intervals from lo to hi, with
+// the first and last exactly lo and hi.
+func gridEdges(lo, hi float64, n int) []float64 {
+	edges := make([]float64, n+1)
+	for i := range edges {
+		edges[i] = lo + (hi-lo)*float64(i)/float64(n)
+	}
+	edges[n] = hi
+	return edges
+}
+
 // boundingBox constructs the smallest bounding box containing both bb1 and bb2.
+// If either is nil, the other is returned.
 func boundingBox(bb1, bb2 *BBox) *BBox {
+	if bb1 == nil {
+		return bb2
+	}
+	if bb2 == nil {
+		return bb1
+	}
 	return &BBox{
 		min: Point{X: math.Min(bb1.min.X, bb2.min.X), Y: math.Min(bb1.min.Y, bb2.min.Y)},
 		max: Point{X: math.Max(bb1.max.X, bb2.max.X), Y: math.Max(bb1.max.Y, bb2.max.Y)},
 	}
 }
 
-// boundingBoxN constructs the smallest rectangle containing all of bbs...
+// boundingBoxN constructs the smallest rectangle containing all of bbs,
+// skipping nil boxes.  It returns nil if there are no non-nil boxes.
 func boundingBoxN(bbs ...*BBox) *BBox {
-	if len(bbs) == 1 {
-		return bbs[0]
-	}
-	bb := boundingBox(bbs[0], bbs[1])
-	for _, other := range bbs[2:] {
+	var bb *BBox
+	for _, other := range bbs {
 		bb = boundingBox(bb, other)
 	}
 	return bb
 }
+
+// ConvexHull returns the vertices of the convex hull of the corners of the
+// bounds of objs in counterclockwise order, starting from the vertex with the
+// least X coordinate, and the least Y coordinate among those.  Points lying
+// on an edge of the hull are not vertices, so collinear corners give just the
+// two ends of their line, and a single distinct corner gives just itself.  It
+// returns nil if objs is empty.
+//
+// Implemented per A. M. Andrew, "Another efficient algorithm for convex hulls
+// in two dimensions", Information Processing Letters 9(5), 216-219, 1979.
+func ConvexHull(objs []Spatial) []Point {
+	points := make([]Point, 0, 4*len(objs))
+	for _, obj := range objs {
+		bb := obj.Bounds()
+		points = append(points, bb.min, Point{bb.max.X, bb.min.Y}, bb.max, Point{bb.min.X, bb.max.Y})
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].X < points[j].X || (points[i].X == points[j].X && points[i].Y < points[j].Y)
+	})
+	unique := points[:1]
+	for _, p := range points[1:] {
+		if p != unique[len(unique)-1] {
+			unique = append(unique, p)
+		}
+	}
+	points = unique
+	if len(points) < 3 {
+		return points
+	}
+
+	// build the lower hull from left to right, then the upper hull back,
+	// dropping points that do not make a counterclockwise turn
+	hull := make([]Point, 0, 2*len(points))
+	for _, p := range points {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(points) - 2; i >= 0; i-- {
+		p := points[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	// the last point is the first again
+	return hull[:len(hull)-1]
+}
+
+// cross computes the z component of the cross product of a-o and b-o, which
+// is positive if o, a, b make a counterclockwise turn.
+func cross(o, a, b Point) float64 {
+	return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+}
@@ -0,0 +1,182 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"fmt"
+	"math"
+)
+
+// PointZ represents a point in 3-dimensional Euclidean space.
+type PointZ struct {
+	X, Y, Z float64
+}
+
+func (p PointZ) String() string {
+	return fmt.Sprintf("[%.2f, %.2f, %.2f]", p.X, p.Y, p.Z)
+}
+
+// dist computes the Euclidean distance between two points p and q.
+func (p PointZ) dist(q PointZ) float64 {
+	dx, dy, dz := p.X-q.X, p.Y-q.Y, p.Z-q.Z
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// minDist computes the square of the distance from a point to a bounding
+// box, which is zero if the point is contained in the box.
+func (p PointZ) minDist(bb *BBox3) float64 {
+	d := 0.0
+	for _, c := range [3][3]float64{
+		{p.X, bb.min.X, bb.max.X},
+		{p.Y, bb.min.Y, bb.max.Y},
+		{p.Z, bb.min.Z, bb.max.Z},
+	} {
+		if c[0] < c[1] {
+			d += (c[0] - c[1]) * (c[0] - c[1])
+		} else if c[0] > c[2] {
+			d += (c[0] - c[2]) * (c[0] - c[2])
+		}
+	}
+	return d
+}
+
+// ToBBox3 constructs a bounding box containing p with side lengths 2*tol.
+func (p PointZ) ToBBox3(tol float64) *BBox3 {
+	return &BBox3{
+		min: PointZ{p.X - tol, p.Y - tol, p.Z - tol},
+		max: PointZ{p.X + tol, p.Y + tol, p.Z + tol},
+	}
+}
+
+// BBox3 represents a subset of 3-dimensional Euclidean space of the form
+// [x1, x2] x [y1, y2] x [z1, z2].
+type BBox3 struct {
+	min, max PointZ
+}
+
+func (bb *BBox3) String() string {
+	return fmt.Sprintf("%sx%s", bb.min, bb.max)
+}
+
+// NewBBox3 constructs and returns a pointer to a BBox3 given its most
+// negative corner p and the non-negative lengths of its sides.
+func NewBBox3(p PointZ, x, y, z float64) (*BBox3, error) {
+	for _, d := range []float64{x, y, z} {
+		if d < 0 {
+			return nil, DistError(d)
+		}
+	}
+	return &BBox3{min: p, max: PointZ{p.X + x, p.Y + y, p.Z + z}}, nil
+}
+
+// size computes the volume of bb.
+func (bb *BBox3) size() float64 {
+	return (bb.max.X - bb.min.X) * (bb.max.Y - bb.min.Y) * (bb.max.Z - bb.min.Z)
+}
+
+// margin computes the sum of the edge lengths of bb.
+func (bb *BBox3) margin() float64 {
+	return 4 * ((bb.max.X - bb.min.X) + (bb.max.Y - bb.min.Y) + (bb.max.Z - bb.min.Z))
+}
+
+// containsPoint tests whether p is located inside or on the boundary of bb.
+func (bb *BBox3) containsPoint(p PointZ) bool {
+	return bb.min.X <= p.X && p.X <= bb.max.X &&
+		bb.min.Y <= p.Y && p.Y <= bb.max.Y &&
+		bb.min.Z <= p.Z && p.Z <= bb.max.Z
+}
+
+// containsBBox3 tests whether bb2 is located inside bb.
+func (bb *BBox3) containsBBox3(bb2 *BBox3) bool {
+	return bb.containsPoint(bb2.min) && bb.containsPoint(bb2.max)
+}
+
+// intersect3 computes the intersection of two bounding boxes, which include
+// their boundaries as for the Closed BoundaryMode, so boxes that touch
+// intersect in the boundary they share.  If no intersection exists or either
+// box is nil, the intersection is nil.
+func intersect3(bb1, bb2 *BBox3) *BBox3 {
+	if bb1 == nil || bb2 == nil || !touches3(bb1, bb2) {
+		return nil
+	}
+	return &BBox3{
+		min: PointZ{math.Max(bb1.min.X, bb2.min.X), math.Max(bb1.min.Y, bb2.min.Y), math.Max(bb1.min.Z, bb2.min.Z)},
+		max: PointZ{math.Min(bb1.max.X, bb2.max.X), math.Min(bb1.max.Y, bb2.max.Y), math.Min(bb1.max.Z, bb2.max.Z)},
+	}
+}
+
+// touches3 reports whether bb1 and bb2 share at least one point, including
+// points on their boundaries.
+func touches3(bb1, bb2 *BBox3) bool {
+	return bb1.min.X <= bb2.max.X && bb2.min.X <= bb1.max.X &&
+		bb1.min.Y <= bb2.max.Y && bb2.min.Y <= bb1.max.Y &&
+		bb1.min.Z <= bb2.max.Z && bb2.min.Z <= bb1.max.Z
+}
+
+// boundingBox3 constructs the smallest bounding box containing both bb1 and
+// bb2.  If either is nil, the other is returned.
+func boundingBox3(bb1, bb2 *BBox3) *BBox3 {
+	if bb1 == nil {
+		return bb2
+	}
+	if bb2 == nil {
+		return bb1
+	}
+	return &BBox3{
+		min: PointZ{math.Min(bb1.min.X, bb2.min.X), math.Min(bb1.min.Y, bb2.min.Y), math.Min(bb1.min.Z, bb2.min.Z)},
+		max: PointZ{math.Max(bb1.max.X, bb2.max.X), math.Max(bb1.max.Y, bb2.max.Y), math.Max(bb1.max.Z, bb2.max.Z)},
+	}
+}
+
+// enlargement3 computes how much the volume of bb grows when it is enlarged
+// to include add.
+func enlargement3(bb, add *BBox3) float64 {
+	return boundingBox3(bb, add).size() - bb.size()
+}
+
+// The methods below make *BBox3 an extent, for use in an Rtree3.
+
+func (bb *BBox3) union(other *BBox3) *BBox3 {
+	return boundingBox3(bb, other)
+}
+
+func (bb *BBox3) enlargement(add *BBox3) float64 {
+	return enlargement3(bb, add)
+}
+
+func (bb *BBox3) containsExtent(other *BBox3) bool {
+	return bb.containsBBox3(other)
+}
+
+func (bb *BBox3) touchesExtent(other *BBox3) bool {
+	return touches3(bb, other)
+}
+
+// BBox3T represents a region of the plane over a span of time, such as the
+// extent of a moving object while it is being tracked.  It is indexed in an
+// Rtree3 as the BBox3 whose third axis is time.
+type BBox3T struct {
+	Region *BBox
+	Time   Interval
+}
+
+func (bb BBox3T) String() string {
+	return fmt.Sprintf("%v during %v", bb.Region, bb.Time)
+}
+
+// BBox3 returns the 3-dimensional box spanned by bb, with Z standing for
+// time.
+func (bb BBox3T) BBox3() *BBox3 {
+	return &BBox3{
+		min: PointZ{bb.Region.min.X, bb.Region.min.Y, bb.Time.Lo},
+		max: PointZ{bb.Region.max.X, bb.Region.max.Y, bb.Time.Hi},
+	}
+}
+
+// Intersects reports whether bb and other overlap both in space and in time,
+// including at their boundaries, as for the Closed BoundaryMode.
+func (bb BBox3T) Intersects(other BBox3T) bool {
+	return intersect3(bb.BBox3(), other.BBox3()) != nil
+}
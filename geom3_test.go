@@ -0,0 +1,167 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"math"
+	"testing"
+)
+
+func mustBBox3(p PointZ, x, y, z float64) *BBox3 {
+	bb, err := NewBBox3(p, x, y, z)
+	if err != nil {
+		panic(err)
+	}
+	return bb
+}
+
+func TestDistZ(t *testing.T) {
+	p := PointZ{1, 2, 3}
+	q := PointZ{4, 6, 15}
+	if d := p.dist(q); d != 13 {
+		t.Errorf("Expected %v.dist(%v) == 13, got %v", p, q, d)
+	}
+}
+
+func TestNewBBox3(t *testing.T) {
+	p := PointZ{-2.5, 3.0, 1}
+	bb, err := NewBBox3(p, 8, 1.5, 2)
+	if err != nil {
+		t.Fatalf("NewBBox3 failed: %v", err)
+	}
+	if bb.min != p || bb.max != (PointZ{5.5, 4.5, 3}) {
+		t.Errorf("Expected %vx%v, got %v", p, PointZ{5.5, 4.5, 3}, bb)
+	}
+
+	_, err = NewBBox3(p, 8, 1.5, -2)
+	if d, ok := err.(DistError); !ok || float64(d) != -2 {
+		t.Errorf("Expected DistError(-2), got %v", err)
+	}
+}
+
+func TestBBox3SizeMargin(t *testing.T) {
+	bb := mustBBox3(PointZ{-2.5, 3.0, 1}, 8, 1.5, 2)
+	if s := bb.size(); s != 24 {
+		t.Errorf("Expected %v.size() == 24, got %v", bb, s)
+	}
+	if m := bb.margin(); m != 4*(8+1.5+2) {
+		t.Errorf("Expected %v.margin() == %v, got %v", bb, 4*(8+1.5+2), m)
+	}
+}
+
+func TestBBox3ContainsPoint(t *testing.T) {
+	bb := mustBBox3(PointZ{0, 0, 0}, 2, 2, 2)
+	tests := []struct {
+		p        PointZ
+		expected bool
+	}{
+		{PointZ{1, 1, 1}, true},
+		{PointZ{2, 0, 1}, true},
+		{PointZ{1, 1, 2.5}, false},
+		{PointZ{-0.1, 1, 1}, false},
+	}
+	for _, test := range tests {
+		if c := bb.containsPoint(test.p); c != test.expected {
+			t.Errorf("Expected %v.containsPoint(%v) == %v, got %v", bb, test.p, test.expected, c)
+		}
+	}
+
+	if !bb.containsBBox3(mustBBox3(PointZ{0.5, 0.5, 0.5}, 1, 1, 1.5)) {
+		t.Errorf("Expected %v to contain a nested box", bb)
+	}
+	if bb.containsBBox3(mustBBox3(PointZ{0.5, 0.5, 0.5}, 1, 1, 2)) {
+		t.Errorf("Expected %v not to contain a box sticking out along Z", bb)
+	}
+}
+
+func TestIntersect3(t *testing.T) {
+	bb := mustBBox3(PointZ{0, 0, 0}, 2, 2, 2)
+	tests := []struct {
+		other    *BBox3
+		expected *BBox3
+	}{
+		{mustBBox3(PointZ{1, 1, 1}, 2, 2, 2), mustBBox3(PointZ{1, 1, 1}, 1, 1, 1)},
+		{mustBBox3(PointZ{-1, 0.5, 1.5}, 4, 1, 1), mustBBox3(PointZ{0, 0.5, 1.5}, 2, 1, 0.5)},
+		{mustBBox3(PointZ{0, 0, 3}, 2, 2, 2), nil},
+		// touching faces share the face, and a point on a face is kept
+		{mustBBox3(PointZ{0, 0, 2}, 2, 2, 2), mustBBox3(PointZ{0, 0, 2}, 2, 2, 0)},
+		{PointZ{1, 1, 2}.ToBBox3(0), PointZ{1, 1, 2}.ToBBox3(0)},
+	}
+	for _, test := range tests {
+		got := intersect3(bb, test.other)
+		if (got == nil) != (test.expected == nil) ||
+			(got != nil && (got.min.dist(test.expected.min) > EPS || got.max.dist(test.expected.max) > EPS)) {
+			t.Errorf("Expected intersect3(%v, %v) == %v, got %v", bb, test.other, test.expected, got)
+		}
+	}
+	if intersect3(nil, bb) != nil || intersect3(bb, nil) != nil {
+		t.Errorf("Expected intersect3 with nil to be nil")
+	}
+}
+
+func TestBBox3T(t *testing.T) {
+	bb := BBox3T{mustBBox(Point{0, 0}, []float64{2, 2}), Interval{10, 20}}
+	bb3 := bb.BBox3()
+	if expected := mustBBox3(PointZ{0, 0, 10}, 2, 2, 10); bb3.min != expected.min || bb3.max != expected.max {
+		t.Errorf("Expected %v.BBox3() == %v, got %v", bb, expected, bb3)
+	}
+
+	tests := []struct {
+		other    BBox3T
+		expected bool
+	}{
+		{BBox3T{mustBBox(Point{1, 1}, []float64{2, 2}), Interval{15, 25}}, true},
+		{BBox3T{mustBBox(Point{1, 1}, []float64{2, 2}), Interval{0, 30}}, true},
+		// right place, wrong time
+		{BBox3T{mustBBox(Point{1, 1}, []float64{2, 2}), Interval{21, 30}}, false},
+		// right time, wrong place
+		{BBox3T{mustBBox(Point{5, 5}, []float64{2, 2}), Interval{12, 18}}, false},
+		// an instant inside the span
+		{BBox3T{Point{1, 1}.ToBBox(0), Interval{20, 20}}, true},
+		// spans that only meet share the instant they meet at
+		{BBox3T{mustBBox(Point{1, 1}, []float64{2, 2}), Interval{20, 30}}, true},
+	}
+	for _, test := range tests {
+		if actual := bb.Intersects(test.other); actual != test.expected {
+			t.Errorf("Expected %v.Intersects(%v) == %v, got %v", bb, test.other, test.expected, actual)
+		}
+		if actual := test.other.Intersects(bb); actual != test.expected {
+			t.Errorf("Expected %v.Intersects(%v) == %v, got %v", test.other, bb, test.expected, actual)
+		}
+	}
+}
+
+func TestBoundingBox3(t *testing.T) {
+	bb1 := mustBBox3(PointZ{0, 0, 0}, 1, 1, 1)
+	bb2 := mustBBox3(PointZ{2, -1, 0.5}, 1, 1, 3)
+	bb := boundingBox3(bb1, bb2)
+	if bb.min != (PointZ{0, -1, 0}) || bb.max != (PointZ{3, 1, 3.5}) {
+		t.Errorf("Expected [0, -1, 0]x[3, 1, 3.5], got %v", bb)
+	}
+	if boundingBox3(nil, bb1) != bb1 || boundingBox3(bb1, nil) != bb1 {
+		t.Errorf("Expected boundingBox3 with nil to return the other box")
+	}
+	if d := enlargement3(bb1, bb2); d != bb.size()-1 {
+		t.Errorf("Expected enlargement3 %v, got %v", bb.size()-1, d)
+	}
+}
+
+func TestMinDistZ(t *testing.T) {
+	bb := mustBBox3(PointZ{0, 0, 0}, 2, 2, 2)
+	tests := []struct {
+		p        PointZ
+		expected float64
+	}{
+		{PointZ{1, 1, 1}, 0},
+		{PointZ{1, 1, 5}, 9},
+		{PointZ{-1, 3, 1}, 2},
+		{PointZ{-1, -2, 4}, 9},
+	}
+	for _, test := range tests {
+		if d := test.p.minDist(bb); math.Abs(d-test.expected) > EPS {
+			t.Errorf("Expected %v.minDist(%v) == %v, got %v", test.p, bb, test.expected, d)
+		}
+	}
+}
@@ -6,6 +6,9 @@ package rtree
 
 import (
 	"math"
+	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -44,6 +47,17 @@ func TestNewBBoxDistError(t *testing.T) {
 	if _, ok := err.(DistError); !ok {
 		t.Errorf("Expected distError on NewBBox(%v, %v)", p, lengths)
 	}
+	if err == nil || !strings.Contains(err.Error(), "-8") {
+		t.Errorf("Expected error message to contain -8, got %v", err)
+	}
+
+	_, err = NewBBox(p, 1.5, -0.25)
+	if d, ok := err.(DistError); !ok || float64(d) != -0.25 {
+		t.Errorf("Expected DistError(-0.25), got %v", err)
+	}
+	if err == nil || err.Error() != "rtree: improper distance -0.25" {
+		t.Errorf("Expected message with the bad length, got %v", err)
+	}
 }
 
 func TestRectSize(t *testing.T) {
@@ -68,6 +82,28 @@ func TestRectMargin(t *testing.T) {
 	}
 }
 
+func TestRectArea(t *testing.T) {
+	p := Point{-2.5, 3.0}
+	lengths := []float64{8.0, 1.5}
+	rect, _ := NewBBox(p, lengths[0], lengths[1])
+	area := lengths[0] * lengths[1]
+	actual := rect.Area()
+	if area != actual {
+		t.Errorf("Expected %v.Area() == %v, got %v", rect, area, actual)
+	}
+}
+
+func TestRectPerimeter(t *testing.T) {
+	p := Point{-2.5, 3.0}
+	lengths := []float64{8.0, 1.5}
+	rect, _ := NewBBox(p, lengths[0], lengths[1])
+	perimeter := 2*8.0 + 2*1.5
+	actual := rect.Perimeter()
+	if perimeter != actual {
+		t.Errorf("Expected %v.Perimeter() == %v, got %v", rect, perimeter, actual)
+	}
+}
+
 func TestContainsPoint(t *testing.T) {
 	p := Point{-2.4, 0.0}
 	lengths := []float64{1.1, 4.9}
@@ -77,6 +113,9 @@ func TestContainsPoint(t *testing.T) {
 	if yes := rect.containsPoint(q); !yes {
 		t.Errorf("Expected %v contains %v", rect, q)
 	}
+	if yes := q.In(rect); !yes {
+		t.Errorf("Expected %v in %v", q, rect)
+	}
 }
 
 func TestDoesNotContainPoint(t *testing.T) {
@@ -88,6 +127,39 @@ func TestDoesNotContainPoint(t *testing.T) {
 	if yes := rect.containsPoint(q); yes {
 		t.Errorf("Expected %v doesn't contain %v", rect, q)
 	}
+	if yes := q.In(rect); yes {
+		t.Errorf("Expected %v not in %v", q, rect)
+	}
+}
+
+func TestPointIn(t *testing.T) {
+	rect := mustBBox(Point{0, 0}, []float64{2, 1})
+	tests := []struct {
+		p        Point
+		expected bool
+	}{
+		{Point{1, 0.5}, true},
+		{Point{0, 0}, true},
+		{Point{2, 1}, true},
+		{Point{2, 0.5}, true},
+		{Point{1, 0}, true},
+		{Point{2.01, 0.5}, false},
+		{Point{1, -0.01}, false},
+		{Point{-1, 2}, false},
+	}
+	for _, test := range tests {
+		if actual := test.p.In(rect); actual != test.expected {
+			t.Errorf("Expected %v.In(%v) == %v, got %v", test.p, rect, test.expected, actual)
+		}
+		if actual := rect.containsPoint(test.p); actual != test.p.In(rect) {
+			t.Errorf("Expected containsPoint to agree with In for %v", test.p)
+		}
+	}
+
+	p := Point{3, 4}
+	if !p.In(p.ToBBox(0)) {
+		t.Errorf("Expected %v to be in its own degenerate box", p)
+	}
 }
 
 func TestContainsBBox(t *testing.T) {
@@ -104,6 +176,38 @@ func TestContainsBBox(t *testing.T) {
 	}
 }
 
+func TestContainsBBoxTol(t *testing.T) {
+	bb := mustBBox(Point{0, 0}, []float64{4, 4})
+	tests := []struct {
+		other    *BBox
+		eps      float64
+		expected bool
+	}{
+		{mustBBox(Point{1, 1}, []float64{2, 2}), 0, true},
+		{mustBBox(Point{0, 0}, []float64{4, 4}), 0, true},
+		// exceeding each side by exactly eps is allowed
+		{mustBBox(Point{-0.5, 1}, []float64{1, 1}), 0.5, true},
+		{mustBBox(Point{3, 1}, []float64{1.5, 1}), 0.5, true},
+		{mustBBox(Point{1, -0.5}, []float64{1, 1}), 0.5, true},
+		{mustBBox(Point{1, 3}, []float64{1, 1.5}), 0.5, true},
+		{mustBBox(Point{-0.5, -0.5}, []float64{5, 5}), 0.5, true},
+		// but not by more
+		{mustBBox(Point{-0.75, 1}, []float64{1, 1}), 0.5, false},
+		{mustBBox(Point{3, 1}, []float64{1.75, 1}), 0.5, false},
+		{mustBBox(Point{1, -0.75}, []float64{1, 1}), 0.5, false},
+		{mustBBox(Point{1, 3}, []float64{1, 1.75}), 0.5, false},
+		{mustBBox(Point{-0.5, 1}, []float64{1, 1}), 0, false},
+		// jitter from recomputed bounds
+		{mustBBox(Point{-1e-12, 0}, []float64{4 + 2e-12, 4}), EPS, true},
+		{mustBBox(Point{10, 10}, []float64{1, 1}), 0.5, false},
+	}
+	for _, test := range tests {
+		if actual := bb.ContainsBBoxTol(test.other, test.eps); actual != test.expected {
+			t.Errorf("Expected %v.ContainsBBoxTol(%v, %v) == %v, got %v", bb, test.other, test.eps, test.expected, actual)
+		}
+	}
+}
+
 func TestDoesNotContainRectOverlaps(t *testing.T) {
 	p := Point{-2.4, 0.0}
 	lengths1 := []float64{1.1, 4.9}
@@ -143,8 +247,8 @@ func TestNoIntersection(t *testing.T) {
 
 	// rect1 and rect2 fail to overlap in just one dimension (second)
 
-	if intersect := intersect(rect1, rect2); intersect != nil {
-		t.Errorf("Expected intersect(%v, %v) == nil, got %v", rect1, rect2, intersect)
+	if intersect := Closed.Intersect(rect1, rect2); intersect != nil {
+		t.Errorf("Expected Closed.Intersect(%v, %v) == nil, got %v", rect1, rect2, intersect)
 	}
 }
 
@@ -157,10 +261,15 @@ func TestNoIntersectionJustTouches(t *testing.T) {
 	lengths2 := []float64{4, 6.5}
 	rect2, _ := NewBBox(q, lengths2[0], lengths2[1])
 
-	// rect1 and rect2 fail to overlap in just one dimension (second)
+	// rect1 and rect2 only touch along the line x = 2, which closed boxes
+	// share but half-open and open ones do not
 
-	if intersect := intersect(rect1, rect2); intersect != nil {
-		t.Errorf("Expected intersect(%v, %v) == nil, got %v", rect1, rect2, intersect)
+	if intersect := HalfOpen.Intersect(rect1, rect2); intersect != nil {
+		t.Errorf("Expected HalfOpen.Intersect(%v, %v) == nil, got %v", rect1, rect2, intersect)
+	}
+	edge := NewBBoxFromCorners(Point{2, 3}, Point{2, 3.5})
+	if intersect := Closed.Intersect(rect1, rect2); !intersect.Equal(edge, EPS) {
+		t.Errorf("Expected Closed.Intersect(%v, %v) == %v, got %v", rect1, rect2, edge, intersect)
 	}
 }
 
@@ -176,11 +285,11 @@ func TestContainmentIntersection(t *testing.T) {
 	r := Point{2.2, 3.3}
 	s := Point{2.7, 3.8}
 
-	actual := intersect(rect1, rect2)
+	actual := Closed.Intersect(rect1, rect2)
 	d1 := r.dist(actual.min)
 	d2 := s.dist(actual.max)
 	if d1 > EPS || d2 > EPS {
-		t.Errorf("intersect(%v, %v) != %v, %v, got %v", rect1, rect2, r, s, actual)
+		t.Errorf("Closed.Intersect(%v, %v) != %v, %v, got %v", rect1, rect2, r, s, actual)
 	}
 }
 
@@ -196,11 +305,11 @@ func TestOverlapIntersection(t *testing.T) {
 	r := Point{4, 3}
 	s := Point{4.5, 3.5}
 
-	actual := intersect(rect1, rect2)
+	actual := Closed.Intersect(rect1, rect2)
 	d1 := r.dist(actual.min)
 	d2 := s.dist(actual.max)
 	if d1 > EPS || d2 > EPS {
-		t.Errorf("intersect(%v, %v) != %v, %v, got %v", rect1, rect2, r, s, actual)
+		t.Errorf("Closed.Intersect(%v, %v) != %v, %v, got %v", rect1, rect2, r, s, actual)
 	}
 }
 
@@ -269,6 +378,98 @@ func TestBoundingBoxN(t *testing.T) {
 	}
 }
 
+func TestIntersectDegenerate(t *testing.T) {
+	rect := mustBBox(Point{0, 0}, []float64{2, 2})
+	tests := []struct {
+		bb       *BBox
+		expected bool
+	}{
+		{Point{1, 1}.ToBBox(0), true},
+		{Point{2, 1}.ToBBox(0), true},
+		{Point{0, 0}.ToBBox(0), true},
+		{Point{2.5, 1}.ToBBox(0), false},
+		{NewBBoxFromCorners(Point{2, -1}, Point{2, 3}), true},
+		{NewBBoxFromCorners(Point{-1, 1}, Point{3, 1}), true},
+		{NewBBoxFromCorners(Point{3, -1}, Point{3, 3}), false},
+		// closed boxes that touch share their common edge
+		{mustBBox(Point{2, 0}, []float64{1, 2}), true},
+		{mustBBox(Point{0, 2}, []float64{2, 1}), true},
+		{mustBBox(Point{2.5, 0}, []float64{1, 2}), false},
+	}
+	for _, test := range tests {
+		if bb := Closed.Intersect(rect, test.bb); (bb != nil) != test.expected {
+			t.Errorf("Expected Closed.Intersect(%v, %v) != nil to be %v, got %v", rect, test.bb, test.expected, bb)
+		}
+		if bb := Closed.Intersect(test.bb, rect); (bb != nil) != test.expected {
+			t.Errorf("Expected Closed.Intersect(%v, %v) != nil to be %v, got %v", test.bb, rect, test.expected, bb)
+		}
+	}
+
+	p := Point{1, 1}.ToBBox(0)
+	if bb := Closed.Intersect(p, p); bb == nil || bb.size() != 0 {
+		t.Errorf("Expected a point box to intersect itself, got %v", bb)
+	}
+}
+
+func TestEnlargement(t *testing.T) {
+	bb := mustBBox(Point{0, 0}, []float64{2, 2})
+	tests := []struct {
+		add      *BBox
+		expected float64
+	}{
+		// nested boxes need no enlargement
+		{mustBBox(Point{0.5, 0.5}, []float64{1, 1}), 0},
+		{bb, 0},
+		// disjoint: [0, 0]x[4, 3] minus the original area
+		{mustBBox(Point{3, 2}, []float64{1, 1}), 8},
+		// partially overlapping: [0, 0]x[3, 2] minus the original area
+		{mustBBox(Point{1, 0.5}, []float64{2, 1}), 2},
+	}
+	for _, test := range tests {
+		if d := enlargement(bb, test.add); math.Abs(d-test.expected) > EPS {
+			t.Errorf("Expected enlargement(%v, %v) == %v, got %v", bb, test.add, test.expected, d)
+		}
+	}
+}
+
+func TestNilBBoxes(t *testing.T) {
+	rect, _ := NewBBox(Point{0, 0}, 1, 1)
+	rect2, _ := NewBBox(Point{2, 0}, 1, 1)
+
+	if bb := Closed.Intersect(nil, rect); bb != nil {
+		t.Errorf("Closed.Intersect(nil, %v) == %v, expected nil", rect, bb)
+	}
+	if bb := Closed.Intersect(rect, nil); bb != nil {
+		t.Errorf("Closed.Intersect(%v, nil) == %v, expected nil", rect, bb)
+	}
+	if bb := Closed.Intersect(nil, nil); bb != nil {
+		t.Errorf("Closed.Intersect(nil, nil) == %v, expected nil", bb)
+	}
+
+	if bb := boundingBox(nil, rect); bb != rect {
+		t.Errorf("boundingBox(nil, %v) == %v, expected %v", rect, bb, rect)
+	}
+	if bb := boundingBox(rect, nil); bb != rect {
+		t.Errorf("boundingBox(%v, nil) == %v, expected %v", rect, bb, rect)
+	}
+	if bb := boundingBox(nil, nil); bb != nil {
+		t.Errorf("boundingBox(nil, nil) == %v, expected nil", bb)
+	}
+
+	exp, _ := NewBBox(Point{0, 0}, 3, 1)
+	for _, bbs := range [][]*BBox{{nil, rect, rect2}, {rect, nil, rect2}, {rect, rect2, nil}} {
+		if bb := boundingBoxN(bbs...); !bb.Equal(exp, EPS) {
+			t.Errorf("boundingBoxN(%v) == %v, expected %v", bbs, bb, exp)
+		}
+	}
+	if bb := boundingBoxN(nil, nil); bb != nil {
+		t.Errorf("boundingBoxN(nil, nil) == %v, expected nil", bb)
+	}
+	if bb := boundingBoxN(); bb != nil {
+		t.Errorf("boundingBoxN() == %v, expected nil", bb)
+	}
+}
+
 func TestMinDistZero(t *testing.T) {
 	p := Point{2, 3}
 	r := p.ToBBox(1)
@@ -305,3 +506,677 @@ func TestMinMaxdist(t *testing.T) {
 		t.Errorf("Expected %v.minMaxDist(%v) == %v, got %v", p, r, expected, d)
 	}
 }
+
+func TestMinMaxDistAxes(t *testing.T) {
+	tests := []struct {
+		p        Point
+		bb       *BBox
+		expected float64
+	}{
+		// wide box: the nearest face is along X, at (0, 1)
+		{Point{-1, 0.2}, &BBox{Point{0, 0}, Point{10, 1}}, 1.64},
+		// tall box: the nearest face is along Y, at (1, 0)
+		{Point{0.2, -1}, &BBox{Point{0, 0}, Point{1, 10}}, 1.64},
+		// square box: both faces give the same distance
+		{Point{-1, -1}, &BBox{Point{0, 0}, Point{2, 2}}, 10},
+	}
+	for _, test := range tests {
+		if d := test.p.minMaxDist(test.bb); math.Abs(d-test.expected) > EPS {
+			t.Errorf("Expected %v.minMaxDist(%v) == %v, got %v", test.p, test.bb, test.expected, d)
+		}
+	}
+}
+
+func TestMinDistExported(t *testing.T) {
+	p := Point{2, 3}
+	if d := p.MinDist(p.ToBBox(1)); d > EPS {
+		t.Errorf("Expected %v.MinDist(%v) == 0, got %v", p, p.ToBBox(1), d)
+	}
+	r := &BBox{Point{-4, 7}, Point{-2, 9}}
+	if d, expected := p.MinDist(r), 32.0; math.Abs(d-expected) > EPS {
+		t.Errorf("Expected %v.MinDist(%v) == %v, got %v", p, r, expected, d)
+	}
+
+	tests := []struct {
+		p        Point
+		bb       *BBox
+		expected float64
+	}{
+		{Point{-2, -1}, &BBox{Point{0, 0}, Point{2, 3}}, 17},
+		{Point{-1, 0.2}, &BBox{Point{0, 0}, Point{10, 1}}, 1.64},
+		{Point{0.2, -1}, &BBox{Point{0, 0}, Point{1, 10}}, 1.64},
+		{Point{-1, -1}, &BBox{Point{0, 0}, Point{2, 2}}, 10},
+	}
+	for _, test := range tests {
+		if d := test.p.MinMaxDist(test.bb); math.Abs(d-test.expected) > EPS {
+			t.Errorf("Expected %v.MinMaxDist(%v) == %v, got %v", test.p, test.bb, test.expected, d)
+		}
+		// the bounds are ordered, and squared
+		if min, minMax, max := test.p.MinDist(test.bb), test.p.MinMaxDist(test.bb), test.p.maxDist(test.bb); min > minMax || minMax > max {
+			t.Errorf("Expected MinDist <= MinMaxDist <= maxDist for %v and %v, got %v, %v, %v", test.p, test.bb, min, minMax, max)
+		}
+		if d := test.bb.DistToPoint(test.p); math.Abs(d*d-test.p.MinDist(test.bb)) > EPS {
+			t.Errorf("Expected %v.MinDist(%v) == %v squared, got %v", test.p, test.bb, d, test.p.MinDist(test.bb))
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	bb, _ := NewBBox(Point{1, 2}, 4, 2)
+
+	tests := []struct {
+		margin   float64
+		min, max Point
+	}{
+		{0.5, Point{0.5, 1.5}, Point{5.5, 4.5}},
+		{0, Point{1, 2}, Point{5, 4}},
+		{-0.5, Point{1.5, 2.5}, Point{4.5, 3.5}},
+		{-1.5, Point{2.5, 3}, Point{3.5, 3}},
+		{-10, Point{3, 3}, Point{3, 3}},
+	}
+	for _, test := range tests {
+		actual := bb.Expand(test.margin)
+		if test.min.dist(actual.min) > EPS || test.max.dist(actual.max) > EPS {
+			t.Errorf("Expected %v.Expand(%v) == %v, %v, got %v", bb, test.margin, test.min, test.max, actual)
+		}
+	}
+
+	if bb.min.dist(Point{1, 2}) > EPS || bb.max.dist(Point{5, 4}) > EPS {
+		t.Errorf("Expected Expand not to modify %v", bb)
+	}
+}
+
+func TestDistToPoint(t *testing.T) {
+	bb := &BBox{Point{0, 0}, Point{2, 3}}
+
+	tests := []struct {
+		p        Point
+		expected float64
+	}{
+		{Point{1, 1}, 0},
+		{Point{2, 3}, 0},
+		{Point{5, 1}, 3},
+		{Point{1, -4}, 4},
+		{Point{5, 7}, 5},
+		{Point{-3, -4}, 5},
+	}
+	for _, test := range tests {
+		if d := bb.DistToPoint(test.p); math.Abs(d-test.expected) > EPS {
+			t.Errorf("Expected %v.DistToPoint(%v) == %v, got %v", bb, test.p, test.expected, d)
+		}
+		if d := bb.DistToPointSquared(test.p); math.Abs(d-test.expected*test.expected) > EPS {
+			t.Errorf("Expected %v.DistToPointSquared(%v) == %v, got %v", bb, test.p, test.expected*test.expected, d)
+		}
+	}
+}
+
+func TestMinDistSquared(t *testing.T) {
+	r := rand.New(rand.NewSource(109))
+	for _, obj := range randomBBoxes(r, 200) {
+		bb := obj.Bounds()
+		p := Point{r.Float64()*1200 - 600, r.Float64()*1200 - 600}
+		if d, sq := bb.DistToPoint(p), p.minDist(bb); math.Abs(math.Sqrt(sq)-d) > EPS {
+			t.Errorf("Expected sqrt(%v.minDist(%v)) == %v, got %v", p, bb, d, math.Sqrt(sq))
+		}
+		if sq := bb.DistToPointSquared(p); sq != p.minDist(bb) {
+			t.Errorf("Expected %v.DistToPointSquared(%v) == %v, got %v", bb, p, p.minDist(bb), sq)
+		}
+	}
+}
+
+func TestNewBBoxFromCorners(t *testing.T) {
+	min, max := Point{-2.5, 3.0}, Point{5.5, 4.5}
+	corners := [][2]Point{
+		{min, max},
+		{max, min},
+		{Point{min.X, max.Y}, Point{max.X, min.Y}},
+		{Point{max.X, min.Y}, Point{min.X, max.Y}},
+	}
+	for _, c := range corners {
+		bb := NewBBoxFromCorners(c[0], c[1])
+		if min.dist(bb.min) > EPS || max.dist(bb.max) > EPS {
+			t.Errorf("Expected NewBBoxFromCorners(%v, %v) == %v, %v, got %v", c[0], c[1], min, max, bb)
+		}
+	}
+}
+
+func TestNewBBoxAbs(t *testing.T) {
+	p := Point{1, 2}
+	tests := []struct {
+		x, y     float64
+		min, max Point
+	}{
+		{3, 4, Point{1, 2}, Point{4, 6}},
+		{-3, 4, Point{-2, 2}, Point{1, 6}},
+		{3, -4, Point{1, -2}, Point{4, 2}},
+		{-3, -4, Point{-2, -2}, Point{1, 2}},
+		{0, -1.5, Point{1, 0.5}, Point{1, 2}},
+	}
+	for _, test := range tests {
+		bb := NewBBoxAbs(p, test.x, test.y)
+		if test.min.dist(bb.min) > EPS || test.max.dist(bb.max) > EPS {
+			t.Errorf("Expected NewBBoxAbs(%v, %v, %v) == %v, %v, got %v", p, test.x, test.y, test.min, test.max, bb)
+		}
+		if expected := math.Abs(test.x * test.y); math.Abs(bb.Area()-expected) > EPS {
+			t.Errorf("Expected NewBBoxAbs(%v, %v, %v) to have area %v, got %v", p, test.x, test.y, expected, bb.Area())
+		}
+	}
+}
+
+func TestIoU(t *testing.T) {
+	bb := mustBBox(Point{0, 0}, []float64{2, 2})
+	tests := []struct {
+		other      *BBox
+		area, want float64
+	}{
+		{mustBBox(Point{0, 0}, []float64{2, 2}), 4, 1},
+		{mustBBox(Point{1, 0}, []float64{2, 2}), 2, 2.0 / 6.0},
+		{mustBBox(Point{0.5, 0.5}, []float64{1, 1}), 1, 0.25},
+		{mustBBox(Point{3, 3}, []float64{1, 1}), 0, 0},
+		{mustBBox(Point{2, 0}, []float64{1, 2}), 0, 0},
+	}
+	for _, test := range tests {
+		if a := bb.IntersectionArea(test.other); math.Abs(a-test.area) > EPS {
+			t.Errorf("Expected %v.IntersectionArea(%v) == %v, got %v", bb, test.other, test.area, a)
+		}
+		if r := bb.IoU(test.other); math.Abs(r-test.want) > EPS {
+			t.Errorf("Expected %v.IoU(%v) == %v, got %v", bb, test.other, test.want, r)
+		}
+		if r := test.other.IoU(bb); math.Abs(r-test.want) > EPS {
+			t.Errorf("Expected %v.IoU(%v) == %v, got %v", test.other, bb, test.want, r)
+		}
+	}
+
+	p := Point{1, 1}.ToBBox(0)
+	if r := p.IoU(p); r != 1 {
+		t.Errorf("Expected identical degenerate boxes to have IoU 1, got %v", r)
+	}
+}
+
+func TestPointEqual(t *testing.T) {
+	p := Point{1, 2}
+	tests := []struct {
+		q        Point
+		eps      float64
+		expected bool
+	}{
+		{Point{1, 2}, 0, true},
+		{Point{1.5, 2}, 0.5, true},
+		{Point{1, 1.5}, 0.5, true},
+		{Point{1.25, 2.25}, 0.5, true},
+		{Point{1.5, 2}, 0.25, false},
+		{Point{1, 2.75}, 0.5, false},
+		{Point{1 + 0.5 + 1e-9, 2}, 0.5, false},
+	}
+	for _, test := range tests {
+		if eq := p.Equal(test.q, test.eps); eq != test.expected {
+			t.Errorf("Expected %v.Equal(%v, %v) == %v, got %v", p, test.q, test.eps, test.expected, eq)
+		}
+		if eq := test.q.Equal(p, test.eps); eq != test.expected {
+			t.Errorf("Expected %v.Equal(%v, %v) == %v, got %v", test.q, p, test.eps, test.expected, eq)
+		}
+	}
+}
+
+func TestBBoxEqual(t *testing.T) {
+	bb := mustBBox(Point{0, 0}, []float64{2, 1})
+	var null *BBox
+	tests := []struct {
+		a, b     *BBox
+		expected bool
+	}{
+		{bb, bb, true},
+		{bb, mustBBox(Point{0, 0}, []float64{2, 1}), true},
+		{bb, mustBBox(Point{0.0005, 0}, []float64{2, 1}), true},
+		{bb, mustBBox(Point{0, 0}, []float64{2, 1.01}), false},
+		{bb, mustBBox(Point{-0.01, 0}, []float64{2.01, 1}), false},
+		{null, null, true},
+		{bb, null, false},
+		{null, bb, false},
+	}
+	for _, test := range tests {
+		if eq := test.a.Equal(test.b, 0.001); eq != test.expected {
+			t.Errorf("Expected %v.Equal(%v) == %v, got %v", test.a, test.b, test.expected, eq)
+		}
+	}
+}
+
+func TestPointsFromFlat(t *testing.T) {
+	tests := []struct {
+		coords   []float64
+		expected []Point
+	}{
+		{nil, []Point{}},
+		{[]float64{}, []Point{}},
+		{[]float64{1, 2}, []Point{{1, 2}}},
+		{[]float64{1, 2, -3.5, 4, 0, 0}, []Point{{1, 2}, {-3.5, 4}, {0, 0}}},
+	}
+	for _, test := range tests {
+		points, err := PointsFromFlat(test.coords)
+		if err != nil {
+			t.Errorf("PointsFromFlat(%v): unexpected error %v", test.coords, err)
+		}
+		if !reflect.DeepEqual(points, test.expected) {
+			t.Errorf("Expected PointsFromFlat(%v) == %v, got %v", test.coords, test.expected, points)
+		}
+	}
+
+	for _, coords := range [][]float64{{1}, {1, 2, 3}} {
+		points, err := PointsFromFlat(coords)
+		if err == nil || points != nil {
+			t.Errorf("Expected an error for %v, got %v", coords, points)
+		} else if !strings.Contains(err.Error(), "odd") {
+			t.Errorf("Expected an error about odd length, got %v", err)
+		}
+	}
+}
+
+func TestPointArithmetic(t *testing.T) {
+	p, q := Point{1, -2}, Point{0.5, 4}
+
+	if r := p.Add(q); r != (Point{1.5, 2}) {
+		t.Errorf("Expected %v.Add(%v) == [1.5, 2], got %v", p, q, r)
+	}
+	if r := p.Sub(q); r != (Point{0.5, -6}) {
+		t.Errorf("Expected %v.Sub(%v) == [0.5, -6], got %v", p, q, r)
+	}
+	if r := p.Scale(-3); r != (Point{-3, 6}) {
+		t.Errorf("Expected %v.Scale(-3) == [-3, 6], got %v", p, r)
+	}
+	if r := p.Add(q).Sub(q); r != p {
+		t.Errorf("Expected Add and Sub to cancel, got %v", r)
+	}
+
+	if p != (Point{1, -2}) || q != (Point{0.5, 4}) {
+		t.Errorf("Expected operands to be unchanged, got %v and %v", p, q)
+	}
+}
+
+func TestBBoxDist(t *testing.T) {
+	a := mustBBox(Point{0, 0}, []float64{2, 2})
+	tests := []struct {
+		name     string
+		b        *BBox
+		expected float64
+	}{
+		{"overlapping", mustBBox(Point{1, 1}, []float64{2, 2}), 0},
+		{"containing", mustBBox(Point{-1, -1}, []float64{5, 5}), 0},
+		{"touching", mustBBox(Point{2, 2}, []float64{1, 1}), 0},
+		{"gap right", mustBBox(Point{5, 0.5}, []float64{1, 1}), 3},
+		{"gap below", mustBBox(Point{-3, -4}, []float64{10, 1.5}), 2.5},
+		{"diagonal", mustBBox(Point{5, 6}, []float64{1, 1}), 5},
+		{"diagonal point", Point{-3, -4}.ToBBox(0), 5},
+	}
+	for _, test := range tests {
+		if d := BBoxDist(a, test.b); math.Abs(d-test.expected) > EPS {
+			t.Errorf("%s: expected BBoxDist(%v, %v) == %v, got %v", test.name, a, test.b, test.expected, d)
+		}
+		if d := BBoxDist(test.b, a); math.Abs(d-test.expected) > EPS {
+			t.Errorf("%s: expected BBoxDist(%v, %v) == %v, got %v", test.name, test.b, a, test.expected, d)
+		}
+	}
+
+	// for a degenerate box, the distance is that from its point
+	p := Point{7, -1}
+	if d := BBoxDist(a, p.ToBBox(0)); math.Abs(d-a.DistToPoint(p)) > EPS {
+		t.Errorf("expected BBoxDist to match DistToPoint, got %v and %v", d, a.DistToPoint(p))
+	}
+}
+
+func TestMaxDist(t *testing.T) {
+	bb := mustBBox(Point{1, 2}, []float64{4, 2})
+	tests := []struct {
+		p        Point
+		expected float64
+	}{
+		{Point{0, 0}, 5*5 + 4*4},
+		{Point{3, 3}, 2*2 + 1*1},
+		{Point{6, 5}, 5*5 + 3*3},
+		{Point{2, 10}, 3*3 + 8*8},
+	}
+	for _, test := range tests {
+		if actual := test.p.maxDist(bb); math.Abs(actual-test.expected) > EPS {
+			t.Errorf("Expected %v.maxDist(%v) == %v, got %v", test.p, bb, test.expected, actual)
+		}
+	}
+}
+
+func TestPointSnap(t *testing.T) {
+	tests := []struct {
+		p        Point
+		cellSize float64
+		expected Point
+	}{
+		{Point{1.2, -1.2}, 1, Point{1, -1}},
+		{Point{1.7, -1.7}, 1, Point{2, -2}},
+		// halfway points round away from zero
+		{Point{0.5, -0.5}, 1, Point{1, -1}},
+		{Point{2.5, -2.5}, 1, Point{3, -3}},
+		{Point{0.25, -0.75}, 0.5, Point{0.5, -1}},
+		{Point{149, 151}, 100, Point{100, 200}},
+		{Point{150, -250}, 100, Point{200, -300}},
+		{Point{1.23456e-6, 9.8761e-6}, 1e-6, Point{1e-6, 10e-6}},
+		{Point{123456789, -987654321}, 1e6, Point{123e6, -988e6}},
+		{Point{3.7, -3.7}, 0, Point{3.7, -3.7}},
+		{Point{3.7, -3.7}, -1, Point{3.7, -3.7}},
+	}
+	for _, test := range tests {
+		if actual := test.p.Snap(test.cellSize); !actual.Equal(test.expected, math.Abs(test.cellSize)*EPS) {
+			t.Errorf("Expected %v.Snap(%v) == %v, got %v", test.p, test.cellSize, test.expected, actual)
+		}
+	}
+
+	// near-duplicates collapse onto the same point
+	p, q := Point{10.0001, 20.0004}, Point{9.9998, 19.9997}
+	if p.Snap(0.01) != q.Snap(0.01) {
+		t.Errorf("Expected %v and %v to snap together, got %v and %v", p, q, p.Snap(0.01), q.Snap(0.01))
+	}
+}
+
+func TestPointRotate(t *testing.T) {
+	tests := []struct {
+		p        Point
+		radians  float64
+		expected Point
+	}{
+		{Point{1, 0}, math.Pi / 2, Point{0, 1}},
+		{Point{1, 0}, math.Pi, Point{-1, 0}},
+		{Point{0, 1}, math.Pi / 2, Point{-1, 0}},
+		{Point{0, 1}, math.Pi, Point{0, -1}},
+		{Point{1, 0}, -math.Pi / 2, Point{0, -1}},
+		{Point{3, 4}, 2 * math.Pi, Point{3, 4}},
+		{Point{1, 1}, math.Pi / 4, Point{0, math.Sqrt2}},
+		{Point{0, 0}, 1, Point{0, 0}},
+	}
+	for _, test := range tests {
+		if actual := test.p.Rotate(test.radians); !actual.Equal(test.expected, EPS) {
+			t.Errorf("Expected %v.Rotate(%v) == %v, got %v", test.p, test.radians, test.expected, actual)
+		}
+	}
+}
+
+func TestPointRotateAbout(t *testing.T) {
+	center := Point{2, 3}
+	tests := []struct {
+		p        Point
+		radians  float64
+		expected Point
+	}{
+		{Point{3, 3}, math.Pi / 2, Point{2, 4}},
+		{Point{3, 3}, math.Pi, Point{1, 3}},
+		{Point{2, 3}, 1, Point{2, 3}},
+		{Point{0, 0}, math.Pi, Point{4, 6}},
+	}
+	for _, test := range tests {
+		if actual := test.p.RotateAbout(center, test.radians); !actual.Equal(test.expected, EPS) {
+			t.Errorf("Expected %v.RotateAbout(%v, %v) == %v, got %v", test.p, center, test.radians, test.expected, actual)
+		}
+	}
+}
+
+func TestClip(t *testing.T) {
+	world := mustBBox(Point{-180, -90}, []float64{360, 180})
+	tests := []struct {
+		name     string
+		bb       *BBox
+		expected *BBox
+	}{
+		{"inside", mustBBox(Point{0, 0}, []float64{10, 10}), mustBBox(Point{0, 0}, []float64{10, 10})},
+		{"overhanging", mustBBox(Point{170, 80}, []float64{20, 20}), mustBBox(Point{170, 80}, []float64{10, 10})},
+		{"covering", mustBBox(Point{-200, -100}, []float64{400, 200}), world},
+		{"spanning", mustBBox(Point{-200, 0}, []float64{400, 1}), mustBBox(Point{-180, 0}, []float64{360, 1})},
+		{"touching", mustBBox(Point{180, 0}, []float64{10, 10}), mustBBox(Point{180, 0}, []float64{0, 10})},
+		{"outside", mustBBox(Point{190, 0}, []float64{10, 10}), nil},
+		{"outside diagonally", mustBBox(Point{-200, -100}, []float64{10, 5}), nil},
+		{"nil", nil, nil},
+	}
+	for _, test := range tests {
+		actual := test.bb.Clip(world)
+		if (actual == nil) != (test.expected == nil) || (actual != nil && !actual.Equal(test.expected, EPS)) {
+			t.Errorf("%s: expected %v.Clip(%v) == %v, got %v", test.name, test.bb, world, test.expected, actual)
+		}
+		if actual != nil && (actual == test.bb || actual == world) {
+			t.Errorf("%s: expected a new box", test.name)
+		}
+	}
+	if actual := world.Clip(nil); actual != nil {
+		t.Errorf("expected clipping to nil bounds to give nil, got %v", actual)
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	a := mustBBox(Point{0, 0}, []float64{4, 4})
+	tests := []struct {
+		name     string
+		a, b     *BBox
+		expected []*BBox
+	}{
+		{
+			"disjoint",
+			a, mustBBox(Point{5, 5}, []float64{1, 1}),
+			[]*BBox{a},
+		},
+		{
+			"touching",
+			a, mustBBox(Point{4, 1}, []float64{1, 1}),
+			[]*BBox{a},
+		},
+		{
+			"corner",
+			a, mustBBox(Point{3, 3}, []float64{2, 2}),
+			[]*BBox{
+				mustBBox(Point{0, 0}, []float64{3, 4}),
+				mustBBox(Point{3, 0}, []float64{1, 3}),
+			},
+		},
+		{
+			"vertical slab",
+			a, mustBBox(Point{1, -1}, []float64{1, 6}),
+			[]*BBox{
+				mustBBox(Point{0, 0}, []float64{1, 4}),
+				mustBBox(Point{2, 0}, []float64{2, 4}),
+			},
+		},
+		{
+			"horizontal slab",
+			a, mustBBox(Point{-1, 1}, []float64{6, 2}),
+			[]*BBox{
+				mustBBox(Point{0, 0}, []float64{4, 1}),
+				mustBBox(Point{0, 3}, []float64{4, 1}),
+			},
+		},
+		{
+			"hole",
+			a, mustBBox(Point{1, 1}, []float64{2, 1}),
+			[]*BBox{
+				mustBBox(Point{0, 0}, []float64{1, 4}),
+				mustBBox(Point{3, 0}, []float64{1, 4}),
+				mustBBox(Point{1, 0}, []float64{2, 1}),
+				mustBBox(Point{1, 2}, []float64{2, 2}),
+			},
+		},
+		{
+			"covered",
+			a, mustBBox(Point{-1, -1}, []float64{6, 6}),
+			[]*BBox{},
+		},
+		{
+			"equal",
+			a, mustBBox(Point{0, 0}, []float64{4, 4}),
+			[]*BBox{},
+		},
+		{
+			"line",
+			mustBBox(Point{0, 1}, []float64{4, 0}), mustBBox(Point{1, 0}, []float64{2, 2}),
+			[]*BBox{
+				mustBBox(Point{0, 1}, []float64{1, 0}),
+				mustBBox(Point{3, 1}, []float64{1, 0}),
+			},
+		},
+	}
+	for _, test := range tests {
+		actual := test.a.Subtract(test.b)
+		if len(actual) != len(test.expected) {
+			t.Errorf("%s: expected %v - %v == %v, got %v", test.name, test.a, test.b, test.expected, actual)
+			continue
+		}
+		area := 0.0
+		for i := range actual {
+			if !actual[i].Equal(test.expected[i], EPS) {
+				t.Errorf("%s: expected %v - %v == %v, got %v", test.name, test.a, test.b, test.expected, actual)
+				break
+			}
+			if actual[i] == test.a {
+				t.Errorf("%s: expected a copy of %v", test.name, test.a)
+			}
+			area += actual[i].size()
+			for _, other := range actual[i+1:] {
+				if overlapArea(actual[i], other) > 0 {
+					t.Errorf("%s: pieces %v and %v overlap", test.name, actual[i], other)
+				}
+			}
+		}
+		if expected := test.a.size() - overlapArea(test.a, test.b); math.Abs(area-expected) > EPS {
+			t.Errorf("%s: expected pieces with area %v, got %v", test.name, expected, area)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	bb := mustBBox(Point{1, 2}, []float64{3, 0.5})
+	moved := bb.Translate(Point{-4, 10})
+
+	if !moved.min.Equal(Point{-3, 12}, EPS) || !moved.max.Equal(Point{0, 12.5}, EPS) {
+		t.Errorf("Expected [-3, 12]x[0, 12.5], got %v", moved)
+	}
+	if math.Abs(moved.size()-bb.size()) > EPS || math.Abs(moved.margin()-bb.margin()) > EPS {
+		t.Errorf("Expected size and margin to be preserved, got %v and %v", moved.size(), moved.margin())
+	}
+	if bb.min != (Point{1, 2}) || bb.max != (Point{4, 2.5}) {
+		t.Errorf("Expected receiver to be unchanged, got %v", bb)
+	}
+}
+
+func TestConvexHull(t *testing.T) {
+	if hull := ConvexHull(nil); hull != nil {
+		t.Errorf("Expected no hull for no objects, got %v", hull)
+	}
+
+	tests := []struct {
+		name     string
+		objs     []Spatial
+		expected []Point
+	}{
+		{
+			"single point",
+			[]Spatial{Point{1, 2}.ToBBox(0), Point{1, 2}.ToBBox(0)},
+			[]Point{{1, 2}},
+		},
+		{
+			"collinear points",
+			[]Spatial{Point{2, 2}.ToBBox(0), Point{0, 0}.ToBBox(0), Point{3, 3}.ToBBox(0), Point{1, 1}.ToBBox(0)},
+			[]Point{{0, 0}, {3, 3}},
+		},
+		{
+			"vertical segment",
+			[]Spatial{mustBBox(Point{1, 0}, []float64{0, 4}), Point{1, 2}.ToBBox(0)},
+			[]Point{{1, 0}, {1, 4}},
+		},
+		{
+			"square",
+			[]Spatial{mustBBox(Point{0, 0}, []float64{4, 4}), mustBBox(Point{1, 1}, []float64{1, 2})},
+			[]Point{{0, 0}, {4, 0}, {4, 4}, {0, 4}},
+		},
+		{
+			"square of points",
+			[]Spatial{Point{0, 2}.ToBBox(0), Point{2, 2}.ToBBox(0), Point{1, 1}.ToBBox(0), Point{2, 0}.ToBBox(0), Point{0, 0}.ToBBox(0), Point{1, 0}.ToBBox(0)},
+			[]Point{{0, 0}, {2, 0}, {2, 2}, {0, 2}},
+		},
+		{
+			"two boxes",
+			[]Spatial{mustBBox(Point{0, 0}, []float64{1, 1}), mustBBox(Point{3, 2}, []float64{1, 1})},
+			[]Point{{0, 0}, {1, 0}, {4, 2}, {4, 3}, {3, 3}, {0, 1}},
+		},
+	}
+	for _, test := range tests {
+		if hull := ConvexHull(test.objs); !reflect.DeepEqual(hull, test.expected) {
+			t.Errorf("%s: expected hull %v, got %v", test.name, test.expected, hull)
+		}
+	}
+
+	r := rand.New(rand.NewSource(131))
+	objs := randomBBoxes(r, 300)
+	hull := ConvexHull(objs)
+	if len(hull) < 3 {
+		t.Fatalf("expected a hull of at least 3 vertices, got %v", hull)
+	}
+	corners := map[Point]bool{}
+	for _, obj := range objs {
+		bb := obj.Bounds()
+		for _, c := range []Point{bb.min, {bb.max.X, bb.min.Y}, bb.max, {bb.min.X, bb.max.Y}} {
+			corners[c] = true
+		}
+	}
+	for i, v := range hull {
+		if !corners[v] {
+			t.Errorf("hull vertex %v is not a corner", v)
+		}
+		next, after := hull[(i+1)%len(hull)], hull[(i+2)%len(hull)]
+		if cross(v, next, after) <= 0 {
+			t.Errorf("hull does not turn counterclockwise at %v", next)
+		}
+		for c := range corners {
+			if cross(v, next, c) < 0 {
+				t.Errorf("corner %v lies outside hull edge %v-%v", c, v, next)
+			}
+		}
+	}
+}
+
+func TestBBoxSplit(t *testing.T) {
+	bb := mustBBox(Point{-1.3, 2.7}, []float64{5.9, 3.1})
+	if cells := bb.Split(0, 3); cells != nil {
+		t.Errorf("Expected no cells for 0 columns, got %v", cells)
+	}
+	if cells := bb.Split(2, -1); cells != nil {
+		t.Errorf("Expected no cells for -1 rows, got %v", cells)
+	}
+
+	for _, n := range [][2]int{{1, 1}, {2, 2}, {3, 1}, {4, 7}, {10, 10}} {
+		nx, ny := n[0], n[1]
+		cells := bb.Split(nx, ny)
+		if len(cells) != nx*ny {
+			t.Fatalf("Split(%d, %d): expected %d cells, got %d", nx, ny, nx*ny, len(cells))
+		}
+		area := 0.0
+		for k, c := range cells {
+			area += c.Area()
+			if !bb.containsBBox(c) {
+				t.Errorf("Split(%d, %d): cell %v outside %v", nx, ny, c, bb)
+			}
+			if math.Abs(c.Area()-bb.Area()/float64(nx*ny)) > EPS {
+				t.Errorf("Split(%d, %d): expected equal cells, got %v", nx, ny, c)
+			}
+			i, j := k%nx, k/nx
+			// neighbors share edges exactly
+			if i > 0 && (cells[k-1].max.X != c.min.X || cells[k-1].min.Y != c.min.Y) {
+				t.Errorf("Split(%d, %d): cell %v does not adjoin %v", nx, ny, c, cells[k-1])
+			}
+			if j > 0 && (cells[k-nx].max.Y != c.min.Y || cells[k-nx].min.X != c.min.X) {
+				t.Errorf("Split(%d, %d): cell %v does not adjoin %v", nx, ny, c, cells[k-nx])
+			}
+			for _, other := range cells[k+1:] {
+				if overlapArea(c, other) > 0 {
+					t.Errorf("Split(%d, %d): cells %v and %v overlap", nx, ny, c, other)
+				}
+			}
+		}
+		if math.Abs(area-bb.Area()) > EPS {
+			t.Errorf("Split(%d, %d): expected areas to sum to %v, got %v", nx, ny, bb.Area(), area)
+		}
+		first, last := cells[0], cells[len(cells)-1]
+		if first.min != bb.min || last.max != bb.max {
+			t.Errorf("Split(%d, %d): expected cells to span %v exactly, got %v to %v", nx, ny, bb, first, last)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"math"
+	"sort"
+)
+
+// EarthRadius is the mean radius of the Earth in meters, used by
+// HaversineDist.
+const EarthRadius = 6371008.8
+
+// HaversineDist returns the great-circle distance in meters between a and b
+// on a spherical Earth, treating X as longitude and Y as latitude, both in
+// degrees.
+func HaversineDist(a, b Point) float64 {
+	lat1, lat2 := a.Y*math.Pi/180, b.Y*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.X - a.X) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// haversineMinDist returns the great-circle distance in meters from p to the
+// nearest point of bb, with coordinates treated as by HaversineDist.  Boxes
+// are assumed not to cross the antimeridian.
+func haversineMinDist(p Point, bb *BBox) float64 {
+	if bb.min.X <= p.X && p.X <= bb.max.X {
+		// the nearest point is due north or south of p
+		lat := math.Max(bb.min.Y, math.Min(p.Y, bb.max.Y))
+		return HaversineDist(p, Point{p.X, lat})
+	}
+	// otherwise it lies on one of the meridians bounding bb
+	return math.Min(
+		meridianDist(p, bb.min.X, bb.min.Y, bb.max.Y),
+		meridianDist(p, bb.max.X, bb.min.Y, bb.max.Y))
+}
+
+// meridianDist returns the great-circle distance in meters from p to the
+// part of the meridian at longitude lon between latitudes minLat and maxLat.
+func meridianDist(p Point, lon, minLat, maxLat float64) float64 {
+	// If the meridian faces p, the distance along it has a single minimum,
+	// at the foot of the perpendicular from p, so clamping the foot into the
+	// segment finds the nearest point.  Otherwise the distance has a single
+	// maximum, and the nearest point is one of the ends of the segment.
+	dLon := math.Remainder(p.X-lon, 360) * math.Pi / 180
+	if math.Cos(dLon) <= 0 {
+		return math.Min(HaversineDist(p, Point{lon, minLat}), HaversineDist(p, Point{lon, maxLat}))
+	}
+	lat := math.Atan(math.Tan(p.Y*math.Pi/180)/math.Cos(dLon)) * 180 / math.Pi
+	lat = math.Max(minLat, math.Min(lat, maxLat))
+	return HaversineDist(p, Point{lon, lat})
+}
+
+// NearestNeighborHaversine returns the object closest to p by great-circle
+// distance, along with that distance in meters, treating coordinates as by
+// HaversineDist.  The distance to an object is measured to the nearest point
+// of its bounds, and subtrees are pruned by the great-circle distance to
+// their bounding boxes, which is a valid lower bound for the objects in them
+// where Euclidean minDist is not.  If tree is empty, it returns nil and +Inf.
+func (tree *Rtree) NearestNeighborHaversine(p Point) (Spatial, float64) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.nearestNeighborHaversine(p, tree.root, math.Inf(1), nil)
+}
+
+func (tree *Rtree) nearestNeighborHaversine(p Point, n *node, d float64, nearest Spatial) (Spatial, float64) {
+	dists := make([]float64, len(n.entries))
+	order := make([]int, len(n.entries))
+	for i, e := range n.entries {
+		dists[i] = haversineMinDist(p, e.bb)
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return dists[order[i]] < dists[order[j]] })
+
+	for _, i := range order {
+		if dists[i] >= d {
+			break
+		}
+		if n.leaf {
+			d, nearest = dists[i], n.entries[i].obj
+		} else {
+			nearest, d = tree.nearestNeighborHaversine(p, n.entries[i].child, d, nearest)
+		}
+	}
+	return nearest, d
+}
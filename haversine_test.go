@@ -0,0 +1,114 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+var (
+	london     = Point{-0.1278, 51.5074}
+	paris      = Point{2.3522, 48.8566}
+	newYork    = Point{-74.0060, 40.7128}
+	losAngeles = Point{-118.2437, 34.0522}
+	sydney     = Point{151.2093, -33.8688}
+	tokyo      = Point{139.6917, 35.6895}
+)
+
+func TestHaversineDist(t *testing.T) {
+	tests := []struct {
+		a, b     Point
+		expected float64 // meters
+	}{
+		{london, paris, 344e3},
+		{newYork, losAngeles, 3940e3},
+		{sydney, tokyo, 7820e3},
+		{london, london, 0},
+	}
+	for _, test := range tests {
+		d := HaversineDist(test.a, test.b)
+		if math.Abs(d-test.expected) > 0.01*test.expected {
+			t.Errorf("Expected HaversineDist(%v, %v) near %v, got %v", test.a, test.b, test.expected, d)
+		}
+		if r := HaversineDist(test.b, test.a); math.Abs(r-d) > 1e-6 {
+			t.Errorf("Expected HaversineDist to be symmetric, got %v and %v", d, r)
+		}
+	}
+
+	// a quarter of the way around the equator
+	if d := HaversineDist(Point{0, 0}, Point{90, 0}); math.Abs(d-math.Pi/2*EarthRadius) > 1e-6 {
+		t.Errorf("Expected a quarter circumference, got %v", d)
+	}
+}
+
+func TestHaversineMinDist(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	for i := 0; i < 1000; i++ {
+		p := Point{r.Float64()*360 - 180, r.Float64()*170 - 85}
+		min := Point{r.Float64()*300 - 150, r.Float64()*140 - 70}
+		bb := NewBBoxFromCorners(min, Point{min.X + r.Float64()*30, min.Y + r.Float64()*20})
+
+		d := haversineMinDist(p, bb)
+		if bb.containsPoint(p) && d != 0 {
+			t.Errorf("Expected zero distance from %v inside %v, got %v", p, bb, d)
+		}
+		// no sampled point of the box may be closer than the bound
+		for j := 0; j <= 20; j++ {
+			for k := 0; k <= 20; k++ {
+				q := Point{
+					bb.min.X + (bb.max.X-bb.min.X)*float64(j)/20,
+					bb.min.Y + (bb.max.Y-bb.min.Y)*float64(k)/20,
+				}
+				if s := HaversineDist(p, q); s < d-1e-6 {
+					t.Fatalf("%v is %v from %v, closer than the bound %v for %v", q, s, p, d, bb)
+				}
+			}
+		}
+	}
+}
+
+func TestNearestNeighborHaversine(t *testing.T) {
+	rt := NewTree(3, 8)
+	if obj, d := rt.NearestNeighborHaversine(london); obj != nil || !math.IsInf(d, 1) {
+		t.Errorf("Expected nil and +Inf for an empty tree, got %v and %v", obj, d)
+	}
+
+	r := rand.New(rand.NewSource(12))
+	objs := []Spatial{}
+	for i := 0; i < 500; i++ {
+		p := Point{r.Float64()*360 - 180, r.Float64()*180 - 90}
+		objs = append(objs, p.ToBBox(0))
+	}
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+
+	for _, p := range []Point{london, sydney, {0, 89}, {179.5, -10}, {-170, 60}} {
+		nearest, d := rt.NearestNeighborHaversine(p)
+		if expected := HaversineDist(p, nearest.Bounds().min); math.Abs(d-expected) > 1e-6 {
+			t.Errorf("Expected distance %v to %v, got %v", expected, nearest, d)
+		}
+		for _, obj := range objs {
+			if s := HaversineDist(p, obj.Bounds().min); s < d-1e-6 {
+				t.Errorf("NearestNeighborHaversine(%v) returned %v at %v, but %v is at %v", p, nearest, d, obj, s)
+			}
+		}
+	}
+
+	// near the pole, Euclidean distance in degrees picks the wrong object
+	polar := NewTree(3, 8)
+	near, far := Point{90, 88}.ToBBox(0), Point{0, 85}.ToBBox(0)
+	polar.Insert(near)
+	polar.Insert(far)
+	p := Point{-90, 88}
+	if polar.NearestNeighbor(p) != far {
+		t.Fatalf("expected the Euclidean nearest neighbor to be %v", far)
+	}
+	if obj, _ := polar.NearestNeighborHaversine(p); obj != near {
+		t.Errorf("Expected the great-circle nearest neighbor to be %v, got %v", near, obj)
+	}
+}
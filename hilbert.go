@@ -0,0 +1,97 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import "sort"
+
+// HilbertOrder returns the indices of points sorted by their position along a
+// Hilbert curve through a 2^order x 2^order grid covering the bounding box of
+// points.  Points that are close along the curve are close in space, so the
+// order is a good basis for packing objects into nodes.  The order is clamped
+// to the range [1, 31].
+func HilbertOrder(points []Point, order int) []int {
+	indices := make([]int, len(points))
+	if len(points) == 0 {
+		return indices
+	}
+	if order < 1 {
+		order = 1
+	} else if order > 31 {
+		order = 31
+	}
+
+	bounds := NewBBoxFromCorners(points[0], points[0])
+	for _, p := range points[1:] {
+		bounds = boundingBox(bounds, p.ToBBox(0))
+	}
+
+	keys := make([]uint64, len(points))
+	for i, p := range points {
+		indices[i] = i
+		keys[i] = hilbertIndex(p, bounds, order)
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return keys[indices[i]] < keys[indices[j]]
+	})
+	return indices
+}
+
+// hilbertIndex computes the distance along a Hilbert curve of the grid cell
+// containing p, where the grid has 2^order cells per side covering bounds.
+func hilbertIndex(p Point, bounds *BBox, order int) uint64 {
+	n := uint64(1) << uint(order)
+	x := hilbertCell(p.X, bounds.min.X, bounds.max.X, n)
+	y := hilbertCell(p.Y, bounds.min.Y, bounds.max.Y, n)
+
+	var d uint64
+	for s := n / 2; s > 0; s /= 2 {
+		var rx, ry uint64
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+
+		// rotate the quadrant so that the curve stays continuous
+		if ry == 0 {
+			if rx == 1 {
+				x = n - 1 - x
+				y = n - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
+
+// hilbertCell maps v in [min, max] onto one of n cells.
+func hilbertCell(v, min, max float64, n uint64) uint64 {
+	if max <= min {
+		return 0
+	}
+	c := uint64((v - min) / (max - min) * float64(n))
+	if c >= n {
+		c = n - 1
+	}
+	return c
+}
+
+// WalkHilbert calls visit for every object stored in tree in the order of the
+// centers of their bounds along a Hilbert curve of the given order, as
+// HilbertOrder sorts points, so that consecutive objects tend to be close in
+// space.  The objects are collected before the first call to visit, which may
+// therefore modify tree.
+func (tree *Rtree) WalkHilbert(order int, visit func(Spatial)) {
+	objs := tree.All()
+	centers := make([]Point, len(objs))
+	for i, obj := range objs {
+		centers[i] = obj.Bounds().center()
+	}
+	for _, i := range HilbertOrder(centers, order) {
+		visit(objs[i])
+	}
+}
@@ -0,0 +1,99 @@
+package rtree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestHilbertOrderContinuous(t *testing.T) {
+	for order := 1; order <= 4; order++ {
+		n := 1 << uint(order)
+		points := []Point{}
+		for x := 0; x < n; x++ {
+			for y := 0; y < n; y++ {
+				points = append(points, Point{float64(x) + 0.5, float64(y) + 0.5})
+			}
+		}
+
+		indices := HilbertOrder(points, order)
+		if len(indices) != len(points) {
+			t.Fatalf("expected %d indices, got %d", len(points), len(indices))
+		}
+		seen := map[int]bool{}
+		for i, ind := range indices {
+			seen[ind] = true
+			if i == 0 {
+				continue
+			}
+			p, q := points[indices[i-1]], points[ind]
+			if d := math.Abs(p.X-q.X) + math.Abs(p.Y-q.Y); d != 1 {
+				t.Errorf("order %d: %v and %v are consecutive but not adjacent", order, p, q)
+			}
+		}
+		if len(seen) != len(points) {
+			t.Errorf("order %d: expected a permutation, got %v", order, indices)
+		}
+	}
+}
+
+func TestHilbertOrderDegenerate(t *testing.T) {
+	if indices := HilbertOrder(nil, 4); len(indices) != 0 {
+		t.Errorf("expected no indices, got %v", indices)
+	}
+
+	points := []Point{{1, 1}, {1, 1}, {1, 1}}
+	indices := HilbertOrder(points, 4)
+	for i, ind := range indices {
+		if i != ind {
+			t.Errorf("expected identical points to keep their order, got %v", indices)
+		}
+	}
+}
+
+func TestWalkHilbert(t *testing.T) {
+	rt := NewTree(3, 8)
+	rt.WalkHilbert(8, func(obj Spatial) {
+		t.Errorf("unexpected visit of %v in an empty tree", obj)
+	})
+
+	// tight clusters far apart, inserted in interleaved order
+	r := rand.New(rand.NewSource(97))
+	const clusters, perCluster = 10, 40
+	centers := make([]Point, clusters)
+	for i := range centers {
+		centers[i] = Point{r.Float64() * 1000, r.Float64() * 1000}
+	}
+	cluster := map[Spatial]int{}
+	for j := 0; j < perCluster; j++ {
+		for i, c := range centers {
+			obj := Point{c.X + r.Float64(), c.Y + r.Float64()}.ToBBox(0.1)
+			cluster[obj] = i
+			rt.Insert(obj)
+		}
+	}
+
+	var visited []Spatial
+	rt.WalkHilbert(16, func(obj Spatial) {
+		visited = append(visited, obj)
+	})
+	if len(visited) != len(cluster) {
+		t.Fatalf("expected %d visits, got %d", len(cluster), len(visited))
+	}
+	seen := map[Spatial]bool{}
+	switches := 0
+	for i, obj := range visited {
+		if seen[obj] {
+			t.Errorf("visited %v twice", obj)
+		}
+		seen[obj] = true
+		if i > 0 && cluster[obj] != cluster[visited[i-1]] {
+			switches++
+		}
+	}
+	// each cluster is visited in few runs, rather than scattered as inserted;
+	// a cluster straddling cell boundaries of the curve may take more than one
+	if switches > 2*clusters {
+		t.Errorf("expected consecutive objects to stay within clusters, got %d switches", switches)
+	}
+}
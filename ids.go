@@ -0,0 +1,79 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+// IDTree is an R-tree indexing integer IDs by bounding box, for callers whose
+// objects live elsewhere, such as in a database.  Queries return the IDs of
+// the matching entries.
+type IDTree struct {
+	tree *Rtree
+}
+
+// idItem is the Spatial stored in an IDTree for each ID.
+type idItem struct {
+	id int64
+	bb *BBox
+}
+
+func (it idItem) Bounds() *BBox {
+	return it.bb
+}
+
+func sameID(obj1, obj2 Spatial) bool {
+	return obj1.(idItem).id == obj2.(idItem).id
+}
+
+// NewIDTree creates a new IDTree with the given branching factors.
+func NewIDTree(MinChildren, MaxChildren int) *IDTree {
+	return &IDTree{tree: NewTree(MinChildren, MaxChildren)}
+}
+
+// Size returns the number of IDs currently stored in t.
+func (t *IDTree) Size() int {
+	return t.tree.Size()
+}
+
+// Insert indexes id by the bounding box bb.
+func (t *IDTree) Insert(id int64, bb *BBox) {
+	t.tree.Insert(idItem{id, bb})
+}
+
+// Delete removes id, which must have been inserted with bounds equal to bb,
+// and reports whether it was found.
+func (t *IDTree) Delete(id int64, bb *BBox) bool {
+	return t.tree.DeleteWithComparator(idItem{id, bb}, sameID)
+}
+
+// SearchIntersect returns the IDs of all entries intersecting bb.
+func (t *IDTree) SearchIntersect(bb *BBox) []int64 {
+	return ids(t.tree.SearchIntersect(bb))
+}
+
+// NearestNeighbor returns the ID of the entry closest to p.  The boolean
+// result is false if t is empty.
+func (t *IDTree) NearestNeighbor(p Point) (int64, bool) {
+	obj := t.tree.NearestNeighbor(p)
+	if obj == nil {
+		return 0, false
+	}
+	return obj.(idItem).id, true
+}
+
+// NearestNeighbors returns the IDs of up to k entries closest to p, nearest
+// first.
+func (t *IDTree) NearestNeighbors(k int, p Point) []int64 {
+	return ids(t.tree.NearestNeighbors(k, p))
+}
+
+// ids extracts the IDs of the items in objs, skipping nil results.
+func ids(objs []Spatial) []int64 {
+	result := make([]int64, 0, len(objs))
+	for _, obj := range objs {
+		if obj != nil {
+			result = append(result, obj.(idItem).id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func sortedIDs(ids []int64) []int64 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestIDTree(t *testing.T) {
+	rt := NewIDTree(2, 4)
+	if _, ok := rt.NearestNeighbor(Point{0, 0}); ok {
+		t.Errorf("expected no nearest neighbor in an empty tree")
+	}
+
+	boxes := map[int64]*BBox{}
+	for i := int64(0); i < 20; i++ {
+		boxes[i*100] = mustBBox(Point{float64(i), float64(i % 4)}, []float64{0.5, 0.5})
+		rt.Insert(i*100, boxes[i*100])
+	}
+	if rt.Size() != len(boxes) {
+		t.Errorf("expected size %d, got %d", len(boxes), rt.Size())
+	}
+
+	q := mustBBox(Point{2.2, 0}, []float64{3, 4})
+	if found := sortedIDs(rt.SearchIntersect(q)); !reflect.DeepEqual(found, []int64{200, 300, 400, 500}) {
+		t.Errorf("unexpected search results %v", found)
+	}
+	if id, ok := rt.NearestNeighbor(Point{7.2, 3.2}); !ok || id != 700 {
+		t.Errorf("expected nearest neighbor 700, got %v", id)
+	}
+
+	// delete with an equal but distinct bounding box
+	if !rt.Delete(300, mustBBox(Point{3, 3}, []float64{0.5, 0.5})) {
+		t.Fatalf("failed to delete 300")
+	}
+	if rt.Delete(300, boxes[300]) {
+		t.Errorf("deleted 300 twice")
+	}
+	if rt.Delete(400, boxes[500]) {
+		t.Errorf("deleted 400 using the wrong bounds")
+	}
+	if found := sortedIDs(rt.SearchIntersect(q)); !reflect.DeepEqual(found, []int64{200, 400, 500}) {
+		t.Errorf("unexpected search results after delete %v", found)
+	}
+	if rt.Size() != len(boxes)-1 {
+		t.Errorf("expected size %d, got %d", len(boxes)-1, rt.Size())
+	}
+}
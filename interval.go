@@ -0,0 +1,64 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"fmt"
+	"math"
+)
+
+// Interval represents the closed 1-dimensional interval [Lo, Hi], such as a
+// time range.  Lo must not exceed Hi.
+type Interval struct {
+	Lo, Hi float64
+}
+
+func (iv Interval) String() string {
+	return fmt.Sprintf("[%.2f, %.2f]", iv.Lo, iv.Hi)
+}
+
+// Length returns the length of iv.
+func (iv Interval) Length() float64 {
+	return iv.Hi - iv.Lo
+}
+
+// Contains reports whether x lies in iv, including its endpoints.
+func (iv Interval) Contains(x float64) bool {
+	return iv.Lo <= x && x <= iv.Hi
+}
+
+// size returns the length of iv, as its extent in an IntervalTree.
+func (iv Interval) size() float64 {
+	return iv.Length()
+}
+
+// containsExtent reports whether other lies entirely within iv.
+func (iv Interval) containsExtent(other Interval) bool {
+	return iv.Lo <= other.Lo && other.Hi <= iv.Hi
+}
+
+// Overlaps reports whether iv and other share at least one point.  Both are
+// closed, as for the Closed BoundaryMode, so intervals that meet at an
+// endpoint overlap.
+func (iv Interval) Overlaps(other Interval) bool {
+	return iv.Lo <= other.Hi && other.Lo <= iv.Hi
+}
+
+// touchesExtent reports whether iv and other share at least one point,
+// including their endpoints, as Overlaps does.
+func (iv Interval) touchesExtent(other Interval) bool {
+	return iv.Overlaps(other)
+}
+
+// union returns the smallest interval containing both iv and other.
+func (iv Interval) union(other Interval) Interval {
+	return Interval{math.Min(iv.Lo, other.Lo), math.Max(iv.Hi, other.Hi)}
+}
+
+// enlargement computes how much the length of iv grows when it is enlarged
+// to include add.
+func (iv Interval) enlargement(add Interval) float64 {
+	return iv.union(add).Length() - iv.Length()
+}
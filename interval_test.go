@@ -0,0 +1,55 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import "testing"
+
+func TestIntervalOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b     Interval
+		expected bool
+	}{
+		{Interval{0, 2}, Interval{1, 3}, true},
+		{Interval{0, 4}, Interval{1, 2}, true},
+		{Interval{1, 2}, Interval{0, 4}, true},
+		{Interval{0, 1}, Interval{1, 2}, true},
+		{Interval{0, 1}, Interval{2, 3}, false},
+		{Interval{1, 1}, Interval{1, 2}, true},
+		{Interval{2, 2}, Interval{1, 2}, true},
+		{Interval{1, 1}, Interval{1, 1}, true},
+		{Interval{3, 3}, Interval{1, 2}, false},
+	}
+	for _, test := range tests {
+		if actual := test.a.Overlaps(test.b); actual != test.expected {
+			t.Errorf("Expected %v.Overlaps(%v) == %v, got %v", test.a, test.b, test.expected, actual)
+		}
+		if actual := test.b.Overlaps(test.a); actual != test.expected {
+			t.Errorf("Expected %v.Overlaps(%v) == %v, got %v", test.b, test.a, test.expected, actual)
+		}
+	}
+}
+
+func TestIntervalContains(t *testing.T) {
+	iv := Interval{-1, 2.5}
+	for _, x := range []float64{-1, 0, 2.5} {
+		if !iv.Contains(x) {
+			t.Errorf("Expected %v to contain %v", iv, x)
+		}
+	}
+	for _, x := range []float64{-1.5, 2.6} {
+		if iv.Contains(x) {
+			t.Errorf("Expected %v not to contain %v", iv, x)
+		}
+	}
+	if iv.Length() != 3.5 {
+		t.Errorf("Expected %v to have length 3.5, got %v", iv, iv.Length())
+	}
+	if u := iv.union(Interval{3, 4}); u != (Interval{-1, 4}) {
+		t.Errorf("Expected union [-1, 4], got %v", u)
+	}
+	if e := iv.enlargement(Interval{0, 4}); e != 1.5 {
+		t.Errorf("Expected enlargement 1.5, got %v", e)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import "sync"
+
+// Spatial1 is an interface for objects that can be stored in an IntervalTree
+// and queried.
+type Spatial1 interface {
+	Bounds() Interval
+}
+
+// IntervalTree is an R-tree over 1-dimensional intervals, such as time
+// ranges.  It works like Rtree3, with the bounding boxes of its nodes reduced
+// to intervals, and is likewise safe for concurrent use.
+type IntervalTree struct {
+	MinChildren int
+	MaxChildren int
+
+	// mu guards the tree below it.
+	mu sync.RWMutex
+	basicTree[Interval, Spatial1]
+}
+
+// node1 represents a tree node of an IntervalTree.
+type node1 = basicNode[Interval, Spatial1]
+
+// entry1 represents an index record stored in a node1.
+type entry1 = basicEntry[Interval, Spatial1]
+
+// NewIntervalTree creates a new interval tree instance.
+func NewIntervalTree(MinChildren, MaxChildren int) *IntervalTree {
+	tree := &IntervalTree{MinChildren: MinChildren, MaxChildren: MaxChildren}
+	tree.clear()
+	return tree
+}
+
+// Size returns the number of objects currently stored in tree.
+func (tree *IntervalTree) Size() int {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.size
+}
+
+// Insert inserts an object into the tree.
+func (tree *IntervalTree) Insert(obj Spatial1) {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	tree.insert(entry1{bb: obj.Bounds(), obj: obj}, tree.MinChildren, tree.MaxChildren)
+	tree.size++
+}
+
+// Delete removes an object from the tree and reports whether it was found.
+// Objects are compared with ==, so values of a type that == cannot compare,
+// such as a struct containing a slice, are never found; store pointers to
+// them instead.
+func (tree *IntervalTree) Delete(obj Spatial1) bool {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	return tree.delete(obj, obj.Bounds(), tree.MinChildren, tree.MaxChildren)
+}
+
+// SearchOverlap returns all objects whose intervals overlap iv, as defined by
+// Interval.Overlaps, in unspecified order.
+func (tree *IntervalTree) SearchOverlap(iv Interval) []Spatial1 {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.search([]Spatial1{}, tree.root, iv)
+}
+
+// SearchPoint returns all objects whose intervals contain x, including at
+// their endpoints, in unspecified order.
+func (tree *IntervalTree) SearchPoint(x float64) []Spatial1 {
+	return tree.SearchOverlap(Interval{x, x})
+}
@@ -0,0 +1,136 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+type span struct {
+	id int
+	iv Interval
+}
+
+func (s *span) Bounds() Interval {
+	return s.iv
+}
+
+// randomSpans returns n spans, some of them points and some nested inside
+// long spans.
+func randomSpans(r *rand.Rand, n int) []Spatial1 {
+	objs := make([]Spatial1, n)
+	for i := range objs {
+		lo := r.Float64()*1000 - 500
+		var length float64
+		switch i % 4 {
+		case 0:
+			length = 0
+		case 1:
+			length = r.Float64() * 200
+		default:
+			length = r.Float64() * 10
+		}
+		objs[i] = &span{i, Interval{lo, lo + length}}
+	}
+	return objs
+}
+
+func checkOverlaps(t *testing.T, rt *IntervalTree, objs []Spatial1, q Interval) {
+	found := map[Spatial1]bool{}
+	for _, obj := range rt.SearchOverlap(q) {
+		if found[obj] {
+			t.Errorf("%v returned twice for %v", obj.Bounds(), q)
+		}
+		found[obj] = true
+	}
+	expected := 0
+	for _, obj := range objs {
+		if obj.Bounds().Overlaps(q) {
+			expected++
+			if !found[obj] {
+				t.Errorf("expected %v to overlap %v", obj.Bounds(), q)
+			}
+		}
+	}
+	if len(found) != expected {
+		t.Errorf("expected %d results for %v, got %d", expected, q, len(found))
+	}
+}
+
+func TestIntervalTree(t *testing.T) {
+	r := rand.New(rand.NewSource(31))
+	objs := randomSpans(r, 500)
+	rt := NewIntervalTree(3, 8)
+	if found := rt.SearchOverlap(Interval{-1000, 1000}); len(found) != 0 {
+		t.Errorf("expected no results from an empty tree, got %v", found)
+	}
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	if rt.Size() != len(objs) {
+		t.Errorf("expected size %d, got %d", len(objs), rt.Size())
+	}
+	verifyBasic(t, &rt.basicTree, rt.root, rt.MinChildren, rt.MaxChildren)
+
+	for i := 0; i < 50; i++ {
+		lo := r.Float64()*1200 - 600
+		checkOverlaps(t, rt, objs, Interval{lo, lo + r.Float64()*50})
+	}
+	// query with the stored intervals themselves, including points and
+	// intervals touching at their endpoints
+	for _, obj := range objs[:50] {
+		iv := obj.Bounds()
+		checkOverlaps(t, rt, objs, iv)
+		checkOverlaps(t, rt, objs, Interval{iv.Hi, iv.Hi + 1})
+		checkOverlaps(t, rt, objs, Interval{iv.Lo, iv.Lo})
+	}
+
+	for _, obj := range objs[:350] {
+		if !rt.Delete(obj) {
+			t.Fatalf("failed to delete %v", obj.Bounds())
+		}
+	}
+	if rt.Delete(objs[0]) {
+		t.Errorf("deleted %v twice", objs[0].Bounds())
+	}
+	objs = objs[350:]
+	if rt.Size() != len(objs) {
+		t.Errorf("expected size %d, got %d", len(objs), rt.Size())
+	}
+	verifyBasic(t, &rt.basicTree, rt.root, rt.MinChildren, rt.MaxChildren)
+	for i := 0; i < 50; i++ {
+		lo := r.Float64()*1200 - 600
+		checkOverlaps(t, rt, objs, Interval{lo, lo + r.Float64()*50})
+	}
+}
+
+func TestIntervalTreeNested(t *testing.T) {
+	rt := NewIntervalTree(2, 4)
+	var objs []Spatial1
+	// concentric intervals, each nested in the previous one
+	for i := 0; i < 40; i++ {
+		obj := &span{i, Interval{float64(i), float64(100 - i)}}
+		objs = append(objs, obj)
+		rt.Insert(obj)
+	}
+	verifyBasic(t, &rt.basicTree, rt.root, rt.MinChildren, rt.MaxChildren)
+
+	if found := rt.SearchPoint(50); len(found) != 40 {
+		t.Errorf("expected all 40 intervals to contain 50, got %d", len(found))
+	}
+	if found := rt.SearchPoint(10); len(found) != 11 {
+		t.Errorf("expected 11 intervals to contain 10, got %d", len(found))
+	}
+	if found := rt.SearchOverlap(Interval{-5, 0}); len(found) != 1 {
+		t.Errorf("expected only [0, 100] to overlap [-5, 0], got %d", len(found))
+	}
+	if found := rt.SearchOverlap(Interval{-5, -1}); len(found) != 0 {
+		t.Errorf("expected no interval to overlap [-5, -1], got %d", len(found))
+	}
+	for _, q := range []Interval{{-5, 0}, {0, 0.5}, {39, 61}, {45, 55}, {99.5, 120}, {20, 20}} {
+		checkOverlaps(t, rt, objs, q)
+	}
+}
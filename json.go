@@ -0,0 +1,58 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MarshalJSON encodes p as a JSON array of its coordinates, [x, y].
+func (p Point) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]float64{p.X, p.Y})
+}
+
+// UnmarshalJSON decodes a JSON array of exactly two coordinates into p.
+func (p *Point) UnmarshalJSON(data []byte) error {
+	var coords []float64
+	if err := json.Unmarshal(data, &coords); err != nil {
+		return err
+	}
+	if len(coords) != 2 {
+		return fmt.Errorf("rtree: point must have 2 coordinates, got %d", len(coords))
+	}
+	p.X, p.Y = coords[0], coords[1]
+	return nil
+}
+
+// jsonBBox is the JSON representation of a BBox.
+type jsonBBox struct {
+	Min *Point `json:"min"`
+	Max *Point `json:"max"`
+}
+
+// MarshalJSON encodes bb as a JSON object of its corners,
+// {"min": [x, y], "max": [x, y]}.  The receiver is a value so that BBox
+// values, such as struct fields, are encoded the same way as pointers.
+func (bb BBox) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonBBox{Min: &bb.min, Max: &bb.max})
+}
+
+// UnmarshalJSON decodes a JSON object of two corners into bb.  Both corners
+// must be present and min must not exceed max in any dimension.
+func (bb *BBox) UnmarshalJSON(data []byte) error {
+	var v jsonBBox
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Min == nil || v.Max == nil {
+		return fmt.Errorf("rtree: bounding box must have min and max")
+	}
+	if v.Min.X > v.Max.X || v.Min.Y > v.Max.Y {
+		return fmt.Errorf("rtree: bounding box min %v exceeds max %v", *v.Min, *v.Max)
+	}
+	bb.min, bb.max = *v.Min, *v.Max
+	return nil
+}
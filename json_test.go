@@ -0,0 +1,102 @@
+package rtree
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPointJSON(t *testing.T) {
+	p := Point{-2.5, 3.25}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("Error marshaling %v: %v", p, err)
+	}
+	if string(data) != "[-2.5,3.25]" {
+		t.Errorf("Expected %v to marshal to [-2.5,3.25], got %s", p, data)
+	}
+
+	var q Point
+	if err := json.Unmarshal(data, &q); err != nil {
+		t.Fatalf("Error unmarshaling %s: %v", data, err)
+	}
+	if q != p {
+		t.Errorf("Expected %s to unmarshal to %v, got %v", data, p, q)
+	}
+}
+
+func TestPointJSONMalformed(t *testing.T) {
+	for _, data := range []string{`[1]`, `[1, 2, 3]`, `{"X": 1, "Y": 2}`, `[1, "a"]`, `[1, 2`, `null`} {
+		var p Point
+		if err := json.Unmarshal([]byte(data), &p); err == nil {
+			t.Errorf("Expected error unmarshaling %s, got %v", data, p)
+		}
+	}
+}
+
+func TestBBoxJSON(t *testing.T) {
+	bb, _ := NewBBox(Point{-2.5, 3.0}, 8, 1.5)
+	data, err := json.Marshal(bb)
+	if err != nil {
+		t.Fatalf("Error marshaling %v: %v", bb, err)
+	}
+	if string(data) != `{"min":[-2.5,3],"max":[5.5,4.5]}` {
+		t.Errorf("Unexpected encoding of %v: %s", bb, data)
+	}
+
+	var actual BBox
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("Error unmarshaling %s: %v", data, err)
+	}
+	if actual != *bb {
+		t.Errorf("Expected %s to unmarshal to %v, got %v", data, bb, &actual)
+	}
+}
+
+func TestBBoxJSONValue(t *testing.T) {
+	bb, _ := NewBBox(Point{-2.5, 3.0}, 8, 1.5)
+	data, err := json.Marshal(*bb)
+	if err != nil {
+		t.Fatalf("Error marshaling %v: %v", bb, err)
+	}
+	if string(data) != `{"min":[-2.5,3],"max":[5.5,4.5]}` {
+		t.Errorf("Unexpected encoding of the value %v: %s", bb, data)
+	}
+
+	type region struct {
+		Name   string `json:"name"`
+		Bounds BBox   `json:"bounds"`
+		Inner  *BBox  `json:"inner"`
+	}
+	data, err = json.Marshal(region{Name: "park", Bounds: *bb})
+	if err != nil {
+		t.Fatalf("Error marshaling a struct with a BBox field: %v", err)
+	}
+	expected := `{"name":"park","bounds":{"min":[-2.5,3],"max":[5.5,4.5]},"inner":null}`
+	if string(data) != expected {
+		t.Errorf("Expected struct to encode as %s, got %s", expected, data)
+	}
+
+	var actual region
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("Error unmarshaling %s: %v", data, err)
+	}
+	if actual.Bounds != *bb || actual.Inner != nil {
+		t.Errorf("Expected %s to unmarshal to bounds %v, got %+v", data, bb, actual)
+	}
+}
+
+func TestBBoxJSONMalformed(t *testing.T) {
+	for _, data := range []string{
+		`{"min":[0,0]}`,
+		`{"max":[1,1]}`,
+		`{"min":[0,0],"max":[1]}`,
+		`{"min":[2,0],"max":[1,1]}`,
+		`{"min":[0,0],"max":[1,1]`,
+		`[0,0,1,1]`,
+	} {
+		var bb BBox
+		if err := json.Unmarshal([]byte(data), &bb); err == nil {
+			t.Errorf("Expected error unmarshaling %s, got %v", data, &bb)
+		}
+	}
+}
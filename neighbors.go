@@ -0,0 +1,238 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// NeighborHeap collects the k closest of the objects pushed into it.  It is
+// a max-heap bounded to k elements, keeping the farthest retained object at
+// the root so that candidates can be compared against the current cutoff in
+// constant time.  NearestNeighbors uses it to gather results, and it can be
+// used the same way by custom traversals.
+type NeighborHeap struct {
+	k     int
+	items neighborList
+}
+
+type neighbor struct {
+	obj  Spatial
+	dist float64
+}
+
+// neighborList implements heap.Interface with the farthest neighbor first.
+type neighborList []neighbor
+
+func (l neighborList) Len() int            { return len(l) }
+func (l neighborList) Less(i, j int) bool  { return l[i].dist > l[j].dist }
+func (l neighborList) Swap(i, j int)       { l[i], l[j] = l[j], l[i] }
+func (l *neighborList) Push(x interface{}) { *l = append(*l, x.(neighbor)) }
+func (l *neighborList) Pop() interface{} {
+	old := *l
+	n := old[len(old)-1]
+	*l = old[:len(old)-1]
+	return n
+}
+
+// NewNeighborHeap creates an empty NeighborHeap that retains at most k
+// objects.
+func NewNeighborHeap(k int) *NeighborHeap {
+	if k < 0 {
+		k = 0
+	}
+	return &NeighborHeap{k: k, items: make(neighborList, 0, k)}
+}
+
+// Push offers obj at distance dist.  If the heap is full, obj replaces the
+// farthest retained object if it is closer, and is discarded otherwise.
+func (h *NeighborHeap) Push(obj Spatial, dist float64) {
+	if len(h.items) < h.k {
+		heap.Push(&h.items, neighbor{obj, dist})
+		return
+	}
+	if h.k == 0 || dist >= h.items[0].dist {
+		return
+	}
+	h.items[0] = neighbor{obj, dist}
+	heap.Fix(&h.items, 0)
+}
+
+// Len returns the number of objects retained by h.
+func (h *NeighborHeap) Len() int {
+	return len(h.items)
+}
+
+// MaxDist returns the distance an object must be closer than to be retained
+// by h: the distance of the farthest retained object once h is full, and
+// +Inf before that.
+func (h *NeighborHeap) MaxDist() float64 {
+	if h.k == 0 {
+		return math.Inf(-1)
+	}
+	if len(h.items) < h.k {
+		return math.Inf(1)
+	}
+	return h.items[0].dist
+}
+
+// Sorted returns the retained objects and their distances in order of
+// increasing distance.  h is left unchanged.
+func (h *NeighborHeap) Sorted() ([]Spatial, []float64) {
+	items := make(neighborList, len(h.items))
+	copy(items, h.items)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].dist < items[j].dist })
+
+	objs := make([]Spatial, len(items))
+	dists := make([]float64, len(items))
+	for i, n := range items {
+		objs[i], dists[i] = n.obj, n.dist
+	}
+	return objs, dists
+}
+
+// DistanceMode selects how the distance from a point to an object is
+// measured by NearestNeighborsMode.
+type DistanceMode int
+
+const (
+	// Edge measures the distance to the nearest point of an object's bounds,
+	// which is zero if the point lies within them.  It suits objects whose
+	// whole extent matters, such as finding the nearest building or road,
+	// and is what NearestNeighbors uses.
+	Edge DistanceMode = iota
+	// Center measures the distance to the center of an object's bounds.  It
+	// suits objects that stand for a location, such as labels or icons,
+	// where a large box should not rank nearer merely for its size.
+	Center
+)
+
+func (m DistanceMode) String() string {
+	switch m {
+	case Edge:
+		return "Edge"
+	case Center:
+		return "Center"
+	}
+	return "DistanceMode(?)"
+}
+
+// dist returns the distance from p to bb as measured by m.
+func (m DistanceMode) dist(p Point, bb *BBox) float64 {
+	if m == Center {
+		return p.dist(bb.center())
+	}
+	return math.Sqrt(p.minDist(bb))
+}
+
+// NearestNeighborsMode gets the k closest Spatials to the Point, with
+// distances measured as mode selects, sorted by increasing distance.  If tree
+// holds fewer than k objects, the result is padded with nils.
+func (tree *Rtree) NearestNeighborsMode(k int, p Point, mode DistanceMode) []Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	h := NewNeighborHeap(k)
+	tree.nearestNeighbors(p, math.Inf(1), mode, tree.root, h)
+	objs, _ := h.Sorted()
+	for len(objs) < k {
+		objs = append(objs, nil)
+	}
+	return objs
+}
+
+// NearestNeighborsIter returns an iterator over the objects in tree in order
+// of increasing distance from p.  Each call to the iterator returns the next
+// object and its distance from p; once every object has been returned, it
+// returns false.  The caller may stop at any point by not calling it again.
+// The results are undefined if tree is modified during the iteration.
+//
+// Implemented per "Distance Browsing in Spatial Databases" by G. Hjaltason
+// and H. Samet, ACM TODS, 24(2), pages 265-318, 1999.
+func (tree *Rtree) NearestNeighborsIter(p Point) func() (Spatial, float64, bool) {
+	tree.mu.RLock()
+	q := &browseQueue{{node: tree.root}}
+	tree.mu.RUnlock()
+
+	return func() (Spatial, float64, bool) {
+		tree.mu.RLock()
+		defer tree.mu.RUnlock()
+		for q.Len() > 0 {
+			next := heap.Pop(q).(browseItem)
+			if next.node == nil {
+				return next.obj, next.dist, true
+			}
+			for _, e := range next.node.entries {
+				item := browseItem{dist: math.Sqrt(p.minDist(e.bb))}
+				if next.node.leaf {
+					item.obj = e.obj
+				} else {
+					item.node = e.child
+				}
+				heap.Push(q, item)
+			}
+		}
+		return nil, 0, false
+	}
+}
+
+// ApproxNearest returns an object close to p and its distance from p,
+// visiting at most maxNodes nodes of tree, to bound the latency of the
+// search.  Nodes are visited closest first, so a leaf is reached after
+// little more than Depth visits and the result only improves with further
+// visits; if the search completes within the budget, the result is the exact
+// nearest neighbor.  A small budget trades accuracy for speed: the object
+// returned may be farther from p than the true nearest neighbor.  If tree is
+// empty or maxNodes is too small to reach a leaf, it returns nil and +Inf.
+func (tree *Rtree) ApproxNearest(p Point, maxNodes int) (Spatial, float64) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	var nearest Spatial
+	d := math.Inf(1)
+	q := &browseQueue{{node: tree.root}}
+	for visited := 0; visited < maxNodes && q.Len() > 0; visited++ {
+		next := heap.Pop(q).(browseItem)
+		if next.dist >= d {
+			// nothing left can be closer
+			break
+		}
+		for _, e := range next.node.entries {
+			dist := math.Sqrt(p.minDist(e.bb))
+			if dist >= d {
+				continue
+			}
+			if next.node.leaf {
+				nearest, d = e.obj, dist
+			} else {
+				heap.Push(q, browseItem{dist: dist, node: e.child})
+			}
+		}
+	}
+	return nearest, d
+}
+
+// browseItem is a node or object queued by NearestNeighborsIter or
+// ApproxNearest, along with its distance from the query point.
+type browseItem struct {
+	dist float64
+	node *node
+	obj  Spatial
+}
+
+// browseQueue implements heap.Interface with the closest item first.
+type browseQueue []browseItem
+
+func (q browseQueue) Len() int            { return len(q) }
+func (q browseQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q browseQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *browseQueue) Push(x interface{}) { *q = append(*q, x.(browseItem)) }
+func (q *browseQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,239 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNeighborHeap(t *testing.T) {
+	h := NewNeighborHeap(3)
+	if !math.IsInf(h.MaxDist(), 1) {
+		t.Errorf("expected an infinite cutoff for an empty heap, got %v", h.MaxDist())
+	}
+
+	things := []*BBox{}
+	for i := 0; i < 10; i++ {
+		things = append(things, mustBBox(Point{float64(i), 0}, []float64{1, 1}))
+	}
+	order := []int{7, 2, 9, 0, 5, 1, 8, 3, 6, 4}
+	for i, j := range order {
+		h.Push(things[j], float64(j))
+		if i == 1 && !math.IsInf(h.MaxDist(), 1) {
+			t.Errorf("expected an infinite cutoff before the heap is full, got %v", h.MaxDist())
+		}
+	}
+
+	if h.Len() != 3 {
+		t.Errorf("expected 3 retained objects, got %d", h.Len())
+	}
+	if h.MaxDist() != 2 {
+		t.Errorf("expected cutoff 2, got %v", h.MaxDist())
+	}
+	objs, dists := h.Sorted()
+	if !reflect.DeepEqual(objs, []Spatial{things[0], things[1], things[2]}) {
+		t.Errorf("expected the three closest objects, got %v", objs)
+	}
+	if !reflect.DeepEqual(dists, []float64{0, 1, 2}) {
+		t.Errorf("expected distances [0 1 2], got %v", dists)
+	}
+	if h.Len() != 3 {
+		t.Errorf("expected Sorted to leave the heap unchanged")
+	}
+
+	empty := NewNeighborHeap(0)
+	empty.Push(things[0], 0)
+	if empty.Len() != 0 {
+		t.Errorf("expected a zero-capacity heap to retain nothing")
+	}
+}
+
+func TestNearestNeighborsRandom(t *testing.T) {
+	rt := NewTree(3, 8)
+	objs := randomBBoxes(rand.New(rand.NewSource(1)), 300)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+
+	p := Point{10, -20}
+	sorted := make([]Spatial, len(objs))
+	copy(sorted, objs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Bounds().DistToPoint(p) < sorted[j].Bounds().DistToPoint(p)
+	})
+
+	for _, k := range []int{1, 5, 40} {
+		q := rt.NearestNeighbors(k, p)
+		if len(q) != k {
+			t.Fatalf("expected %d results, got %d", k, len(q))
+		}
+		for i := range q {
+			if d, expected := q[i].Bounds().DistToPoint(p), sorted[i].Bounds().DistToPoint(p); d != expected {
+				t.Errorf("k=%d: expected distance %v at index %d, got %v", k, expected, i, d)
+			}
+		}
+	}
+
+	small := NewTree(3, 8)
+	small.Insert(objs[0])
+	if q := small.NearestNeighbors(3, p); len(q) != 3 || q[0] != objs[0] || q[1] != nil || q[2] != nil {
+		t.Errorf("expected results padded with nil, got %v", q)
+	}
+}
+
+func TestNearestNeighborsIter(t *testing.T) {
+	rt := NewTree(3, 8)
+	if _, _, ok := rt.NearestNeighborsIter(Point{0, 0})(); ok {
+		t.Errorf("expected no results from an empty tree")
+	}
+
+	objs := randomBBoxes(rand.New(rand.NewSource(5)), 300)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+
+	p := Point{-40, 75}
+	next := rt.NearestNeighborsIter(p)
+	seen := map[Spatial]bool{}
+	last := 0.0
+	for i := 0; ; i++ {
+		obj, d, ok := next()
+		if !ok {
+			break
+		}
+		if i == 0 && obj != rt.NearestNeighbor(p) {
+			t.Errorf("expected the first result to be the nearest neighbor, got %v", obj)
+		}
+		if d < last {
+			t.Errorf("distance decreased from %v to %v", last, d)
+		}
+		if expected := obj.Bounds().DistToPoint(p); math.Abs(d-expected) > EPS {
+			t.Errorf("expected distance %v for %v, got %v", expected, obj, d)
+		}
+		if seen[obj] {
+			t.Errorf("%v returned twice", obj)
+		}
+		seen[obj] = true
+		last = d
+	}
+	if len(seen) != len(objs) {
+		t.Errorf("expected %d results, got %d", len(objs), len(seen))
+	}
+	if _, _, ok := next(); ok {
+		t.Errorf("expected an exhausted iterator to stay exhausted")
+	}
+}
+
+func TestApproxNearest(t *testing.T) {
+	rt := NewTree(3, 8)
+	if obj, d := rt.ApproxNearest(Point{0, 0}, 10); obj != nil || !math.IsInf(d, 1) {
+		t.Errorf("expected nil and +Inf for an empty tree, got %v and %v", obj, d)
+	}
+
+	r := rand.New(rand.NewSource(43))
+	for _, obj := range randomBBoxes(r, 2000) {
+		rt.Insert(obj)
+	}
+	depth := rt.Depth()
+
+	worse := 0
+	for i := 0; i < 100; i++ {
+		p := Point{r.Float64()*1000 - 500, r.Float64()*1000 - 500}
+		_, exact := rt.NearestNeighborDist(p)
+
+		if obj, d := rt.ApproxNearest(p, 1<<30); d != exact || obj.Bounds().DistToPoint(p) != d {
+			t.Errorf("expected the exact distance %v with a large budget, got %v", exact, d)
+		}
+		if obj, _ := rt.ApproxNearest(p, depth-1); obj != nil {
+			t.Errorf("expected no result without reaching a leaf, got %v", obj)
+		}
+
+		// the result only improves as the budget grows
+		last := math.Inf(1)
+		for budget := depth; budget <= 8*depth; budget++ {
+			obj, d := rt.ApproxNearest(p, budget)
+			if obj == nil {
+				if !math.IsInf(last, 1) {
+					t.Errorf("budget %d: lost the result found with a smaller budget", budget)
+				}
+				continue
+			}
+			if d < exact || d > last {
+				t.Errorf("budget %d: distance %v outside [%v, %v]", budget, d, exact, last)
+			}
+			last = d
+		}
+		if math.IsInf(last, 1) {
+			t.Errorf("expected a result with a budget of %d", 8*depth)
+		}
+		if _, d := rt.ApproxNearest(p, 2*depth); d > exact {
+			worse++
+		}
+	}
+	if worse == 0 {
+		t.Errorf("expected a budget of %d to miss the nearest neighbor sometimes", 2*depth)
+	}
+}
+
+func TestNearestNeighborsMode(t *testing.T) {
+	// a long box reaching close to p, whose center is far away, and a small
+	// box a little farther from p whose center is much nearer
+	long := mustBBox(Point{1, -0.5}, []float64{40, 1})
+	small := mustBBox(Point{-3, -0.5}, []float64{1, 1})
+	far := mustBBox(Point{10, 10}, []float64{1, 1})
+	p := Point{0, 0}
+
+	for _, rt := range []*Rtree{NewTree(2, 3), NewTreeRStar(2, 3)} {
+		for _, obj := range []Spatial{long, small, far} {
+			rt.Insert(obj)
+		}
+		for i := 0; i < 10; i++ {
+			rt.Insert(mustBBox(Point{float64(-50 + 3*i), 50}, []float64{1, 1}))
+		}
+
+		tests := []struct {
+			mode     DistanceMode
+			expected []Spatial
+		}{
+			{Edge, []Spatial{long, small, far}},
+			{Center, []Spatial{small, far, long}},
+		}
+		for _, test := range tests {
+			if objs := rt.NearestNeighborsMode(3, p, test.mode); !reflect.DeepEqual(objs, test.expected) {
+				t.Errorf("%v: expected %v, got %v", test.mode, test.expected, objs)
+			}
+		}
+		if objs := rt.NearestNeighbors(3, p); !reflect.DeepEqual(objs, rt.NearestNeighborsMode(3, p, Edge)) {
+			t.Errorf("expected NearestNeighbors to measure to edges, got %v", objs)
+		}
+	}
+
+	// both modes agree with brute force on random data
+	r := rand.New(rand.NewSource(47))
+	rt := NewTree(3, 8)
+	objs := randomBBoxes(r, 500)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	for _, mode := range []DistanceMode{Edge, Center} {
+		for i := 0; i < 20; i++ {
+			p := Point{r.Float64()*1000 - 500, r.Float64()*1000 - 500}
+			sorted := append([]Spatial{}, objs...)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				return mode.dist(p, sorted[i].Bounds()) < mode.dist(p, sorted[j].Bounds())
+			})
+			if found := rt.NearestNeighborsMode(10, p, mode); !reflect.DeepEqual(found, sorted[:10]) {
+				t.Errorf("%v: expected %v, got %v", mode, sorted[:10], found)
+			}
+		}
+	}
+	if s := rt.NearestNeighborsMode(600, Point{}, Center); len(s) != 600 || s[500] != nil {
+		t.Errorf("expected results padded with nils")
+	}
+}
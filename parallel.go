@@ -0,0 +1,66 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import "sync"
+
+// subtreesPerWorker is the number of subtrees SearchIntersectParallel aims
+// to hand each worker, so that the load stays balanced when some subtrees
+// hold many more results than others.
+const subtreesPerWorker = 4
+
+// SearchIntersectParallel returns all objects that intersect the specified
+// rectangle, as SearchIntersect does, searching disjoint subtrees of tree on
+// up to workers goroutines.  The order of the results is unspecified.  It
+// pays off only for large trees and queries with many results; with fewer
+// than two workers, the search runs on the calling goroutine.
+func (tree *Rtree) SearchIntersectParallel(bb *BBox, workers int) []Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	if workers < 2 {
+		return tree.searchIntersect([]Spatial{}, tree.root, bb, nil)
+	}
+
+	// descend level by level until there are enough subtrees to share out
+	frontier := []*node{tree.root}
+	for !frontier[0].leaf && len(frontier) < subtreesPerWorker*workers {
+		var next []*node
+		for _, n := range frontier {
+			for _, e := range n.entries {
+				if tree.mayIntersect(e, bb) {
+					next = append(next, e.child)
+				}
+			}
+		}
+		if len(next) == 0 {
+			return []Spatial{}
+		}
+		frontier = next
+	}
+
+	subtrees := make(chan *node)
+	results := make([][]Spatial, workers)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := range subtrees {
+				results[i] = tree.searchIntersect(results[i], n, bb, nil)
+			}
+		}(i)
+	}
+	for _, n := range frontier {
+		subtrees <- n
+	}
+	close(subtrees)
+	wg.Wait()
+
+	merged := []Spatial{}
+	for _, r := range results {
+		merged = append(merged, r...)
+	}
+	return merged
+}
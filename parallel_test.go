@@ -0,0 +1,92 @@
+package rtree
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// sameObjects reports whether a and b hold the same objects the same number
+// of times, in any order.
+func sameObjects(a, b []Spatial) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[Spatial]int{}
+	for _, obj := range a {
+		counts[obj]++
+	}
+	for _, obj := range b {
+		counts[obj]--
+		if counts[obj] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSearchIntersectParallel(t *testing.T) {
+	r := rand.New(rand.NewSource(67))
+	rt := NewTree(3, 8)
+	if found := rt.SearchIntersectParallel(mustBBox(Point{0, 0}, []float64{1, 1}), 4); len(found) != 0 {
+		t.Errorf("expected no results from an empty tree, got %v", found)
+	}
+	for _, obj := range randomBBoxes(r, 5000) {
+		rt.Insert(obj)
+	}
+
+	queries := []*BBox{
+		mustBBox(Point{-1000, -1000}, []float64{2000, 2000}),
+		mustBBox(Point{2000, 2000}, []float64{1, 1}),
+	}
+	for i := 0; i < 20; i++ {
+		p := Point{r.Float64()*1000 - 500, r.Float64()*1000 - 500}
+		queries = append(queries, mustBBox(p, []float64{r.Float64() * 300, r.Float64() * 300}))
+	}
+	for _, q := range queries {
+		expected := rt.SearchIntersect(q)
+		for _, workers := range []int{-1, 1, 2, 3, 8, 100} {
+			if found := rt.SearchIntersectParallel(q, workers); !sameObjects(found, expected) {
+				t.Errorf("%d workers: expected %d results for %v, got %d", workers, len(expected), q, len(found))
+			}
+		}
+	}
+
+	small := NewTree(3, 8)
+	objs := randomBBoxes(r, 5)
+	for _, obj := range objs {
+		small.Insert(obj)
+	}
+	if found := small.SearchIntersectParallel(queries[0], 4); !sameObjects(found, objs) {
+		t.Errorf("expected all %d objects from a single leaf, got %v", len(objs), found)
+	}
+}
+
+func TestSearchIntersectParallelConcurrent(t *testing.T) {
+	r := rand.New(rand.NewSource(71))
+	rt := NewTreeRStar(3, 8)
+	objs := randomBBoxes(r, 2000)
+	for _, obj := range objs[:1000] {
+		rt.Insert(obj)
+	}
+	q := mustBBox(Point{-200, -200}, []float64{400, 400})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				rt.SearchIntersectParallel(q, 4)
+			}
+		}()
+	}
+	for _, obj := range objs[1000:] {
+		rt.Insert(obj)
+	}
+	wg.Wait()
+
+	if found := rt.SearchIntersectParallel(q, 4); !sameObjects(found, rt.SearchIntersect(q)) {
+		t.Errorf("expected parallel and sequential results to match")
+	}
+}
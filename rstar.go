@@ -0,0 +1,211 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"math"
+	"sort"
+)
+
+// reinsertFraction is the fraction of the maximum number of entries of a node
+// that are removed from it when it overflows and inserted again.  The R*-tree
+// paper found 30% to perform best for both leaves and internal nodes.
+const reinsertFraction = 0.3
+
+// NewTreeRStar creates a new R*-tree instance.  It stores and queries objects
+// exactly like a tree created by NewTree, but chooses subtrees by minimal
+// overlap enlargement, splits nodes along the axis of minimal margin, and
+// reinserts a portion of a node's entries the first time a level overflows
+// during an insertion.
+//
+// Implemented per "The R*-tree: An Efficient and Robust Access Method for
+// Points and Rectangles" by N. Beckmann, H.P. Kriegel, R. Schneider and
+// B. Seeger, Proceedings of ACM SIGMOD, pages 323-331, 1990.
+func NewTreeRStar(MinChildren, MaxChildren int, opts ...Option) *Rtree {
+	rt := NewTree(MinChildren, MaxChildren, opts...)
+	rt.rstar = true
+	return rt
+}
+
+// chooseLeastOverlap returns the child of n whose bounding box overlaps
+// least with its siblings after being enlarged to include e.  Ties are
+// resolved by least area enlargement, then by smallest area, then by least
+// margin enlargement.
+func (n *node) chooseLeastOverlap(e entry) *node {
+	var chosen *node
+	minOverlap, minDiff, minSize := math.MaxFloat64, math.MaxFloat64, math.MaxFloat64
+	minMarginDiff := math.MaxFloat64
+	siblings := make([]*BBox, 0, len(n.entries))
+	for i, en := range n.entries {
+		siblings = siblings[:0]
+		for j, other := range n.entries {
+			if i != j {
+				siblings = append(siblings, other.bb)
+			}
+		}
+		bb := boundingBox(en.bb, e.bb)
+		overlap := overlapEnlargement(en.bb, siblings, e.bb)
+		diff := enlargement(en.bb, e.bb)
+		size := en.bb.size()
+		marginDiff := bb.margin() - en.bb.margin()
+		if overlap < minOverlap ||
+			(overlap == minOverlap && diff < minDiff) ||
+			(overlap == minOverlap && diff == minDiff && size < minSize) ||
+			(overlap == minOverlap && diff == minDiff && size == minSize && marginDiff < minMarginDiff) {
+			minOverlap, minDiff, minSize, minMarginDiff = overlap, diff, size, marginDiff
+			chosen = en.child
+		}
+	}
+	return chosen
+}
+
+// overlapEnlargement computes how much the total area that target shares with
+// siblings grows when target is enlarged to include add.
+func overlapEnlargement(target *BBox, siblings []*BBox, add *BBox) float64 {
+	bb := boundingBox(target, add)
+	growth := 0.0
+	for _, other := range siblings {
+		growth += overlapArea(bb, other) - overlapArea(target, other)
+	}
+	return growth
+}
+
+// entriesBoundingBox finds the MBR of a group of entries.
+func entriesBoundingBox(entries []entry) *BBox {
+	bb := entries[0].bb
+	for _, e := range entries[1:] {
+		bb = boundingBox(bb, e.bb)
+	}
+	return bb
+}
+
+// axisOrders returns copies of entries sorted by the lower and then by the
+// upper value of their bounding boxes, first along X and then along Y.
+func axisOrders(entries []entry) [4][]entry {
+	keys := [4]func(bb *BBox) (float64, float64){
+		func(bb *BBox) (float64, float64) { return bb.min.X, bb.max.X },
+		func(bb *BBox) (float64, float64) { return bb.max.X, bb.min.X },
+		func(bb *BBox) (float64, float64) { return bb.min.Y, bb.max.Y },
+		func(bb *BBox) (float64, float64) { return bb.max.Y, bb.min.Y },
+	}
+	var orders [4][]entry
+	for i, key := range keys {
+		sorted := make([]entry, len(entries))
+		copy(sorted, entries)
+		sort.SliceStable(sorted, func(a, b int) bool {
+			a1, a2 := key(sorted[a].bb)
+			b1, b2 := key(sorted[b].bb)
+			return a1 < b1 || (a1 == b1 && a2 < b2)
+		})
+		orders[i] = sorted
+	}
+	return orders
+}
+
+// splitRStar splits a node into two groups.  The split axis is the one along
+// which the sum of the margins of all candidate distributions is smallest;
+// along that axis, the distribution with the least overlap between the two
+// groups is chosen, breaking ties by least total area.
+func (n *node) splitRStar(minGroupSize int) (left, right *node) {
+	if minGroupSize < 1 {
+		minGroupSize = 1
+	}
+	if half := len(n.entries) / 2; minGroupSize > half {
+		minGroupSize = half
+	}
+	orders := axisOrders(n.entries)
+
+	// choose the split axis
+	axis := 0
+	minMargin := math.MaxFloat64
+	for a := 0; a < 2; a++ {
+		margin := 0.0
+		for _, sorted := range orders[2*a : 2*a+2] {
+			for k := minGroupSize; k <= len(sorted)-minGroupSize; k++ {
+				margin += entriesBoundingBox(sorted[:k]).margin()
+				margin += entriesBoundingBox(sorted[k:]).margin()
+			}
+		}
+		if margin < minMargin {
+			minMargin = margin
+			axis = a
+		}
+	}
+
+	// choose the split index along that axis
+	var chosen []entry
+	index := 0
+	minOverlap, minSize := math.MaxFloat64, math.MaxFloat64
+	for _, sorted := range orders[2*axis : 2*axis+2] {
+		for k := minGroupSize; k <= len(sorted)-minGroupSize; k++ {
+			bb1 := entriesBoundingBox(sorted[:k])
+			bb2 := entriesBoundingBox(sorted[k:])
+			overlap := overlapArea(bb1, bb2)
+			size := bb1.size() + bb2.size()
+			if overlap < minOverlap || (overlap == minOverlap && size < minSize) {
+				minOverlap, minSize = overlap, size
+				chosen, index = sorted, k
+			}
+		}
+	}
+
+	// setup the new split nodes, but re-use n as the left node
+	left = n
+	left.entries = []entry{}
+	right = &node{
+		parent: n.parent,
+		leaf:   n.leaf,
+		level:  n.level,
+	}
+	for _, e := range chosen[:index] {
+		assign(e, left)
+	}
+	for _, e := range chosen[index:] {
+		assign(e, right)
+	}
+	return
+}
+
+// reinsertOnOverflow handles the overflowing node n by forced reinsertion if
+// tree is an R*-tree, n is not the root and no reinsertion has happened at
+// n's level during the current insertion.  It reports whether it did so; if
+// not, the caller should split n.
+func (tree *Rtree) reinsertOnOverflow(n *node) bool {
+	if !tree.rstar || n == tree.root || tree.reinserted[n.level] {
+		return false
+	}
+	if tree.reinserted == nil {
+		tree.reinserted = map[int]bool{}
+	}
+	tree.reinserted[n.level] = true
+	tree.reinsert(n)
+	return true
+}
+
+// reinsert removes the entries of n whose centers lie farthest from the
+// center of n's bounding box and inserts them again at n's level, closest
+// first.
+func (tree *Rtree) reinsert(n *node) {
+	p := int(reinsertFraction * float64(tree.maxChildren(n.level)))
+	if p < 1 {
+		p = 1
+	}
+
+	center := n.computeBoundingBox().center()
+	entries := make([]entry, len(n.entries))
+	copy(entries, n.entries)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return center.dist(entries[i].bb.center()) < center.dist(entries[j].bb.center())
+	})
+	// cap keep so that appending to n cannot overwrite removed
+	cut := len(entries) - p
+	keep, removed := entries[:cut:cut], entries[cut:]
+
+	n.entries = keep
+	tree.adjustTree(n, nil)
+	for _, e := range removed {
+		tree.insert(e, n.level)
+	}
+}
@@ -0,0 +1,177 @@
+package rtree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// clusteredBBoxes returns n small boxes grouped around a handful of centers.
+func clusteredBBoxes(r *rand.Rand, n int) []*BBox {
+	centers := []Point{{0, 0}, {50, 10}, {-30, 40}, {20, -60}, {80, 80}}
+	things := make([]*BBox, n)
+	for i := range things {
+		c := centers[i%len(centers)]
+		p := Point{c.X + r.NormFloat64()*5, c.Y + r.NormFloat64()*5}
+		things[i] = mustBBox(p, []float64{r.Float64(), r.Float64()})
+	}
+	return things
+}
+
+// verifyStructure checks that all leaves are at level 1, that every node
+// except the root respects the branching factors and that every entry's
+// bounding box is the MBR of its child.
+func verifyStructure(t *testing.T, rt *Rtree, n *node) {
+	if n != rt.root && (len(n.entries) < rt.MinChildren || len(n.entries) > rt.MaxChildren) {
+		t.Errorf("node at level %d has %d entries", n.level, len(n.entries))
+	}
+	if n.leaf {
+		if n.level != 1 {
+			t.Errorf("leaf at level %d", n.level)
+		}
+		return
+	}
+	for _, e := range n.entries {
+		bb := e.child.computeBoundingBox()
+		if e.bb.min.dist(bb.min) >= EPS || e.bb.max.dist(bb.max) >= EPS {
+			t.Errorf("entry bb %v does not fit child bb %v", e.bb, bb)
+		}
+		verifyStructure(t, rt, e.child)
+	}
+}
+
+func TestRStarInsert(t *testing.T) {
+	rt := NewTreeRStar(3, 8)
+	things := clusteredBBoxes(rand.New(rand.NewSource(1)), 500)
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+
+	if rt.Size() != len(things) {
+		t.Errorf("expected size %d, got %d", len(things), rt.Size())
+	}
+	verify(t, rt.root)
+	verifyStructure(t, rt, rt.root)
+
+	for _, thing := range things {
+		if rt.findLeaf(rt.root, thing, defaultComparator) == nil {
+			t.Errorf("unable to find leaf containing %v", thing)
+		}
+		if indexOf(rt.SearchIntersect(thing), thing) < 0 {
+			t.Errorf("SearchIntersect failed to find %v", thing)
+		}
+	}
+}
+
+func TestRStarDelete(t *testing.T) {
+	rt := NewTreeRStar(3, 8)
+	things := clusteredBBoxes(rand.New(rand.NewSource(2)), 200)
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+
+	for i, thing := range things[:150] {
+		if !rt.Delete(thing) {
+			t.Fatalf("Thing %v was not found in tree during deletion", thing)
+		}
+		if rt.Size() != len(things)-i-1 {
+			t.Fatalf("Delete failed to remove %v", thing)
+		}
+	}
+	verify(t, rt.root)
+
+	for _, thing := range things[150:] {
+		if rt.findLeaf(rt.root, thing, defaultComparator) == nil {
+			t.Errorf("unable to find leaf containing %v", thing)
+		}
+	}
+}
+
+func TestSplitRStar(t *testing.T) {
+	entries := []entry{
+		{bb: mustBBox(Point{0, 0}, []float64{1, 1})},
+		{bb: mustBBox(Point{10, 0}, []float64{1, 1})},
+		{bb: mustBBox(Point{0, 1}, []float64{1, 1})},
+		{bb: mustBBox(Point{10, 1}, []float64{1, 1})},
+		{bb: mustBBox(Point{0, 2}, []float64{1, 1})},
+		{bb: mustBBox(Point{10, 2}, []float64{1, 1})},
+	}
+	n := &node{entries: entries, leaf: true}
+
+	l, r := n.splitRStar(2)
+	if len(l.entries) != 3 || len(r.entries) != 3 {
+		t.Fatalf("expected an even split, got %d and %d", len(l.entries), len(r.entries))
+	}
+
+	lbb, rbb := l.computeBoundingBox(), r.computeBoundingBox()
+	if overlapArea(lbb, rbb) != 0 {
+		t.Errorf("expected disjoint groups, got %v and %v", lbb, rbb)
+	}
+	if lbb.max.X-lbb.min.X != 1 || rbb.max.X-rbb.min.X != 1 {
+		t.Errorf("expected split along the X axis, got %v and %v", lbb, rbb)
+	}
+}
+
+func TestChooseLeastOverlap(t *testing.T) {
+	leaf0 := &node{leaf: true, level: 1}
+	leaf1 := &node{leaf: true, level: 1}
+	n := &node{level: 2, entries: []entry{
+		{bb: mustBBox(Point{0, 0}, []float64{10, 1}), child: leaf0},
+		{bb: mustBBox(Point{9, 2}, []float64{1, 8}), child: leaf1},
+	}}
+
+	// Enlarging leaf0 needs less area but would make it overlap leaf1, while
+	// enlarging leaf1 leaves the two disjoint.
+	obj := mustBBox(Point{0, 3}, []float64{0.5, 0.5})
+	if chosen := n.chooseLeastOverlap(entry{obj, nil, obj}); chosen != leaf1 {
+		t.Errorf("expected the child with least overlap enlargement")
+	}
+}
+
+func TestOverlapEnlargement(t *testing.T) {
+	target := mustBBox(Point{0, 0}, []float64{2, 2})
+	right := mustBBox(Point{3, 0}, []float64{2, 2})
+	above := mustBBox(Point{0, 3}, []float64{2, 2})
+	diagonal := mustBBox(Point{3, 3}, []float64{2, 2})
+	tests := []struct {
+		target   *BBox
+		siblings []*BBox
+		add      *BBox
+		expected float64
+	}{
+		// two siblings, only one of which the enlarged target reaches
+		{target, []*BBox{right, above}, mustBBox(Point{3.5, 0.5}, []float64{0.5, 0.5}), 2},
+		// three siblings, all reached
+		{target, []*BBox{right, above, diagonal}, Point{4, 4}.ToBBox(0), 5},
+		// growth of an existing overlap counts only the increase
+		{mustBBox(Point{0, 0}, []float64{4, 4}), []*BBox{diagonal}, Point{5, 5}.ToBBox(0), 3},
+		// adding a box already inside target changes nothing
+		{target, []*BBox{right, above, diagonal}, mustBBox(Point{0.5, 0.5}, []float64{1, 1}), 0},
+		{target, nil, Point{10, 10}.ToBBox(0), 0},
+	}
+	for _, test := range tests {
+		if actual := overlapEnlargement(test.target, test.siblings, test.add); math.Abs(actual-test.expected) > EPS {
+			t.Errorf("expected overlapEnlargement(%v, %v, %v) == %v, got %v", test.target, test.siblings, test.add, test.expected, actual)
+		}
+	}
+}
+
+func benchmarkSearchIntersectClustered(b *testing.B, rt *Rtree) {
+	r := rand.New(rand.NewSource(3))
+	for _, thing := range clusteredBBoxes(r, 10000) {
+		rt.Insert(thing)
+	}
+	queries := clusteredBBoxes(r, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rt.SearchIntersect(queries[i%len(queries)])
+	}
+}
+
+func BenchmarkSearchIntersectClustered(b *testing.B) {
+	benchmarkSearchIntersectClustered(b, NewTree(10, 25))
+}
+
+func BenchmarkSearchIntersectClusteredRStar(b *testing.B) {
+	benchmarkSearchIntersectClustered(b, NewTreeRStar(10, 25))
+}
@@ -6,52 +6,549 @@
 package rtree
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"math"
+	"reflect"
 	"sort"
+	"strings"
+	"sync"
 )
 
 // Comparator compares two spatials and returns whether they are equal.
 type Comparator func(obj1, obj2 Spatial) (equal bool)
 
+// defaultComparator reports whether obj1 and obj2 have equal bounds and are
+// equal under ==.  Values of a type that cannot be compared with == are never
+// equal, rather than causing a panic.
 func defaultComparator(obj1, obj2 Spatial) bool {
+	return sameObject(obj1, obj2) && obj1.Bounds().Equal(obj2.Bounds(), 0)
+}
+
+// sameObject reports whether obj1 and obj2 are equal under ==.  Values of a
+// type that cannot be compared with == are never equal, rather than causing
+// a panic.
+func sameObject(obj1, obj2 any) bool {
+	if reflect.TypeOf(obj1) != reflect.TypeOf(obj2) || !reflect.ValueOf(obj1).Comparable() {
+		return false
+	}
 	return obj1 == obj2
 }
 
 // Rtree represents an R-tree, a balanced search tree for storing and querying
 // spatial objects. MinChildren/MaxChildren specify the minimum/maximum
-// branching factors.
+// branching factors, for leaves too unless the tree is configured with
+// LeafCapacity.
+//
+// An Rtree is safe for concurrent use by multiple goroutines: queries may run
+// in parallel with each other, while insertions and deletions are exclusive.
+//
+// None of the insertion, split or reinsertion heuristics use randomness, so
+// applying the same operations in the same order to trees with the same
+// configuration always yields identical trees.
 type Rtree struct {
 	MinChildren int
 	MaxChildren int
-	root        *node
-	size        int
-	height      int
+
+	// OnSplit, if set, is called whenever a node splits, with the level of
+	// the node (1 for leaves) and the bounding boxes of the node before the
+	// split and of the two nodes it was split into.  It is called while the
+	// tree is locked, so it must not call methods of the tree.
+	OnSplit func(level int, before *BBox, a, b *BBox)
+
+	// mu guards the fields below it.
+	mu     sync.RWMutex
+	root   *node
+	size   int
+	height int
+	// extent caches the bounds of all objects in the tree for Bounds, if
+	// extentValid is set.  Insertions grow it, while deletions, which may
+	// shrink it, mark it invalid so that it is recomputed when next needed.
+	extent      *BBox
+	extentValid bool
+
+	// rstar selects the R*-tree insertion and split algorithms.
+	rstar bool
+	// splitter, if set, overrides the algorithm used to split nodes.
+	splitter SplitStrategy
+	// codec encodes and decodes objects for WriteTo and ReadFrom.
+	codec SpatialCodec
+	// boundary selects the BoundaryMode used by queries.
+	boundary BoundaryMode
+	// equal, if set, overrides defaultComparator wherever stored objects are
+	// compared.
+	equal Comparator
+	// leafMin and leafMax, if leafMax is set, override MinChildren and
+	// MaxChildren for leaves.
+	leafMin, leafMax int
+	// bulkWorkers is the number of goroutines used for bulk loading.
+	bulkWorkers int
+	// autoRebuild, if positive, is the number of deletions after which the
+	// tree is rebuilt; deletions counts them since the last rebuild.
+	autoRebuild, deletions int
+	// reinserted records the levels at which forced reinsertion has already
+	// happened during the current insertion.
+	reinserted map[int]bool
 }
 
+// Option configures an Rtree created by NewTree or NewTreeRStar.
+type Option func(*Rtree)
+
 // NewTree creates a new R-tree instance.
-func NewTree(MinChildren, MaxChildren int) *Rtree {
-	rt := Rtree{MinChildren: MinChildren, MaxChildren: MaxChildren}
-	rt.height = 1
-	rt.root = &node{}
-	rt.root.entries = []entry{}
-	rt.root.leaf = true
-	rt.root.level = 1
-	return &rt
+func NewTree(MinChildren, MaxChildren int, opts ...Option) *Rtree {
+	rt := &Rtree{MinChildren: MinChildren, MaxChildren: MaxChildren}
+	for _, opt := range opts {
+		opt(rt)
+	}
+	rt.clear()
+	return rt
+}
+
+// Equal sets the function that every method comparing stored objects uses to
+// decide whether a stored object is the one asked for: Delete, Update,
+// InsertUnique, DepthOf, SearchIntersectUnique and DeleteWithComparator when
+// given a nil Comparator.  By default objects are equal when their bounds are
+// equal and they are equal under ==; objects of a type that == cannot
+// compare, such as a struct containing a slice, are then never equal, so
+// trees storing them need a custom function.
+func Equal(eq Comparator) Option {
+	return func(tree *Rtree) {
+		tree.equal = eq
+	}
+}
+
+// LeafCapacity sets the minimum and maximum number of entries of leaves,
+// leaving MinChildren and MaxChildren to govern the other nodes, so that, for
+// example, leaves can be wide while branch nodes stay narrow.  The two
+// capacities must each satisfy what MinChildren and MaxChildren must: the
+// maximum is at least 2 and the minimum at most half of it.  The root is
+// exempt from the minimum, as always.
+func LeafCapacity(min, max int) Option {
+	return func(tree *Rtree) {
+		tree.leafMin, tree.leafMax = min, max
+	}
+}
+
+// minChildren returns the minimum number of entries of nodes at level.
+func (tree *Rtree) minChildren(level int) int {
+	if level == 1 && tree.leafMax > 0 {
+		return tree.leafMin
+	}
+	return tree.MinChildren
+}
+
+// maxChildren returns the maximum number of entries of nodes at level.
+func (tree *Rtree) maxChildren(level int) int {
+	if level == 1 && tree.leafMax > 0 {
+		return tree.leafMax
+	}
+	return tree.MaxChildren
+}
+
+// comparator returns the Comparator tree uses by default.
+func (tree *Rtree) comparator() Comparator {
+	if tree.equal == nil {
+		return defaultComparator
+	}
+	return tree.equal
+}
+
+// Clear removes all objects from tree, keeping its configuration so that it
+// can be reused.
+func (tree *Rtree) Clear() {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	tree.clear()
+}
+
+// clear resets tree to a single empty leaf, releasing all other nodes.
+func (tree *Rtree) clear() {
+	tree.size = 0
+	tree.height = 1
+	tree.root = &node{}
+	tree.root.entries = []entry{}
+	tree.root.leaf = true
+	tree.root.level = 1
+	tree.reinserted = nil
+	tree.extent, tree.extentValid = nil, true
 }
 
 // Size returns the number of objects currently stored in tree.
 func (tree *Rtree) Size() int {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
 	return tree.size
 }
 
+// IsEmpty reports whether tree stores no objects.
+func (tree *Rtree) IsEmpty() bool {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.size == 0
+}
+
+// Bounds returns the smallest box containing every object stored in tree, or
+// nil if tree is empty.  The result is cached, so that it is cheap unless
+// objects have been removed since the last call.
+func (tree *Rtree) Bounds() *BBox {
+	tree.mu.RLock()
+	if tree.extentValid {
+		bb := tree.extentCopy()
+		tree.mu.RUnlock()
+		return bb
+	}
+	tree.mu.RUnlock()
+
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if !tree.extentValid {
+		tree.extent, tree.extentValid = nil, true
+		if len(tree.root.entries) > 0 {
+			tree.extent = tree.root.computeBoundingBox()
+		}
+	}
+	return tree.extentCopy()
+}
+
+// extentCopy returns a copy of the cached extent, so that callers of Bounds
+// cannot modify it.
+func (tree *Rtree) extentCopy() *BBox {
+	if tree.extent == nil {
+		return nil
+	}
+	bb := *tree.extent
+	return &bb
+}
+
+// stringMaxDepth bounds the number of levels printed by String, so that
+// printing a huge tree stays manageable.
+const stringMaxDepth = 4
+
+// String returns an indented dump of the top levels of tree, as written by
+// Dump.
 func (tree *Rtree) String() string {
-	return "foo"
+	var buf bytes.Buffer
+	tree.Dump(&buf, stringMaxDepth)
+	return buf.String()
+}
+
+// Dump writes a textual representation of tree to w, one line per node or
+// object, indented by depth.  Each node line shows the node's level and
+// bounding box; each object line shows the object's bounds.  If maxDepth is
+// positive, only that many levels of nodes are printed and the contents of
+// deeper subtrees are summarized by their object count.
+func (tree *Rtree) Dump(w io.Writer, maxDepth int) error {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	if len(tree.root.entries) == 0 {
+		_, err := fmt.Fprintln(w, "empty")
+		return err
+	}
+	return tree.dump(w, tree.root, 0, maxDepth)
+}
+
+func (tree *Rtree) dump(w io.Writer, n *node, depth, maxDepth int) error {
+	indent := strings.Repeat("  ", depth)
+	if _, err := fmt.Fprintf(w, "%slevel %d %v\n", indent, n.level, n.computeBoundingBox()); err != nil {
+		return err
+	}
+	if maxDepth > 0 && depth+1 >= maxDepth && !n.leaf {
+		_, err := fmt.Fprintf(w, "%s  ... %d objects\n", indent, n.count())
+		return err
+	}
+	for _, e := range n.entries {
+		var err error
+		if n.leaf {
+			_, err = fmt.Fprintf(w, "%s  object %v\n", indent, e.bb)
+		} else {
+			err = tree.dump(w, e.child, depth+1, maxDepth)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Depth returns the maximum depth of tree.
+// WriteDOT writes tree to w as a Graphviz digraph, for visualizing small
+// trees.  Each node of the tree is a box labeled with its level and bounding
+// box, with an edge to each of its children; the labels of leaves also list
+// their objects, as formatted by fmt.Sprint.  Nodes are named n0, n1, ... in
+// depth-first order.
+func (tree *Rtree) WriteDOT(w io.Writer) error {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	if _, err := fmt.Fprint(w, "digraph rtree {\n\tnode [shape=box];\n"); err != nil {
+		return err
+	}
+	if len(tree.root.entries) > 0 {
+		next := 0
+		if err := tree.writeDOT(w, tree.root, &next); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// dotEscaper escapes text for a quoted DOT string, in which only double
+// quotes and backslashes are special; unlike %q it leaves other characters,
+// such as non-ASCII letters, as they are.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// writeDOT writes the subtree rooted at n, naming its nodes from *next on.  The
+// lines of a label are joined with DOT's \n escape.
+func (tree *Rtree) writeDOT(w io.Writer, n *node, next *int) error {
+	id := *next
+	*next++
+	lines := []string{fmt.Sprintf("level %d", n.level), fmt.Sprint(n.computeBoundingBox())}
+	if n.leaf {
+		for _, e := range n.entries {
+			lines = append(lines, fmt.Sprint(e.obj))
+		}
+	}
+	for i := range lines {
+		lines[i] = dotEscaper.Replace(lines[i])
+	}
+	label := strings.Join(lines, `\n`)
+	if _, err := fmt.Fprintf(w, "\tn%d [label=\"%s\"];\n", id, label); err != nil {
+		return err
+	}
+	if n.leaf {
+		return nil
+	}
+	for _, e := range n.entries {
+		if _, err := fmt.Fprintf(w, "\tn%d -> n%d;\n", id, *next); err != nil {
+			return err
+		}
+		if err := tree.writeDOT(w, e.child, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// count returns the number of objects stored in the subtree rooted at n.
+func (n *node) count() int {
+	if n.leaf {
+		return len(n.entries)
+	}
+	total := 0
+	for _, e := range n.entries {
+		total += e.child.count()
+	}
+	return total
+}
+
+// Depth returns the number of levels from the root of tree to its leaves, or
+// zero if tree is empty.
 func (tree *Rtree) Depth() int {
-	return tree.height
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	if len(tree.root.entries) == 0 {
+		return 0
+	}
+	// all leaves are at the same level, so any path down will do
+	depth := 1
+	for n := tree.root; !n.leaf; n = n.entries[0].child {
+		depth++
+	}
+	return depth
+}
+
+// DepthOf returns the number of levels from the root of tree down to the leaf
+// holding obj, counting both, and whether obj was found.  Objects are
+// compared as configured by Equal.  Since all leaves are at the same depth,
+// the result equals Depth for every stored object.
+func (tree *Rtree) DepthOf(obj Spatial) (int, bool) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	cmp := tree.comparator()
+	leaf := tree.findLeaf(tree.root, obj, cmp)
+	if leaf == nil {
+		return 0, false
+	}
+	// a leaf root is returned without checking its entries
+	found := false
+	for _, e := range leaf.entries {
+		if cmp(e.obj, obj) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	depth := 1
+	for n := leaf; n.parent != nil; n = n.parent {
+		depth++
+	}
+	return depth, true
+}
+
+// Coverage returns the total area of the bounding boxes of the leaf nodes of
+// tree and the area of the bounding box of the whole tree.  Their ratio
+// measures the quality of the index: leaf boxes that overlap or enclose much
+// dead space make leafArea large compared to rootArea.  Both are zero for an
+// empty tree.
+func (tree *Rtree) Coverage() (leafArea, rootArea float64) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	if len(tree.root.entries) == 0 {
+		return 0, 0
+	}
+	return tree.leafArea(tree.root), tree.root.computeBoundingBox().size()
+}
+
+// leafArea returns the total area of the bounding boxes of the leaves below n.
+func (tree *Rtree) leafArea(n *node) float64 {
+	if n.leaf {
+		return n.computeBoundingBox().size()
+	}
+	area := 0.0
+	for _, e := range n.entries {
+		area += tree.leafArea(e.child)
+	}
+	return area
+}
+
+// LevelStat summarizes the nodes at one level of a tree.  Levels count up
+// from 1 for the leaves, and the fill of a node is its number of entries.
+type LevelStat struct {
+	Level, Nodes, MinFill, MaxFill int
+	AvgFill                        float64
+}
+
+// LevelStats returns the number of nodes and their fill at each level of
+// tree, from the root down to the leaves, or nil if tree is empty.  Levels
+// whose nodes are much emptier than their capacity on average suggest poor
+// splits or many deletions.
+func (tree *Rtree) LevelStats() []LevelStat {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	if len(tree.root.entries) == 0 {
+		return nil
+	}
+
+	var stats []LevelStat
+	for level := []*node{tree.root}; len(level) > 0; {
+		stat := LevelStat{Level: level[0].level, Nodes: len(level), MinFill: math.MaxInt}
+		var next []*node
+		total := 0
+		for _, n := range level {
+			fill := len(n.entries)
+			total += fill
+			if fill < stat.MinFill {
+				stat.MinFill = fill
+			}
+			if fill > stat.MaxFill {
+				stat.MaxFill = fill
+			}
+			if !n.leaf {
+				for _, e := range n.entries {
+					next = append(next, e.child)
+				}
+			}
+		}
+		stat.AvgFill = float64(total) / float64(len(level))
+		stats = append(stats, stat)
+		level = next
+	}
+	return stats
+}
+
+// Walk performs a top-down, depth-first traversal of tree, calling visit with
+// the level and bounding box of every node, followed by those of its entries.
+// Nodes are reported with isLeaf false, at levels counting up from 1 for the
+// lowest nodes; the objects in them are reported as leaf entries with isLeaf
+// true at level 0.  Nothing is reported for an empty tree.  visit is called
+// while the tree is locked, so it must not call methods of the tree.
+func (tree *Rtree) Walk(visit func(level int, bb *BBox, isLeaf bool)) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	if len(tree.root.entries) == 0 {
+		return
+	}
+	tree.walk(tree.root, visit)
+}
+
+func (tree *Rtree) walk(n *node, visit func(level int, bb *BBox, isLeaf bool)) {
+	visit(n.level, n.computeBoundingBox(), false)
+	for _, e := range n.entries {
+		if n.leaf {
+			visit(0, e.bb, true)
+		} else {
+			tree.walk(e.child, visit)
+		}
+	}
+}
+
+// All returns every object stored in tree, in unspecified order.
+func (tree *Rtree) All() []Spatial {
+	results := make([]Spatial, 0, tree.Size())
+	tree.AllVisit(func(obj Spatial) bool {
+		results = append(results, obj)
+		return true
+	})
+	return results
+}
+
+// AllVisit calls visit for every object stored in tree, in unspecified
+// order, stopping early if visit returns false.  visit is called while the
+// tree is locked, so it must not call methods of the tree; collect the
+// objects with All first to modify the tree while visiting them.
+func (tree *Rtree) AllVisit(visit func(Spatial) bool) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	tree.allVisit(tree.root, visit)
+}
+
+func (tree *Rtree) allVisit(n *node, visit func(Spatial) bool) bool {
+	for _, e := range n.entries {
+		if n.leaf {
+			if !visit(e.obj) {
+				return false
+			}
+		} else if !tree.allVisit(e.child, visit) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllByArea returns all objects stored in tree sorted by the area of their
+// bounds, largest first if descending is set.  Objects of equal area are in
+// the order All returns them.
+func (tree *Rtree) AllByArea(descending bool) []Spatial {
+	results := tree.All()
+	areas := make([]float64, len(results))
+	for i, obj := range results {
+		areas[i] = obj.Bounds().Area()
+	}
+	sort.Stable(byArea{results, areas, descending})
+	return results
+}
+
+// byArea sorts objects by the precomputed areas of their bounds.
+type byArea struct {
+	objs       []Spatial
+	areas      []float64
+	descending bool
+}
+
+func (s byArea) Len() int { return len(s.objs) }
+
+func (s byArea) Less(i, j int) bool {
+	if s.descending {
+		return s.areas[i] > s.areas[j]
+	}
+	return s.areas[i] < s.areas[j]
+}
+
+func (s byArea) Swap(i, j int) {
+	s.objs[i], s.objs[j] = s.objs[j], s.objs[i]
+	s.areas[i], s.areas[j] = s.areas[j], s.areas[i]
 }
 
 // node represents a tree node of an Rtree.
@@ -80,11 +577,81 @@ func (e entry) String() string {
 	return fmt.Sprintf("entry{bb: %v, obj: %v}", e.bb, e.obj)
 }
 
+// mayIntersect reports whether the object stored in e, or any object stored
+// below it, may intersect bb under the tree's BoundaryMode.  A node's bounding
+// box is tested including its boundary, since an object lying on the boundary
+// may intersect bb even when the node's box merely touches it.
+func (tree *Rtree) mayIntersect(e entry, bb *BBox) bool {
+	if e.child == nil {
+		return tree.boundary.Overlaps(e.bb, bb)
+	}
+	return touches(e.bb, bb)
+}
+
 // Spatial is an interface for objects that can be stored in an Rtree and queried.
 type Spatial interface {
 	Bounds() *BBox
 }
 
+// BoxItem adapts a bare bounding box to Spatial, for indexing boxes without
+// defining a wrapper type.  BoxItems are equal when they hold the same *BBox.
+type BoxItem struct {
+	*BBox
+}
+
+// NewBoxItem constructs a BoxItem holding the box given by NewBBox(p, x, y).
+func NewBoxItem(p Point, x, y float64) (BoxItem, error) {
+	bb, err := NewBBox(p, x, y)
+	if err != nil {
+		return BoxItem{}, err
+	}
+	return BoxItem{bb}, nil
+}
+
+// Bounds returns the box held by b.
+func (b BoxItem) Bounds() *BBox {
+	return b.BBox
+}
+
+// PointItem adapts a bare point to Spatial, for indexing points without
+// defining a wrapper type.  Its bounds are the degenerate box at the point, and
+// the objects returned by queries of a tree of PointItems give back the point
+// itself.  PointItems are equal when they hold the same point.
+type PointItem struct {
+	p Point
+}
+
+// NewPointItem constructs a PointItem holding p.
+func NewPointItem(p Point) PointItem {
+	return PointItem{p}
+}
+
+// Point returns the point held by pi.
+func (pi PointItem) Point() Point {
+	return pi.p
+}
+
+// Bounds returns the degenerate box at the point held by pi.
+func (pi PointItem) Bounds() *BBox {
+	return pi.p.ToBBox(0)
+}
+
+// Record pairs a bounding box with arbitrary data, for indexing data without
+// defining a Spatial type for it.  Queries of a tree of Records return the
+// Records themselves, from which Data can be read.  Records are equal when
+// they hold the same *BBox and equal Data; if Data may hold values that
+// cannot be compared with ==, such as slices or maps, configure the tree with
+// Equal to delete them.
+type Record struct {
+	BBox *BBox
+	Data any
+}
+
+// Bounds returns the box held by r.
+func (r Record) Bounds() *BBox {
+	return r.BBox
+}
+
 // Insertion
 
 // Insert inserts a spatial object into the tree.  If insertion
@@ -93,13 +660,94 @@ type Spatial interface {
 // Implemented per Section 3.2 of "R-trees: A Dynamic Index Structure for
 // Spatial Searching" by A. Guttman, Proceedings of ACM SIGMOD, p. 47-57, 1984.
 func (tree *Rtree) Insert(obj Spatial) {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	tree.reinserted = nil
 	e := entry{obj.Bounds(), nil, obj}
 	tree.insert(e, 1)
 	tree.size++
 }
 
+// InsertUnique inserts obj unless an equal object with the same bounds is
+// already stored in tree, and reports whether it was inserted.  Objects are
+// compared as configured by Equal, by default with ==, so values of a
+// comparable type are equal when their contents are.
+func (tree *Rtree) InsertUnique(obj Spatial) bool {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	bb := obj.Bounds()
+	if tree.containsObject(tree.root, bb, obj) {
+		return false
+	}
+	tree.reinserted = nil
+	tree.insert(entry{bb, nil, obj}, 1)
+	tree.size++
+	return true
+}
+
+// containsObject reports whether the subtree rooted at n stores obj with
+// bounds equal to bb.
+func (tree *Rtree) containsObject(n *node, bb *BBox, obj Spatial) bool {
+	for _, e := range n.entries {
+		if n.leaf {
+			if e.bb.Equal(bb, 0) && tree.comparator()(e.obj, obj) {
+				return true
+			}
+		} else if e.bb.containsBBox(bb) && tree.containsObject(e.child, bb, obj) {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertOrReplace inserts obj, first removing the stored object whose center
+// is closest to the center of obj if that is within eps of it, and reports
+// whether an object was replaced.  It suits data with jitter, such as sensor
+// readings, where nearly coincident objects stand for the same thing.
+func (tree *Rtree) InsertOrReplace(obj Spatial, eps float64) bool {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	bb := obj.Bounds()
+	c := bb.center()
+	// the center of an object lies within its bounds, so only objects whose
+	// bounds reach within eps of c can qualify
+	leaf, i, _ := tree.closestCenter(tree.root, c, c.ToBBox(eps), nil, -1, eps)
+	if leaf != nil {
+		tree.reinserted = nil
+		tree.removeEntry(leaf, i)
+	}
+	tree.reinserted = nil
+	tree.insert(entry{bb, nil, obj}, 1)
+	tree.size++
+	return leaf != nil
+}
+
+// closestCenter finds the object entry below n whose center is closest to c,
+// provided it is within d of c, searching only subtrees touching window.  It
+// returns the leaf holding it and its index there, or leaf and i unchanged if
+// there is none closer, together with its distance from c.
+func (tree *Rtree) closestCenter(n *node, c Point, window *BBox, leaf *node, i int, d float64) (*node, int, float64) {
+	for j, e := range n.entries {
+		if !touches(e.bb, window) {
+			continue
+		}
+		if !n.leaf {
+			leaf, i, d = tree.closestCenter(e.child, c, window, leaf, i, d)
+			continue
+		}
+		if dist := c.dist(e.bb.center()); dist < d || (dist == d && leaf == nil) {
+			leaf, i, d = n, j, dist
+		}
+	}
+	return leaf, i, d
+}
+
 // insert adds the specified entry to the tree at the specified level.
 func (tree *Rtree) insert(e entry, level int) {
+	if tree.extentValid {
+		tree.extent = boundingBox(tree.extent, e.bb)
+	}
 	leaf := tree.chooseNode(tree.root, e, level)
 	leaf.entries = append(leaf.entries, e)
 
@@ -110,8 +758,11 @@ func (tree *Rtree) insert(e entry, level int) {
 
 	// split leaf if overflows
 	var split *node
-	if len(leaf.entries) > tree.MaxChildren {
-		leaf, split = leaf.split(tree.MinChildren)
+	if len(leaf.entries) > tree.maxChildren(leaf.level) {
+		if tree.reinsertOnOverflow(leaf) {
+			return
+		}
+		leaf, split = tree.splitNode(leaf)
 	}
 	root, splitRoot := tree.adjustTree(leaf, split)
 	if splitRoot != nil {
@@ -135,15 +786,20 @@ func (tree *Rtree) chooseNode(n *node, e entry, level int) *node {
 	if n.leaf || n.level == level {
 		return n
 	}
+	if tree.rstar && n.level == level+1 {
+		return n.chooseLeastOverlap(e)
+	}
 
-	// find the entry whose bb needs least enlargement to include obj
-	diff := math.MaxFloat64
+	// find the entry whose bb needs least enlargement to include obj; when
+	// areas are zero, as for points, margins break the ties
+	diff, marginDiff := math.MaxFloat64, math.MaxFloat64
 	var chosen entry
 	for _, en := range n.entries {
-		bb := boundingBox(en.bb, e.bb)
-		d := bb.size() - en.bb.size()
-		if d < diff || (d == diff && en.bb.size() < chosen.bb.size()) {
-			diff = d
+		d := enlargement(en.bb, e.bb)
+		m := boundingBox(en.bb, e.bb).margin() - en.bb.margin()
+		if d < diff || (d == diff && en.bb.size() < chosen.bb.size()) ||
+			(d == diff && en.bb.size() == chosen.bb.size() && m < marginDiff) {
+			diff, marginDiff = d, m
 			chosen = en
 		}
 	}
@@ -173,8 +829,11 @@ func (tree *Rtree) adjustTree(n, nn *node) (*node, *node) {
 	n.parent.entries = append(n.parent.entries, enn)
 
 	// If the new entry overflows the parent, split the parent and propagate.
-	if len(n.parent.entries) > tree.MaxChildren {
-		return tree.adjustTree(n.parent.split(tree.MinChildren))
+	if len(n.parent.entries) > tree.maxChildren(n.parent.level) {
+		if tree.reinsertOnOverflow(n.parent) {
+			return tree.root, nil
+		}
+		return tree.adjustTree(tree.splitNode(n.parent))
 	}
 
 	// Otherwise keep propagating changes upwards.
@@ -203,6 +862,28 @@ func (n *node) computeBoundingBox() (bb *BBox) {
 	return
 }
 
+// splitNode splits an overflowing node using the algorithm selected for tree,
+// reporting the split to OnSplit if it is set.
+func (tree *Rtree) splitNode(n *node) (left, right *node) {
+	if tree.OnSplit == nil {
+		return tree.splitWithAlgorithm(n)
+	}
+	before := n.computeBoundingBox()
+	left, right = tree.splitWithAlgorithm(n)
+	tree.OnSplit(n.level, before, left.computeBoundingBox(), right.computeBoundingBox())
+	return left, right
+}
+
+func (tree *Rtree) splitWithAlgorithm(n *node) (left, right *node) {
+	if tree.splitter != nil {
+		return n.splitWith(tree.splitter, tree.minChildren(n.level))
+	}
+	if tree.rstar {
+		return n.splitRStar(tree.minChildren(n.level))
+	}
+	return n.split(tree.minChildren(n.level))
+}
+
 // split splits a node into two groups while attempting to minimize the
 // bounding-box area of the resulting groups.
 func (n *node) split(minGroupSize int) (left, right *node) {
@@ -266,8 +947,8 @@ func assignGroup(e entry, left, right *node) {
 	rightEnlarged := boundingBox(rightBB, e.bb)
 
 	// first, choose the group that needs the least enlargement
-	leftDiff := leftEnlarged.size() - leftBB.size()
-	rightDiff := rightEnlarged.size() - rightBB.size()
+	leftDiff := enlargement(leftBB, e.bb)
+	rightDiff := enlargement(rightBB, e.bb)
 	if diff := leftDiff - rightDiff; diff < 0 {
 		assign(e, left)
 		return
@@ -285,6 +966,18 @@ func assignGroup(e entry, left, right *node) {
 		return
 	}
 
+	// next, choose the group that needs the least margin enlargement, which
+	// separates groups of zero-area entries such as points
+	leftDiff = leftEnlarged.margin() - leftBB.margin()
+	rightDiff = rightEnlarged.margin() - rightBB.margin()
+	if diff := leftDiff - rightDiff; diff < 0 {
+		assign(e, left)
+		return
+	} else if diff > 0 {
+		assign(e, right)
+		return
+	}
+
 	// next, choose the group with fewer entries
 	if diff := len(left.entries) - len(right.entries); diff <= 0 {
 		assign(e, left)
@@ -296,12 +989,14 @@ func assignGroup(e entry, left, right *node) {
 // pickSeeds chooses two child entries of n to start a split.
 func (n *node) pickSeeds() (int, int) {
 	left, right := 0, 1
-	maxWastedSpace := -1.0
+	maxWastedSpace, maxWastedMargin := -1.0, -1.0
 	for i, e1 := range n.entries {
 		for j, e2 := range n.entries[i+1:] {
-			d := boundingBox(e1.bb, e2.bb).size() - e1.bb.size() - e2.bb.size()
-			if d > maxWastedSpace {
-				maxWastedSpace = d
+			bb := boundingBox(e1.bb, e2.bb)
+			d := bb.size() - e1.bb.size() - e2.bb.size()
+			m := bb.margin() - e1.bb.margin() - e2.bb.margin()
+			if d > maxWastedSpace || (d == maxWastedSpace && m > maxWastedMargin) {
+				maxWastedSpace, maxWastedMargin = d, m
 				left, right = i, j+i+1
 			}
 		}
@@ -311,15 +1006,18 @@ func (n *node) pickSeeds() (int, int) {
 
 // pickNext chooses an entry to be added to an entry group.
 func pickNext(left, right *node, entries []entry) (next int) {
-	maxDiff := -1.0
+	maxDiff, maxMarginDiff := -1.0, -1.0
 	leftBB := left.computeBoundingBox()
 	rightBB := right.computeBoundingBox()
 	for i, e := range entries {
-		d1 := boundingBox(leftBB, e.bb).size() - leftBB.size()
-		d2 := boundingBox(rightBB, e.bb).size() - rightBB.size()
+		d1 := enlargement(leftBB, e.bb)
+		d2 := enlargement(rightBB, e.bb)
 		d := math.Abs(d1 - d2)
-		if d > maxDiff {
-			maxDiff = d
+		m1 := boundingBox(leftBB, e.bb).margin() - leftBB.margin()
+		m2 := boundingBox(rightBB, e.bb).margin() - rightBB.margin()
+		m := math.Abs(m1 - m2)
+		if d > maxDiff || (d == maxDiff && m > maxMarginDiff) {
+			maxDiff, maxMarginDiff = d, m
 			next = i
 		}
 	}
@@ -329,21 +1027,60 @@ func pickNext(left, right *node, entries []entry) (next int) {
 // Deletion
 
 // Delete removes an object from the tree.  If the object is not found, returns
-// false, otherwise returns true. Uses the default comparator when checking
-// equality.
+// false, otherwise returns true. Objects are compared as configured by Equal.
 //
 // Implemented per Section 3.3 of "R-trees: A Dynamic Index Structure for
 // Spatial Searching" by A. Guttman, Proceedings of ACM SIGMOD, p. 47-57, 1984.
 func (tree *Rtree) Delete(obj Spatial) bool {
-	return tree.DeleteWithComparator(obj, defaultComparator)
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if !tree.delete(obj, obj.Bounds(), tree.comparator()) {
+		return false
+	}
+	tree.deleted(1)
+	return true
 }
 
 // DeleteWithComparator removes an object from the tree using a custom
 // comparator for evaluating equalness. This is useful when you want to remove
 // an object from a tree but don't have a pointer to the original object
-// anymore.
+// anymore.  A nil cmp compares objects as configured by Equal.
 func (tree *Rtree) DeleteWithComparator(obj Spatial, cmp Comparator) bool {
-	n := tree.findLeaf(tree.root, obj, cmp)
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if cmp == nil {
+		cmp = tree.comparator()
+	}
+	if !tree.delete(obj, obj.Bounds(), cmp) {
+		return false
+	}
+	tree.deleted(1)
+	return true
+}
+
+// Update moves obj, which was inserted into the tree while its bounds were
+// oldBounds, to its current bounds.  If obj is not found at oldBounds, returns
+// false and leaves the tree unchanged.  Objects are compared as configured by
+// Equal.
+//
+// The Bounds method of obj must return a new *BBox after the move rather than
+// modify the old one in place.
+func (tree *Rtree) Update(obj Spatial, oldBounds *BBox) bool {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if !tree.delete(obj, oldBounds, tree.comparator()) {
+		return false
+	}
+	tree.reinserted = nil
+	tree.insert(entry{obj.Bounds(), nil, obj}, 1)
+	tree.size++
+	return true
+}
+
+// delete removes obj, which is stored in the tree with bounds bb.
+func (tree *Rtree) delete(obj Spatial, bb *BBox, cmp Comparator) bool {
+	tree.reinserted = nil
+	n := tree.findLeafBounds(tree.root, bb, obj, cmp)
 	if n == nil {
 		return false
 	}
@@ -357,28 +1094,40 @@ func (tree *Rtree) DeleteWithComparator(obj Spatial, cmp Comparator) bool {
 	if ind < 0 {
 		return false
 	}
+	tree.removeEntry(n, ind)
+	return true
+}
 
-	n.entries = append(n.entries[:ind], n.entries[ind+1:]...)
+// removeEntry removes the object entry at index i of the leaf n.
+func (tree *Rtree) removeEntry(n *node, i int) {
+	n.entries = append(n.entries[:i], n.entries[i+1:]...)
 
 	tree.condenseTree(n)
 	tree.size--
+	tree.extentValid = false
 
-	if !tree.root.leaf && len(tree.root.entries) == 1 {
+	for !tree.root.leaf && len(tree.root.entries) == 1 {
 		tree.root = tree.root.entries[0].child
+		tree.root.parent = nil
+		tree.height--
 	}
-
-	return true
 }
 
 // findLeaf finds the leaf node containing obj.
 func (tree *Rtree) findLeaf(n *node, obj Spatial, cmp Comparator) *node {
+	return tree.findLeafBounds(n, obj.Bounds(), obj, cmp)
+}
+
+// findLeafBounds finds the leaf node containing obj, searching only the
+// subtrees whose bounding boxes contain bb.
+func (tree *Rtree) findLeafBounds(n *node, bb *BBox, obj Spatial, cmp Comparator) *node {
 	if n.leaf {
 		return n
 	}
 	// if not leaf, search all candidate subtrees
 	for _, e := range n.entries {
-		if e.bb.containsBBox(obj.Bounds()) {
-			leaf := tree.findLeaf(e.child, obj, cmp)
+		if e.bb.containsBBox(bb) {
+			leaf := tree.findLeafBounds(e.child, bb, obj, cmp)
 			if leaf == nil {
 				continue
 			}
@@ -398,7 +1147,7 @@ func (tree *Rtree) condenseTree(n *node) {
 	deleted := []*node{}
 
 	for n != tree.root {
-		if len(n.entries) < tree.MinChildren {
+		if len(n.entries) < tree.minChildren(n.level) {
 			// remove n from parent entries
 			entries := []entry{}
 			for _, e := range n.parent.entries {
@@ -423,21 +1172,158 @@ func (tree *Rtree) condenseTree(n *node) {
 	}
 
 	for _, n := range deleted {
-		// reinsert entry so that it will remain at the same level as before
-		e := entry{n.computeBoundingBox(), n, nil}
-		tree.insert(e, n.level+1)
+		// reinsert the entries of n at n's level, rather than n itself, so
+		// that no node is left underfull
+		for _, e := range n.entries {
+			tree.insert(e, n.level)
+		}
 	}
 }
 
+// DeleteWithin removes all objects whose bounds lie entirely inside bb and
+// returns the number removed.  The tree is condensed once, after all of the
+// objects have been removed.
+func (tree *Rtree) DeleteWithin(bb *BBox) int {
+	return tree.deleteRegion(bb, true)
+}
+
+// DeleteIntersecting removes all objects that intersect bb, as found by
+// SearchIntersect, and returns the number removed.  The tree is condensed
+// once, after all of the objects have been removed.
+func (tree *Rtree) DeleteIntersecting(bb *BBox) int {
+	return tree.deleteRegion(bb, false)
+}
+
+func (tree *Rtree) deleteRegion(bb *BBox, contained bool) int {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	removed, orphans := tree.removeRegion(tree.root, bb, contained, nil)
+	if removed == 0 {
+		return 0
+	}
+	remaining := tree.size - removed
+	tree.extentValid = false
+	if !tree.root.leaf && len(tree.root.entries) == 0 {
+		tree.clear()
+	}
+	for !tree.root.leaf && len(tree.root.entries) == 1 {
+		tree.root = tree.root.entries[0].child
+		tree.root.parent = nil
+		tree.height--
+	}
+
+	// reinsert the objects from underfull nodes
+	tree.size = remaining - len(orphans)
+	for _, e := range orphans {
+		tree.reinserted = nil
+		tree.insert(e, 1)
+		tree.size++
+	}
+	tree.deleted(removed)
+	return removed
+}
+
+// removeRegion removes the objects below n that lie inside bb, or intersect
+// it if contained is false, and returns how many it removed.  Children left
+// underfull are detached, and the objects remaining below them are appended
+// to orphans.
+func (tree *Rtree) removeRegion(n *node, bb *BBox, contained bool, orphans []entry) (int, []entry) {
+	removed := 0
+	kept := n.entries[:0]
+	for _, e := range n.entries {
+		if n.leaf {
+			mode := tree.boundary
+			if (contained && mode.ContainsBBox(bb, e.bb)) || (!contained && mode.Overlaps(e.bb, bb)) {
+				removed++
+				continue
+			}
+		} else if tree.mayIntersect(e, bb) {
+			r, o := tree.removeRegion(e.child, bb, contained, orphans)
+			removed, orphans = removed+r, o
+			if r > 0 && len(e.child.entries) < tree.minChildren(e.child.level) {
+				orphans = tree.leafEntries(e.child, orphans)
+				continue
+			}
+			if r > 0 {
+				e.bb = e.child.computeBoundingBox()
+			}
+		}
+		kept = append(kept, e)
+	}
+	n.entries = kept
+	return removed, orphans
+}
+
 // Searching
 
-// SearchIntersect returns all objects that intersect the specified rectangle.
+// SearchIntersect returns all objects that intersect the specified rectangle,
+// as decided by the tree's BoundaryMode.  The order of the results is
+// unspecified and may change as the tree is modified; use
+// SearchIntersectSorted for a stable order.
+//
 // Implemented per Section 3.1 of "R-trees: A Dynamic Index Structure for
 // Spatial Searching" by A. Guttman, Proceedings of ACM SIGMOD, p. 47-57, 1984.
 func (tree *Rtree) SearchIntersect(bb *BBox, filters ...Filter) []Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
 	return tree.searchIntersect([]Spatial{}, tree.root, bb, filters)
 }
 
+// SearchIntersectUnique is like SearchIntersect, but returns each object only
+// once even if it is stored in tree more than once, keeping the first of any
+// results that are equal as configured by Equal.  Deduplication compares each
+// result with those kept before it, so it takes time quadratic in the number
+// of results.
+func (tree *Rtree) SearchIntersectUnique(bb *BBox, filters ...Filter) []Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	results := tree.searchIntersect([]Spatial{}, tree.root, bb, filters)
+	eq := tree.comparator()
+	unique := results[:0]
+	for _, obj := range results {
+		dup := false
+		for _, kept := range unique {
+			if eq(kept, obj) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			unique = append(unique, obj)
+		}
+	}
+	return unique
+}
+
+// SearchIntersectSorted returns all objects that intersect the specified
+// rectangle, sorted by less.  Trees holding the same objects return them in
+// the same order regardless of how they were built, as long as less defines
+// a strict total order on them.
+func (tree *Rtree) SearchIntersectSorted(bb *BBox, less func(a, b Spatial) bool) []Spatial {
+	results := tree.SearchIntersect(bb)
+	sort.SliceStable(results, func(i, j int) bool {
+		return less(results[i], results[j])
+	})
+	return results
+}
+
+// SearchIntersectSortedByDist returns all objects that intersect the
+// specified rectangle, sorted by increasing distance of their bounds from p.
+// Objects at the same distance keep the order SearchIntersect gives them.
+func (tree *Rtree) SearchIntersectSortedByDist(bb *BBox, p Point) []Spatial {
+	results := tree.SearchIntersect(bb)
+	items := make([]neighbor, len(results))
+	for i, obj := range results {
+		items[i] = neighbor{obj, obj.Bounds().DistToPoint(p)}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].dist < items[j].dist })
+	for i, item := range items {
+		results[i] = item.obj
+	}
+	return results
+}
+
 // SearchIntersectWithLimit is similar to SearchIntersect, but returns
 // immediately when the first k results are found. A negative k behaves exactly
 // like SearchIntersect and returns all the results.
@@ -455,7 +1341,7 @@ func (tree *Rtree) SearchIntersectWithLimit(k int, bb *BBox) []Spatial {
 
 func (tree *Rtree) searchIntersect(results []Spatial, n *node, bb *BBox, filters []Filter) []Spatial {
 	for _, e := range n.entries {
-		if intersect(e.bb, bb) == nil {
+		if !tree.mayIntersect(e, bb) {
 			continue
 		}
 
@@ -476,13 +1362,398 @@ func (tree *Rtree) searchIntersect(results []Spatial, n *node, bb *BBox, filters
 	return results
 }
 
-// NearestNeighbor returns the closest object to the specified point.
+// CountIntersect returns the number of objects that intersect the specified
+// rectangle, as len(SearchIntersect(bb)) would, without collecting them.
+func (tree *Rtree) CountIntersect(bb *BBox) int {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.countIntersect(tree.root, bb)
+}
+
+func (tree *Rtree) countIntersect(n *node, bb *BBox) int {
+	count := 0
+	for _, e := range n.entries {
+		if !tree.mayIntersect(e, bb) {
+			continue
+		}
+		if n.leaf {
+			count++
+		} else {
+			count += tree.countIntersect(e.child, bb)
+		}
+	}
+	return count
+}
+
+// AnyIntersect reports whether any object intersects the specified
+// rectangle, as len(SearchIntersect(bb)) > 0 would, stopping at the first one
+// found.
+func (tree *Rtree) AnyIntersect(bb *BBox) bool {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.anyIntersect(tree.root, bb)
+}
+
+func (tree *Rtree) anyIntersect(n *node, bb *BBox) bool {
+	for _, e := range n.entries {
+		if !tree.mayIntersect(e, bb) {
+			continue
+		}
+		if n.leaf || tree.anyIntersect(e.child, bb) {
+			return true
+		}
+	}
+	return false
+}
+
+// BestOverlap returns the object whose bounds share the largest area with
+// bb, along with that area.  If no object overlaps bb with positive area, it
+// returns nil and 0.
+func (tree *Rtree) BestOverlap(bb *BBox) (Spatial, float64) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.bestOverlap(tree.root, bb, nil, 0)
+}
+
+func (tree *Rtree) bestOverlap(n *node, bb *BBox, best Spatial, area float64) (Spatial, float64) {
+	for _, e := range n.entries {
+		// the overlap of a subtree's box bounds that of anything below it
+		a := overlapArea(e.bb, bb)
+		if a <= area {
+			continue
+		}
+		if n.leaf {
+			best, area = e.obj, a
+		} else {
+			best, area = tree.bestOverlap(e.child, bb, best, area)
+		}
+	}
+	return best, area
+}
+
+// SearchIntersectVisit calls visit for each object that intersects the
+// specified rectangle, without collecting the results into a slice.  The
+// search stops as soon as visit returns false.  visit is called while the
+// tree is locked, so it must not call methods of the tree.
+func (tree *Rtree) SearchIntersectVisit(bb *BBox, visit func(Spatial) bool) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	tree.searchIntersectVisit(tree.root, bb, visit)
+}
+
+// searchIntersectVisit reports whether the search should continue.
+func (tree *Rtree) searchIntersectVisit(n *node, bb *BBox, visit func(Spatial) bool) bool {
+	for _, e := range n.entries {
+		if !tree.mayIntersect(e, bb) {
+			continue
+		}
+
+		if !n.leaf {
+			if !tree.searchIntersectVisit(e.child, bb, visit) {
+				return false
+			}
+			continue
+		}
+
+		if !visit(e.obj) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchContained returns all objects that lie entirely inside the specified
+// rectangle, excluding those that merely intersect it.
+func (tree *Rtree) SearchContained(bb *BBox) []Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.searchContained([]Spatial{}, tree.root, bb)
+}
+
+func (tree *Rtree) searchContained(results []Spatial, n *node, bb *BBox) []Spatial {
+	for _, e := range n.entries {
+		if !n.leaf {
+			if touches(e.bb, bb) {
+				results = tree.searchContained(results, e.child, bb)
+			}
+			continue
+		}
+
+		if tree.boundary.ContainsBBox(bb, e.bb) {
+			results = append(results, e.obj)
+		}
+	}
+	return results
+}
+
+// SearchContainingPoint returns all objects whose bounds contain p, including
+// those that have p on their boundary unless the tree's BoundaryMode
+// excludes it.
+func (tree *Rtree) SearchContainingPoint(p Point) []Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.searchContainingPoint([]Spatial{}, tree.root, p)
+}
+
+func (tree *Rtree) searchContainingPoint(results []Spatial, n *node, p Point) []Spatial {
+	for _, e := range n.entries {
+		if !e.bb.containsPoint(p) {
+			continue
+		}
+
+		if !n.leaf {
+			results = tree.searchContainingPoint(results, e.child, p)
+			continue
+		}
+
+		if tree.boundary.ContainsPoint(e.bb, p) {
+			results = append(results, e.obj)
+		}
+	}
+	return results
+}
+
+// SearchWithin returns all objects whose bounds lie at least partially within
+// the specified distance of p.  Nothing lies within a negative distance.
+func (tree *Rtree) SearchWithin(p Point, radius float64) []Spatial {
+	if radius < 0 {
+		return []Spatial{}
+	}
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	// minDist is squared, so compare against the squared radius.
+	return tree.searchWithin([]Spatial{}, tree.root, p, radius*radius)
+}
+
+func (tree *Rtree) searchWithin(results []Spatial, n *node, p Point, radius2 float64) []Spatial {
+	for _, e := range n.entries {
+		if p.minDist(e.bb) > radius2 {
+			continue
+		}
+
+		if !n.leaf {
+			results = tree.searchWithin(results, e.child, p, radius2)
+			continue
+		}
+
+		results = append(results, e.obj)
+	}
+	return results
+}
+
+// Query returns all objects selected by a custom search, in unspecified
+// order.  prune is called with the bounding box of each entry reached, both
+// of subtrees and of objects, and returns true to skip it; accept is then
+// called with each object not pruned and returns true to include it.  A nil
+// prune skips nothing and a nil accept includes every object.  prune must
+// skip a subtree only if it would skip every object below it, which holds
+// for the usual tests of a box against a region when they are applied to
+// closed boxes.  The other searches are special cases; for example,
+// SearchWithin(p, r) is
+//
+//	tree.Query(func(bb *BBox) bool { return bb.DistToPoint(p) > r }, nil)
+//
+// prune and accept are called while the tree is locked, so they must not
+// call methods of the tree.
+func (tree *Rtree) Query(prune func(bb *BBox) bool, accept func(Spatial) bool) []Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.query([]Spatial{}, tree.root, prune, accept)
+}
+
+func (tree *Rtree) query(results []Spatial, n *node, prune func(bb *BBox) bool, accept func(Spatial) bool) []Spatial {
+	for _, e := range n.entries {
+		if prune != nil && prune(e.bb) {
+			continue
+		}
+
+		if !n.leaf {
+			results = tree.query(results, e.child, prune, accept)
+			continue
+		}
+
+		if accept == nil || accept(e.obj) {
+			results = append(results, e.obj)
+		}
+	}
+	return results
+}
+
+// SpatialJoin calls emit for every pair of objects x from a and y from b whose
+// bounding boxes intersect under the BoundaryMode of a.  Both trees are
+// descended together, so that only pairs of subtrees with intersecting
+// bounding boxes are compared.
+//
+// Implemented per "Efficient Processing of Spatial Joins Using R-trees" by
+// T. Brinkhoff, H.P. Kriegel and B. Seeger, Proceedings of ACM SIGMOD,
+// pages 237-246, 1993.
+//
+// emit is called while both trees are locked, so it must not call methods of
+// either tree.  The trees are locked in an order that does not depend on the
+// order of the arguments, so that concurrent joins of the same two trees
+// cannot deadlock.
+func SpatialJoin(a, b *Rtree, emit func(x, y Spatial)) {
+	first, second := a, b
+	if reflect.ValueOf(b).Pointer() < reflect.ValueOf(a).Pointer() {
+		first, second = b, a
+	}
+	first.mu.RLock()
+	defer first.mu.RUnlock()
+	if second != first {
+		second.mu.RLock()
+		defer second.mu.RUnlock()
+	}
+	if len(a.root.entries) == 0 || len(b.root.entries) == 0 {
+		return
+	}
+	ea := entry{bb: a.root.computeBoundingBox(), child: a.root}
+	eb := entry{bb: b.root.computeBoundingBox(), child: b.root}
+	spatialJoin(a.boundary, ea, eb, emit)
+}
+
+// spatialJoin joins the objects below e with those below f under mode.
+func spatialJoin(mode BoundaryMode, e, f entry, emit func(x, y Spatial)) {
+	if e.child == nil && f.child == nil && !mode.Overlaps(e.bb, f.bb) {
+		return
+	}
+	if !touches(e.bb, f.bb) {
+		return
+	}
+	switch {
+	case e.child == nil && f.child == nil:
+		emit(e.obj, f.obj)
+	case e.child != nil && f.child != nil && e.child.level == f.child.level:
+		for _, g := range e.child.entries {
+			for _, h := range f.child.entries {
+				spatialJoin(mode, g, h, emit)
+			}
+		}
+	case e.child == nil || (f.child != nil && f.child.level > e.child.level):
+		// descend the taller side until the levels match
+		for _, h := range f.child.entries {
+			spatialJoin(mode, e, h, emit)
+		}
+	default:
+		for _, g := range e.child.entries {
+			spatialJoin(mode, g, f, emit)
+		}
+	}
+}
+
+// ClosePairs returns every pair of distinct objects stored in tree whose
+// bounds are at most d apart, as measured by BBoxDist, each pair once and in
+// unspecified order.  The tree is joined with itself, so that only pairs of
+// subtrees whose bounding boxes are within d of each other are compared.
+func (tree *Rtree) ClosePairs(d float64) [][2]Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return closePairsWithin(tree.root, d, [][2]Spatial{})
+}
+
+// closePairsWithin appends to pairs the close pairs of objects below n.
+func closePairsWithin(n *node, d float64, pairs [][2]Spatial) [][2]Spatial {
+	for i, e := range n.entries {
+		if !n.leaf {
+			pairs = closePairsWithin(e.child, d, pairs)
+		}
+		for _, f := range n.entries[i+1:] {
+			pairs = closePairsBetween(e, f, d, pairs)
+		}
+	}
+	return pairs
+}
+
+// closePairsBetween appends to pairs the close pairs of an object below e and
+// an object below f, which are entries at the same level.
+func closePairsBetween(e, f entry, d float64, pairs [][2]Spatial) [][2]Spatial {
+	if BBoxDist(e.bb, f.bb) > d {
+		return pairs
+	}
+	if e.child == nil {
+		return append(pairs, [2]Spatial{e.obj, f.obj})
+	}
+	for _, g := range e.child.entries {
+		for _, h := range f.child.entries {
+			pairs = closePairsBetween(g, h, d, pairs)
+		}
+	}
+	return pairs
+}
+
+// NearestNeighbor returns the closest object to the specified point.  The
+// distance to an object is measured to the nearest point of its bounds, not
+// to its center, so an object whose bounds contain the point is at distance
+// zero.
+//
 // Implemented per "Nearest Neighbor Queries" by Roussopoulos et al
 func (tree *Rtree) NearestNeighbor(p Point) Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
 	obj, _ := tree.nearestNeighbor(p, tree.root, math.MaxFloat64, nil)
 	return obj
 }
 
+// NearestNeighborDist returns the closest object to the specified point along
+// with its distance from the point, which is zero if the point lies within
+// the object's bounds.  If tree is empty, it returns nil and +Inf.
+func (tree *Rtree) NearestNeighborDist(p Point) (Spatial, float64) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	obj, d := tree.nearestNeighbor(p, tree.root, math.MaxFloat64, nil)
+	if obj == nil {
+		return nil, math.Inf(1)
+	}
+	return obj, d
+}
+
+// FarthestNeighbor returns the object farthest from the specified point,
+// along with its distance from the point.  As for NearestNeighbor, the
+// distance to an object is measured to the nearest point of its bounds.  If
+// tree is empty, it returns nil and -Inf.
+//
+// Subtrees are searched in decreasing order of the greatest distance from
+// the point to their bounding boxes, and skipped once that distance cannot
+// beat the farthest object found so far.
+func (tree *Rtree) FarthestNeighbor(p Point) (Spatial, float64) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	obj, d := tree.farthestNeighbor(p, tree.root, -1, nil)
+	if obj == nil {
+		return nil, math.Inf(-1)
+	}
+	return obj, math.Sqrt(d)
+}
+
+// farthestNeighbor returns the object under n farthest from p if its squared
+// distance exceeds d, and otherwise farthest and d.
+func (tree *Rtree) farthestNeighbor(p Point, n *node, d float64, farthest Spatial) (Spatial, float64) {
+	if n.leaf {
+		for _, e := range n.entries {
+			if dist := p.minDist(e.bb); dist > d {
+				d = dist
+				farthest = e.obj
+			}
+		}
+		return farthest, d
+	}
+
+	branches := make([]entry, len(n.entries))
+	dists := make([]float64, len(n.entries))
+	for i, e := range n.entries {
+		branches[i] = e
+		// negated so that sorting puts the farthest first
+		dists[i] = -p.maxDist(e.bb)
+	}
+	sort.Sort(entrySlice{branches, dists, p})
+	for i, e := range branches {
+		if -dists[i] <= d {
+			break
+		}
+		farthest, d = tree.farthestNeighbor(p, e.child, d, farthest)
+	}
+	return farthest, d
+}
+
 // utilities for sorting slices of entries
 
 type entrySlice struct {
@@ -516,7 +1787,9 @@ func sortEntries(p Point, entries []entry) ([]entry, []float64) {
 func pruneEntries(p Point, entries []entry, minDists []float64) []entry {
 	minMinMaxDist := math.MaxFloat64
 	for i := range entries {
-		minMaxDist := p.minMaxDist(entries[i].bb)
+		// minMaxDist is never less than minDist, but rounding can make it
+		// so for degenerate boxes, where the two are equal
+		minMaxDist := math.Max(p.minMaxDist(entries[i].bb), minDists[i])
 		if minMaxDist < minMinMaxDist {
 			minMinMaxDist = minMaxDist
 		}
@@ -555,55 +1828,125 @@ func (tree *Rtree) nearestNeighbor(p Point, n *node, d float64, nearest Spatial)
 	return nearest, d
 }
 
-// NearestNeighbors gets the closest Spatials to the Point.
-func (tree *Rtree) NearestNeighbors(k int, p Point) []Spatial {
-	dists := make([]float64, k)
-	objs := make([]Spatial, k)
-	for i := 0; i < k; i++ {
-		dists[i] = math.MaxFloat64
-		objs[i] = nil
+// PopNearest removes the closest object to the specified point from tree and
+// returns it, as NearestNeighbor and Delete would together, or returns false
+// if tree is empty.  The object is removed from where it was found, so its
+// type need not work with the tree's Equal function.
+func (tree *Rtree) PopNearest(p Point) (Spatial, bool) {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	leaf, i, _ := tree.nearestEntry(p, tree.root, math.MaxFloat64, nil, -1)
+	if leaf == nil {
+		return nil, false
 	}
-	objs, _ = tree.nearestNeighbors(k, p, tree.root, dists, objs)
-	return objs
+	obj := leaf.entries[i].obj
+	tree.reinserted = nil
+	tree.removeEntry(leaf, i)
+	tree.deleted(1)
+	return obj, true
 }
 
-// insert obj into nearest and return the first k elements in increasing order.
-func insertNearest(k int, dists []float64, nearest []Spatial, dist float64, obj Spatial) ([]float64, []Spatial) {
-	i := 0
-	for i < k && dist >= dists[i] {
-		i++
+// nearestEntry finds the object entry below n that nearestNeighbor would,
+// returning the leaf holding it and its index there, or leaf and i unchanged
+// if none is closer than d, together with its distance from p.
+func (tree *Rtree) nearestEntry(p Point, n *node, d float64, leaf *node, i int) (*node, int, float64) {
+	if n.leaf {
+		for j, e := range n.entries {
+			if dist := math.Sqrt(p.minDist(e.bb)); dist < d {
+				leaf, i, d = n, j, dist
+			}
+		}
+		return leaf, i, d
 	}
-	if i >= k {
-		return dists, nearest
+	branches, dists := sortEntries(p, n.entries)
+	for _, e := range pruneEntries(p, branches, dists) {
+		leaf, i, d = tree.nearestEntry(p, e.child, d, leaf, i)
 	}
+	return leaf, i, d
+}
 
-	left, right := dists[:i], dists[i:k-1]
-	updatedDists := make([]float64, k)
-	copy(updatedDists, left)
-	updatedDists[i] = dist
-	copy(updatedDists[i+1:], right)
+// NearestNeighborFiltered returns the closest object to the specified point
+// for which accept returns true, or nil if there is none.  accept is called
+// while the tree is locked, so it must not call methods of the tree.
+func (tree *Rtree) NearestNeighborFiltered(p Point, accept func(Spatial) bool) Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	obj, _ := tree.nearestNeighborFiltered(p, tree.root, math.MaxFloat64, nil, accept)
+	return obj
+}
 
-	leftObjs, rightObjs := nearest[:i], nearest[i:k-1]
-	updatedNearest := make([]Spatial, k)
-	copy(updatedNearest, leftObjs)
-	updatedNearest[i] = obj
-	copy(updatedNearest[i+1:], rightObjs)
+func (tree *Rtree) nearestNeighborFiltered(p Point, n *node, d float64, nearest Spatial, accept func(Spatial) bool) (Spatial, float64) {
+	if n.leaf {
+		for _, e := range n.entries {
+			dist := math.Sqrt(p.minDist(e.bb))
+			if dist < d && accept(e.obj) {
+				d = dist
+				nearest = e.obj
+			}
+		}
+		return nearest, d
+	}
 
-	return updatedDists, updatedNearest
+	// The object that minMaxDist guarantees in a branch may be rejected, so
+	// branches can only be pruned by their distance to the best accepted
+	// object found so far.
+	branches, dists := sortEntries(p, n.entries)
+	for i, e := range branches {
+		if math.Sqrt(dists[i]) >= d {
+			break
+		}
+		nearest, d = tree.nearestNeighborFiltered(p, e.child, d, nearest, accept)
+	}
+	return nearest, d
 }
 
-func (tree *Rtree) nearestNeighbors(k int, p Point, n *node, dists []float64, nearest []Spatial) ([]Spatial, []float64) {
+// NearestNeighbors gets the k closest Spatials to the Point, sorted by
+// increasing distance.  If tree holds fewer than k objects, the result is
+// padded with nils.
+func (tree *Rtree) NearestNeighbors(k int, p Point) []Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	h := NewNeighborHeap(k)
+	tree.nearestNeighbors(p, math.Inf(1), Edge, tree.root, h)
+	objs, _ := h.Sorted()
+	for len(objs) < k {
+		objs = append(objs, nil)
+	}
+	return objs
+}
+
+// NearestNeighborsWithin gets at most k of the closest Spatials to the Point
+// whose bounds are within maxDist of it, sorted by increasing distance.  The
+// result is shorter than k if fewer objects lie within maxDist.
+func (tree *Rtree) NearestNeighborsWithin(k int, p Point, maxDist float64) []Spatial {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	h := NewNeighborHeap(k)
+	tree.nearestNeighbors(p, maxDist, Edge, tree.root, h)
+	objs, _ := h.Sorted()
+	return objs
+}
+
+// nearestNeighbors pushes the objects under n within maxDist of p, measured
+// as mode selects, into h, skipping subtrees that cannot hold anything closer
+// than h's cutoff.  Since the center of a box lies within it, the distance to
+// a subtree's box bounds the distance to anything below it in either mode.
+func (tree *Rtree) nearestNeighbors(p Point, maxDist float64, mode DistanceMode, n *node, h *NeighborHeap) {
 	if n.leaf {
 		for _, e := range n.entries {
-			dist := math.Sqrt(p.minDist(e.bb))
-			dists, nearest = insertNearest(k, dists, nearest, dist, e.obj)
+			if dist := mode.dist(p, e.bb); dist <= maxDist {
+				h.Push(e.obj, dist)
+			}
 		}
-	} else {
-		branches, branchDists := sortEntries(p, n.entries)
-		branches = pruneEntries(p, branches, branchDists)
-		for _, e := range branches {
-			nearest, dists = tree.nearestNeighbors(k, p, e.child, dists, nearest)
+		return
+	}
+
+	branches, branchDists := sortEntries(p, n.entries)
+	for i, e := range branches {
+		// minDist is squared, as is the cutoff it is compared against
+		if branchDists[i] > maxDist*maxDist || math.Sqrt(branchDists[i]) >= h.MaxDist() {
+			break
 		}
+		tree.nearestNeighbors(p, maxDist, mode, e.child, h)
 	}
-	return nearest, dists
 }
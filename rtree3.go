@@ -0,0 +1,118 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Spatial3 is an interface for objects that can be stored in an Rtree3 and
+// queried.
+type Spatial3 interface {
+	Bounds() *BBox3
+}
+
+// Rtree3 is an R-tree over 3-dimensional space, for data such as point
+// clouds.  It supports a subset of the operations of Rtree, using Guttman's
+// quadratic split, and is likewise safe for concurrent use.
+type Rtree3 struct {
+	MinChildren int
+	MaxChildren int
+
+	// mu guards the tree below it.
+	mu sync.RWMutex
+	basicTree[*BBox3, Spatial3]
+}
+
+// node3 represents a tree node of an Rtree3.
+type node3 = basicNode[*BBox3, Spatial3]
+
+// entry3 represents a spatial index record stored in a node3.
+type entry3 = basicEntry[*BBox3, Spatial3]
+
+// NewTree3 creates a new 3-dimensional R-tree instance.
+func NewTree3(MinChildren, MaxChildren int) *Rtree3 {
+	tree := &Rtree3{MinChildren: MinChildren, MaxChildren: MaxChildren}
+	tree.clear()
+	return tree
+}
+
+// Size returns the number of objects currently stored in tree.
+func (tree *Rtree3) Size() int {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.size
+}
+
+// Insert inserts a spatial object into the tree.
+func (tree *Rtree3) Insert(obj Spatial3) {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	tree.insert(entry3{bb: obj.Bounds(), obj: obj}, tree.MinChildren, tree.MaxChildren)
+	tree.size++
+}
+
+// Delete removes an object from the tree and reports whether it was found.
+// Objects are compared with ==, so values of a type that == cannot compare,
+// such as a struct containing a slice, are never found; store pointers to
+// them instead.
+func (tree *Rtree3) Delete(obj Spatial3) bool {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	return tree.delete(obj, obj.Bounds(), tree.MinChildren, tree.MaxChildren)
+}
+
+// SearchIntersect returns all objects that intersect the specified box,
+// including those that only touch it, as for the Closed BoundaryMode, in
+// unspecified order.
+func (tree *Rtree3) SearchIntersect(bb *BBox3) []Spatial3 {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	return tree.search([]Spatial3{}, tree.root, bb)
+}
+
+// SearchActive returns all objects that intersect region at some time during
+// the specified interval, in unspecified order, for a tree whose objects have
+// bounds made by BBox3T, with time as the third axis.
+func (tree *Rtree3) SearchActive(region *BBox, during Interval) []Spatial3 {
+	return tree.SearchIntersect(BBox3T{region, during}.BBox3())
+}
+
+// NearestNeighbor returns the closest object to the specified point, or nil
+// if the tree is empty.
+func (tree *Rtree3) NearestNeighbor(p PointZ) Spatial3 {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+	obj, _ := tree.nearestNeighbor(p, tree.root, math.Inf(1), nil)
+	return obj
+}
+
+// nearestNeighbor searches the subtree rooted at n for an object closer to p
+// than d, the squared distance of the nearest object found so far.
+func (tree *Rtree3) nearestNeighbor(p PointZ, n *node3, d float64, nearest Spatial3) (Spatial3, float64) {
+	if n.leaf {
+		for _, e := range n.entries {
+			if dist := p.minDist(e.bb); dist < d {
+				d, nearest = dist, e.obj
+			}
+		}
+		return nearest, d
+	}
+
+	branches := make([]entry3, len(n.entries))
+	copy(branches, n.entries)
+	sort.Slice(branches, func(i, j int) bool {
+		return p.minDist(branches[i].bb) < p.minDist(branches[j].bb)
+	})
+	for _, e := range branches {
+		if p.minDist(e.bb) >= d {
+			break
+		}
+		nearest, d = tree.nearestNeighbor(p, e.child, d, nearest)
+	}
+	return nearest, d
+}
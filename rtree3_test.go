@@ -0,0 +1,138 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func (bb *BBox3) Bounds() *BBox3 {
+	return bb
+}
+
+func randomBBox3s(r *rand.Rand, n int) []Spatial3 {
+	objs := make([]Spatial3, n)
+	for i := range objs {
+		p := PointZ{r.Float64()*100 - 50, r.Float64()*100 - 50, r.Float64() * 20}
+		objs[i] = mustBBox3(p, r.Float64()*3, r.Float64()*3, r.Float64())
+	}
+	return objs
+}
+
+func TestRtree3(t *testing.T) {
+	r := rand.New(rand.NewSource(10))
+	objs := randomBBox3s(r, 400)
+	rt := NewTree3(3, 8)
+	if rt.NearestNeighbor(PointZ{}) != nil {
+		t.Errorf("expected no nearest neighbor in an empty tree")
+	}
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	if rt.Size() != len(objs) {
+		t.Errorf("expected size %d, got %d", len(objs), rt.Size())
+	}
+	verifyBasic(t, &rt.basicTree, rt.root, rt.MinChildren, rt.MaxChildren)
+
+	check := func(objs []Spatial3) {
+		for i := 0; i < 30; i++ {
+			p := PointZ{r.Float64()*100 - 50, r.Float64()*100 - 50, r.Float64() * 20}
+			q := p.ToBBox3(r.Float64() * 15)
+			found := rt.SearchIntersect(q)
+			expected := 0
+			for _, obj := range objs {
+				if intersect3(obj.Bounds(), q) != nil {
+					expected++
+				}
+			}
+			if len(found) != expected {
+				t.Errorf("expected %d results for %v, got %d", expected, q, len(found))
+			}
+
+			nearest := rt.NearestNeighbor(p)
+			for _, obj := range objs {
+				if p.minDist(obj.Bounds()) < p.minDist(nearest.Bounds()) {
+					t.Errorf("NearestNeighbor(%v) returned %v, but %v is closer", p, nearest, obj)
+				}
+			}
+		}
+	}
+	check(objs)
+
+	for _, obj := range objs[:300] {
+		if !rt.Delete(obj) {
+			t.Fatalf("failed to delete %v", obj)
+		}
+	}
+	if rt.Delete(objs[0]) {
+		t.Errorf("deleted %v twice", objs[0])
+	}
+	if rt.Size() != 100 {
+		t.Errorf("expected size 100, got %d", rt.Size())
+	}
+	verifyBasic(t, &rt.basicTree, rt.root, rt.MinChildren, rt.MaxChildren)
+	check(objs[300:])
+
+	for _, obj := range objs[300:] {
+		rt.Delete(obj)
+	}
+	if rt.Size() != 0 || len(rt.root.entries) != 0 {
+		t.Errorf("expected an empty tree, got size %d", rt.Size())
+	}
+}
+
+// sighting is an object seen in a region during a span of time.
+type sighting struct {
+	name  string
+	where *BBox
+	when  Interval
+}
+
+func (s *sighting) Bounds() *BBox3 {
+	return BBox3T{s.where, s.when}.BBox3()
+}
+
+func TestSearchActive(t *testing.T) {
+	r := rand.New(rand.NewSource(127))
+	rt := NewTree3(3, 8)
+	var sightings []*sighting
+	for i := 0; i < 500; i++ {
+		start := r.Float64() * 100
+		s := &sighting{
+			name:  fmt.Sprint(i),
+			where: mustBBox(Point{r.Float64() * 100, r.Float64() * 100}, []float64{r.Float64() * 5, r.Float64() * 5}),
+			when:  Interval{start, start + r.Float64()*10},
+		}
+		sightings = append(sightings, s)
+		rt.Insert(s)
+	}
+
+	region := mustBBox(Point{20, 20}, []float64{40, 40})
+	for _, during := range []Interval{{30, 40}, {0, 100}, {55.5, 55.5}, {200, 300}} {
+		results := rt.SearchActive(region, during)
+		found := map[*sighting]bool{}
+		for _, obj := range results {
+			found[obj.(*sighting)] = true
+		}
+		expected := 0
+		for _, s := range sightings {
+			active := Closed.Overlaps(s.where, region) && s.when.Overlaps(during)
+			if active {
+				expected++
+			}
+			if active != found[s] {
+				t.Errorf("during %v: expected sighting %s (%v during %v) found: %v", during, s.name, s.where, s.when, active)
+			}
+		}
+		if len(results) != expected {
+			t.Errorf("during %v: expected %d results, got %d", during, expected, len(results))
+		}
+	}
+	if results := rt.SearchActive(region, Interval{200, 300}); len(results) != 0 {
+		t.Errorf("expected no sightings after they all ended, got %d", len(results))
+	}
+}
@@ -1,12 +1,17 @@
 package rtree
 
 import (
+	"bytes"
 	"fmt"
 	"log"
+	"math"
 	"math/rand"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func (r *BBox) Bounds() *BBox {
@@ -101,8 +106,9 @@ var chooseLeafNodeTests = []struct {
 		1,
 	},
 	{
-		mustBBox(Point{-1.5, -1}, []float64{2.5025, 0.5}),
-		mustBBox(Point{1, 0.5}, []float64{0.815, 0.5}),
+		// both need 1.5 enlargement, but leaf 1 is smaller
+		mustBBox(Point{-3, -0.5}, []float64{2, 1}),
+		mustBBox(Point{1, -0.5}, []float64{1, 1}),
 		mustBBox(Point{4, -5}, []float64{0.9, 8}),
 		1,
 		"leaves tie",
@@ -746,6 +752,95 @@ func TestDeleteWithComparator(t *testing.T) {
 	}
 }
 
+// tagged is a Spatial value type that cannot be compared with ==.
+type tagged struct {
+	bb   *BBox
+	tags []string
+}
+
+func (t tagged) Bounds() *BBox {
+	return t.bb
+}
+
+func TestEqualOption(t *testing.T) {
+	sameTags := func(obj1, obj2 Spatial) bool {
+		t1, t2 := obj1.(tagged), obj2.(tagged)
+		return t1.bb.Equal(t2.bb, 0) && reflect.DeepEqual(t1.tags, t2.tags)
+	}
+	objs := make([]tagged, 40)
+	for i := range objs {
+		objs[i] = tagged{
+			mustBBox(Point{float64(i % 8), float64(i / 8)}, []float64{0.5, 0.5}),
+			[]string{fmt.Sprint(i)},
+		}
+	}
+
+	// without a custom equality, uncomparable objects are never found
+	plain := NewTree(2, 4)
+	for _, obj := range objs {
+		plain.Insert(obj)
+	}
+	if plain.Delete(objs[0]) {
+		t.Errorf("expected Delete to find no uncomparable object by default")
+	}
+	if plain.Size() != len(objs) {
+		t.Errorf("expected size %d, got %d", len(objs), plain.Size())
+	}
+
+	rt := NewTree(2, 4, Equal(sameTags))
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	if rt.InsertUnique(tagged{objs[3].bb, []string{"3"}}) {
+		t.Errorf("expected InsertUnique to find an equal object")
+	}
+	if _, ok := rt.DepthOf(tagged{objs[5].bb, []string{"5"}}); !ok {
+		t.Errorf("expected DepthOf to find an equal object")
+	}
+	if !rt.DeleteWithComparator(tagged{objs[7].bb, []string{"7"}}, nil) {
+		t.Errorf("expected DeleteWithComparator with a nil Comparator to use Equal")
+	}
+	rt.Insert(objs[7])
+	for i, obj := range objs {
+		// a copy with its own slice must match the stored object
+		cp := tagged{obj.bb, append([]string(nil), obj.tags...)}
+		if !rt.Delete(cp) {
+			t.Fatalf("failed to delete %v", obj.tags)
+		}
+		if rt.Delete(cp) {
+			t.Errorf("deleted %v twice", obj.tags)
+		}
+		if rt.Size() != len(objs)-i-1 {
+			t.Fatalf("expected size %d, got %d", len(objs)-i-1, rt.Size())
+		}
+		verify(t, rt.root)
+	}
+}
+
+func TestDefaultComparator(t *testing.T) {
+	bb := mustBBox(Point{0, 0}, []float64{1, 1})
+	if !defaultComparator(bb, bb) {
+		t.Errorf("expected a box to equal itself")
+	}
+	if defaultComparator(bb, mustBBox(Point{0, 0}, []float64{1, 1})) {
+		t.Errorf("expected distinct pointers to differ")
+	}
+	p1, p2 := place{"a", 1, 2}, place{"a", 1, 2}
+	if !defaultComparator(p1, p2) {
+		t.Errorf("expected equal values to be equal")
+	}
+	if defaultComparator(p1, place{"b", 1, 2}) {
+		t.Errorf("expected different values to differ")
+	}
+	obj := tagged{bb, []string{"x"}}
+	if defaultComparator(obj, obj) {
+		t.Errorf("expected uncomparable values to differ")
+	}
+	if defaultComparator(obj, bb) {
+		t.Errorf("expected values of different types to differ")
+	}
+}
+
 func TestSearchIntersect(t *testing.T) {
 	rt := NewTree(3, 3)
 	things := []*BBox{
@@ -767,7 +862,9 @@ func TestSearchIntersect(t *testing.T) {
 	bb := mustBBox(Point{2, 1.5}, []float64{10, 5.5})
 	q := rt.SearchIntersect(bb)
 
-	expected := []int{1, 2, 3, 4, 6, 7}
+	// things[5] only touches the top edge of bb, which counts as
+	// intersecting for the default Closed boundary mode
+	expected := []int{1, 2, 3, 4, 5, 6, 7}
 	if len(q) != len(expected) {
 		t.Errorf("SearchIntersect failed to find all objects")
 	}
@@ -799,8 +896,8 @@ func TestSearchIntersectWithLimit(t *testing.T) {
 	bb := mustBBox(Point{2, 1.5}, []float64{10, 5.5})
 
 	// bbIntersects contains the indices of the rectangles that fall in
-	// the bounding box bb.
-	bbIntersects := []int{1, 2, 6, 7, 3, 4}
+	// or touch the bounding box bb.
+	bbIntersects := []int{1, 2, 6, 7, 3, 4, 5}
 
 	// Loop through all possible limits k of SearchIntersectWithLimit,
 	// and test that the results are as expected.
@@ -950,6 +1047,152 @@ func TestNearestNeighbor(t *testing.T) {
 	}
 }
 
+func TestNearestNeighborByBounds(t *testing.T) {
+	// the large box's center is at (50, 0), far from p, but its edge is near
+	large := mustBBox(Point{1, -50}, []float64{98, 100})
+	small := mustBBox(Point{-3, -0.5}, []float64{1, 1})
+	p := Point{0, 0}
+	if large.center().dist(p) <= small.center().dist(p) {
+		t.Fatalf("expected the small box to have the nearer center")
+	}
+
+	for _, rt := range []*Rtree{NewTree(2, 3), NewTreeRStar(2, 3)} {
+		rt.Insert(small)
+		rt.Insert(large)
+		for i := 0; i < 10; i++ {
+			rt.Insert(mustBBox(Point{float64(-40 + 3*i), 30}, []float64{1, 1}))
+		}
+
+		if obj := rt.NearestNeighbor(p); obj != large {
+			t.Errorf("expected the large box to be nearest, got %v", obj)
+		}
+		if obj, d := rt.NearestNeighborDist(p); obj != large || d != 1 {
+			t.Errorf("expected the large box at distance 1, got %v at %v", obj, d)
+		}
+		if q := rt.NearestNeighbors(2, p); q[0] != large || q[1] != small {
+			t.Errorf("expected the large box, then the small one, got %v", q)
+		}
+	}
+}
+
+func TestFarthestNeighbor(t *testing.T) {
+	r := rand.New(rand.NewSource(29))
+	for _, rt := range []*Rtree{NewTree(2, 5), NewTreeRStar(3, 8)} {
+		if obj, d := rt.FarthestNeighbor(Point{0, 0}); obj != nil || !math.IsInf(d, -1) {
+			t.Errorf("expected nil and -Inf for an empty tree, got %v and %v", obj, d)
+		}
+
+		var objs []Spatial
+		for i := 0; i < 300; i++ {
+			obj := Point{r.Float64()*200 - 100, r.Float64()*200 - 100}.ToBBox(0.5)
+			objs = append(objs, obj)
+			rt.Insert(obj)
+		}
+		objs = append(objs, mustBBox(Point{-10, -10}, []float64{20, 20}))
+		rt.Insert(objs[len(objs)-1])
+
+		for i := 0; i < 50; i++ {
+			p := Point{r.Float64()*300 - 150, r.Float64()*300 - 150}
+			var expected Spatial
+			maxDist := math.Inf(-1)
+			for _, obj := range objs {
+				if d := obj.Bounds().DistToPoint(p); d > maxDist {
+					expected, maxDist = obj, d
+				}
+			}
+
+			obj, d := rt.FarthestNeighbor(p)
+			if obj != expected || math.Abs(d-maxDist) > EPS {
+				t.Errorf("FarthestNeighbor(%v) = %v at %v, expected %v at %v", p, obj, d, expected, maxDist)
+			}
+		}
+	}
+}
+
+func TestPopNearest(t *testing.T) {
+	rt := NewTree(3, 8)
+	if obj, ok := rt.PopNearest(Point{0, 0}); ok || obj != nil {
+		t.Errorf("expected nothing to pop from an empty tree, got %v", obj)
+	}
+
+	r := rand.New(rand.NewSource(107))
+	objs := make([]Spatial, 300)
+	for i := range objs {
+		objs[i] = Point{r.Float64()*100 - 50, r.Float64()*100 - 50}.ToBBox(0)
+	}
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	// a twin tree checks consistency with NearestNeighbor and Delete
+	twin := NewTree(3, 8)
+	for _, obj := range objs {
+		twin.Insert(obj)
+	}
+
+	p := Point{3, -7}
+	last := -1.0
+	popped := map[Spatial]bool{}
+	for i := range objs {
+		expected := twin.NearestNeighbor(p)
+		twin.Delete(expected)
+		obj, ok := rt.PopNearest(p)
+		if !ok {
+			t.Fatalf("expected pop %d to succeed", i)
+		}
+		if obj != expected {
+			t.Errorf("pop %d: expected %v, got %v", i, expected, obj)
+		}
+		if popped[obj] {
+			t.Errorf("popped %v twice", obj)
+		}
+		popped[obj] = true
+		d := obj.Bounds().DistToPoint(p)
+		if d < last {
+			t.Errorf("pop %d: distance %v decreased from %v", i, d, last)
+		}
+		last = d
+		if rt.Size() != len(objs)-i-1 {
+			t.Fatalf("expected size %d, got %d", len(objs)-i-1, rt.Size())
+		}
+		if i%50 == 0 {
+			if err := rt.Validate(); err != nil {
+				t.Fatalf("after %d pops: %v", i+1, err)
+			}
+		}
+	}
+	if obj, ok := rt.PopNearest(p); ok {
+		t.Errorf("expected an emptied tree to pop nothing, got %v", obj)
+	}
+}
+
+func TestNearestNeighborDist(t *testing.T) {
+	rt := NewTree(3, 8)
+	if obj, d := rt.NearestNeighborDist(Point{0, 0}); obj != nil || !math.IsInf(d, 1) {
+		t.Errorf("expected nil and +Inf for an empty tree, got %v and %v", obj, d)
+	}
+
+	objs := randomBBoxes(rand.New(rand.NewSource(1)), 300)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 50; i++ {
+		p := Point{r.Float64()*200 - 100, r.Float64()*200 - 100}
+		obj, d := rt.NearestNeighborDist(p)
+		if obj != rt.NearestNeighbor(p) {
+			t.Errorf("expected the same object as NearestNeighbor for %v", p)
+		}
+		if expected := obj.Bounds().DistToPoint(p); math.Abs(d-expected) > EPS {
+			t.Errorf("expected distance %v to %v, got %v", expected, p, d)
+		}
+	}
+
+	inside := objs[0].Bounds().center()
+	if _, d := rt.NearestNeighborDist(inside); d != 0 {
+		t.Errorf("expected zero distance inside an object, got %v", d)
+	}
+}
+
 func TestNearestNeighbors(t *testing.T) {
 	rt := NewTree(3, 3)
 	things := []*BBox{
@@ -969,3 +1212,1857 @@ func TestNearestNeighbors(t *testing.T) {
 		t.Errorf("NearestNeighbors failed")
 	}
 }
+
+func TestSize(t *testing.T) {
+	rt := NewTree(3, 3)
+	things := []*BBox{
+		mustBBox(Point{0, 0}, []float64{2, 1}),
+		mustBBox(Point{3, 1}, []float64{1, 2}),
+		mustBBox(Point{1, 2}, []float64{2, 2}),
+		mustBBox(Point{8, 6}, []float64{1, 1}),
+		mustBBox(Point{10, 3}, []float64{1, 2}),
+		mustBBox(Point{11, 7}, []float64{1, 1}),
+	}
+	absent := mustBBox(Point{99, 99}, []float64{1, 1})
+
+	if rt.Size() != 0 {
+		t.Errorf("expected empty tree to have size 0, got %d", rt.Size())
+	}
+
+	for i, thing := range things[:4] {
+		rt.Insert(thing)
+		if rt.Size() != i+1 {
+			t.Errorf("expected size %d after insert, got %d", i+1, rt.Size())
+		}
+	}
+
+	if rt.Delete(absent) {
+		t.Errorf("expected Delete of absent object to fail")
+	}
+	if rt.Size() != 4 {
+		t.Errorf("expected Delete of absent object to keep size 4, got %d", rt.Size())
+	}
+
+	rt.Delete(things[1])
+	rt.Insert(things[4])
+	rt.Delete(things[0])
+	rt.Insert(things[5])
+	if rt.Size() != 4 {
+		t.Errorf("expected size 4 after mixed operations, got %d", rt.Size())
+	}
+
+	// deleting an object twice only removes it once
+	rt.Delete(things[2])
+	rt.Delete(things[2])
+	if rt.Size() != 3 {
+		t.Errorf("expected size 3 after repeated delete, got %d", rt.Size())
+	}
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+	rt := NewTree(3, 8)
+	r := rand.New(rand.NewSource(1))
+	things := make([]*BBox, 400)
+	for i := range things {
+		things[i] = mustBBox(Point{r.Float64() * 100, r.Float64() * 100}, []float64{1, 1})
+	}
+	for _, thing := range things[:100] {
+		rt.Insert(thing)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for _, thing := range things[100+w*75 : 100+(w+1)*75] {
+				rt.Insert(thing)
+			}
+			for _, thing := range things[w*10 : (w+1)*10] {
+				rt.Delete(thing)
+			}
+		}(w)
+	}
+	for q := 0; q < 4; q++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bb := mustBBox(Point{25, 25}, []float64{50, 50})
+			for i := 0; i < 50; i++ {
+				rt.SearchIntersect(bb)
+				rt.NearestNeighbor(Point{50, 50})
+				rt.NearestNeighbors(3, Point{10, 10})
+				rt.Size()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if rt.Size() != len(things)-40 {
+		t.Errorf("expected size %d after concurrent operations, got %d", len(things)-40, rt.Size())
+	}
+	verify(t, rt.root)
+}
+
+func TestCountIntersect(t *testing.T) {
+	rt := NewTree(3, 8)
+	if c := rt.CountIntersect(mustBBox(Point{0, 0}, []float64{1, 1})); c != 0 {
+		t.Errorf("expected no objects in an empty tree, got %d", c)
+	}
+
+	r := rand.New(rand.NewSource(4))
+	for _, obj := range randomBBoxes(r, 500) {
+		rt.Insert(obj)
+	}
+	for _, q := range randomBBoxes(r, 100) {
+		bb := q.Bounds().Expand(r.Float64() * 200)
+		if c, expected := rt.CountIntersect(bb), len(rt.SearchIntersect(bb)); c != expected {
+			t.Errorf("expected %d objects intersecting %v, got %d", expected, bb, c)
+		}
+	}
+}
+
+func TestAnyIntersect(t *testing.T) {
+	rt := NewTree(3, 8)
+	if rt.AnyIntersect(mustBBox(Point{0, 0}, []float64{1, 1})) {
+		t.Errorf("expected no intersection in an empty tree")
+	}
+
+	r := rand.New(rand.NewSource(79))
+	objs := randomBBoxes(r, 500)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	if !rt.AnyIntersect(objs[42].Bounds()) {
+		t.Errorf("expected a stored object's bounds to intersect it")
+	}
+	far := mustBBox(Point{1e6, 1e6}, []float64{1, 1})
+	if rt.AnyIntersect(far) {
+		t.Errorf("expected nothing to intersect %v", far)
+	}
+	for _, q := range randomBBoxes(r, 200) {
+		bb := q.Bounds()
+		if found, expected := rt.AnyIntersect(bb), len(rt.SearchIntersect(bb)) > 0; found != expected {
+			t.Errorf("expected AnyIntersect(%v) == %v, got %v", bb, expected, found)
+		}
+	}
+}
+
+func TestDegeneratePoints(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	objs := []Spatial{}
+	for i := 0; i < 150; i++ {
+		// points on a line, then scattered points with repeats
+		objs = append(objs, Point{float64(i), -5}.ToBBox(0))
+	}
+	for i := 0; i < 150; i++ {
+		objs = append(objs, Point{float64(r.Intn(40)), float64(r.Intn(40))}.ToBBox(0))
+	}
+
+	for _, rt := range []*Rtree{NewTree(3, 8), NewTreeRStar(3, 8), NewTree(3, 8, Splitter(LinearSplit{}))} {
+		for _, obj := range objs {
+			rt.Insert(obj)
+		}
+		verify(t, rt.root)
+		verifyStructure(t, rt, rt.root)
+
+		for i := 0; i < 30; i++ {
+			bb := NewBBoxFromCorners(
+				Point{float64(r.Intn(50)), float64(r.Intn(50))},
+				Point{float64(r.Intn(50)), float64(r.Intn(50))})
+			q := rt.SearchIntersect(bb)
+			expected := 0
+			for _, obj := range objs {
+				if bb.containsBBox(obj.Bounds()) {
+					expected++
+					if indexOf(q, obj) < 0 {
+						t.Errorf("SearchIntersect(%v) missed %v", bb, obj)
+					}
+				}
+			}
+			if len(q) != expected {
+				t.Errorf("expected %d results for %v, got %d", expected, bb, len(q))
+			}
+
+			p := Point{r.Float64() * 50, r.Float64() * 50}
+			nearest, d := rt.NearestNeighborDist(p)
+			for _, obj := range objs {
+				if obj.Bounds().DistToPoint(p) < d {
+					t.Errorf("NearestNeighbor(%v) returned %v at %v, but %v is closer", p, nearest, d, obj)
+				}
+			}
+		}
+
+	}
+
+	// a line of points should not be split into interleaved nodes
+	for k, rt := range []*Rtree{NewTree(3, 8), NewTreeRStar(3, 8), NewTree(3, 8, Splitter(LinearSplit{}))} {
+		for _, obj := range objs[:150] {
+			rt.Insert(obj)
+		}
+		rt.Walk(func(level int, bb *BBox, isLeaf bool) {
+			if level == 1 && bb.max.X-bb.min.X >= float64(2*rt.MaxChildren) {
+				t.Errorf("%d: leaf %v spans too much of the line", k, bb)
+			}
+		})
+	}
+}
+
+func TestBestOverlap(t *testing.T) {
+	rt := NewTree(2, 3)
+	things := []*BBox{
+		mustBBox(Point{0, 0}, []float64{4, 4}),
+		mustBBox(Point{3, 3}, []float64{2, 2}),
+		mustBBox(Point{1, 1}, []float64{1, 6}),
+		mustBBox(Point{2, -1}, []float64{6, 2}),
+		mustBBox(Point{10, 10}, []float64{1, 1}),
+		mustBBox(Point{6, 0}, []float64{1, 1}),
+	}
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+
+	tests := []struct {
+		bb   *BBox
+		best Spatial
+		area float64
+	}{
+		// lies within 0, and overlaps 2 by 3 and 3 by 1
+		{mustBBox(Point{1, 0}, []float64{2, 4}), things[0], 8},
+		// overlaps 0 by 1, 1 by 4 and 2 by 0
+		{mustBBox(Point{3, 3}, []float64{2, 2}), things[1], 4},
+		{mustBBox(Point{1.25, 4.5}, []float64{0.5, 3}), things[2], 1.25},
+		{mustBBox(Point{20, 20}, []float64{1, 1}), nil, 0},
+		// touching does not count as overlap
+		{mustBBox(Point{11, 10}, []float64{1, 1}), nil, 0},
+	}
+	for _, test := range tests {
+		best, area := rt.BestOverlap(test.bb)
+		if best != test.best || math.Abs(area-test.area) > EPS {
+			t.Errorf("BestOverlap(%v): expected %v with area %v, got %v with area %v", test.bb, test.best, test.area, best, area)
+		}
+	}
+}
+
+type place struct {
+	name string
+	x, y float64
+}
+
+func (p place) Bounds() *BBox {
+	return Point{p.x, p.y}.ToBBox(0.5)
+}
+
+func TestInsertUnique(t *testing.T) {
+	rt := NewTree(2, 4)
+	objs := randomBBoxes(rand.New(rand.NewSource(13)), 50)
+	for _, obj := range objs {
+		if !rt.InsertUnique(obj) {
+			t.Errorf("failed to insert %v", obj)
+		}
+	}
+	for _, obj := range objs[:10] {
+		if rt.InsertUnique(obj) {
+			t.Errorf("inserted duplicate %v", obj)
+		}
+	}
+	if rt.Size() != len(objs) {
+		t.Errorf("expected size %d, got %d", len(objs), rt.Size())
+	}
+
+	// an equal box stored under a different pointer is a different object
+	copied := *objs[0].(*BBox)
+	if !rt.InsertUnique(&copied) {
+		t.Errorf("failed to insert a distinct object with equal bounds")
+	}
+	rt.Delete(&copied)
+
+	for _, obj := range objs[:10] {
+		if !rt.Delete(obj) {
+			t.Errorf("failed to delete %v", obj)
+		}
+		if q := rt.SearchIntersect(obj.Bounds()); indexOf(q, obj) >= 0 {
+			t.Errorf("%v still present after a single delete", obj)
+		}
+	}
+	if rt.Size() != len(objs)-10 {
+		t.Errorf("expected size %d, got %d", len(objs)-10, rt.Size())
+	}
+
+	// values compare by content
+	if !rt.InsertUnique(place{"home", 1, 2}) {
+		t.Errorf("failed to insert place")
+	}
+	if rt.InsertUnique(place{"home", 1, 2}) {
+		t.Errorf("inserted an equal place twice")
+	}
+	if !rt.InsertUnique(place{"work", 1, 2}) {
+		t.Errorf("failed to insert a different place with the same bounds")
+	}
+}
+
+func TestDeleteRegion(t *testing.T) {
+	objs := randomBBoxes(rand.New(rand.NewSource(14)), 600)
+	region := mustBBox(Point{-200, -150}, []float64{300, 250})
+
+	for _, contained := range []bool{true, false} {
+		rt := NewTree(3, 8)
+		for _, obj := range objs {
+			rt.Insert(obj)
+		}
+
+		matches := func(obj Spatial) bool {
+			if contained {
+				return region.containsBBox(obj.Bounds())
+			}
+			return Closed.Overlaps(obj.Bounds(), region)
+		}
+		expected := 0
+		for _, obj := range objs {
+			if matches(obj) {
+				expected++
+			}
+		}
+
+		var removed int
+		if contained {
+			removed = rt.DeleteWithin(region)
+		} else {
+			removed = rt.DeleteIntersecting(region)
+		}
+		if removed != expected || expected == 0 {
+			t.Errorf("expected %d objects removed, got %d", expected, removed)
+		}
+		if rt.Size() != len(objs)-removed {
+			t.Errorf("expected size %d, got %d", len(objs)-removed, rt.Size())
+		}
+		verify(t, rt.root)
+		verifyStructure(t, rt, rt.root)
+
+		all := rt.All()
+		if len(all) != rt.Size() {
+			t.Errorf("expected %d objects in the tree, got %d", rt.Size(), len(all))
+		}
+		for _, obj := range objs {
+			if found := indexOf(all, obj) >= 0; found == matches(obj) {
+				t.Errorf("expected %v to be removed: %v", obj, matches(obj))
+			}
+		}
+
+		if n := rt.DeleteWithin(region); n != 0 && contained {
+			t.Errorf("expected nothing left to remove, removed %d", n)
+		}
+		everything := mustBBox(Point{-1000, -1000}, []float64{2000, 2000})
+		if n := rt.DeleteWithin(everything); n != len(all) || rt.Size() != 0 || rt.Depth() != 0 {
+			t.Errorf("expected to remove all %d objects, removed %d leaving %d", len(all), n, rt.Size())
+		}
+		rt.Insert(objs[0])
+		if q := rt.SearchIntersect(objs[0].Bounds()); len(q) != 1 {
+			t.Errorf("expected an emptied tree to remain usable, got %v", q)
+		}
+	}
+}
+
+func TestSearchIntersectVisit(t *testing.T) {
+	rt := NewTree(3, 3)
+	things := []*BBox{
+		mustBBox(Point{0, 0}, []float64{2, 1}),
+		mustBBox(Point{3, 1}, []float64{1, 2}),
+		mustBBox(Point{1, 2}, []float64{2, 2}),
+		mustBBox(Point{8, 6}, []float64{1, 1}),
+		mustBBox(Point{10, 3}, []float64{1, 2}),
+		mustBBox(Point{11, 7}, []float64{1, 1}),
+		mustBBox(Point{2, 6}, []float64{1, 2}),
+		mustBBox(Point{3, 6}, []float64{1, 2}),
+		mustBBox(Point{2, 8}, []float64{1, 2}),
+		mustBBox(Point{3, 8}, []float64{1, 2}),
+	}
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+
+	bb := mustBBox(Point{2, 1.5}, []float64{10, 5.5})
+	expected := rt.SearchIntersect(bb)
+
+	visited := []Spatial{}
+	rt.SearchIntersectVisit(bb, func(obj Spatial) bool {
+		visited = append(visited, obj)
+		return true
+	})
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("expected SearchIntersectVisit to visit %v, visited %v", expected, visited)
+	}
+
+	for k := 1; k <= len(expected); k++ {
+		visits := 0
+		rt.SearchIntersectVisit(bb, func(obj Spatial) bool {
+			visits++
+			return visits < k
+		})
+		if visits != k {
+			t.Errorf("expected SearchIntersectVisit to stop after %d visits, got %d", k, visits)
+		}
+	}
+}
+
+func TestSearchWithin(t *testing.T) {
+	rt := NewTree(3, 8)
+	r := rand.New(rand.NewSource(1))
+	things := make([]*BBox, 200)
+	for i := range things {
+		p := Point{r.Float64()*100 - 50, r.Float64()*100 - 50}
+		things[i] = mustBBox(p, []float64{r.Float64(), r.Float64()})
+		rt.Insert(things[i])
+	}
+
+	tests := []struct {
+		p      Point
+		radius float64
+	}{
+		{things[0].min, 0},
+		{Point{0, 0}, 0},
+		{Point{0, 0}, 10},
+		{Point{-20, 30}, 15.5},
+		{Point{200, 200}, 1},
+		{Point{0, 0}, 1000},
+	}
+	for _, test := range tests {
+		expected := []Spatial{}
+		for _, thing := range things {
+			if test.p.minDist(thing) <= test.radius*test.radius {
+				expected = append(expected, thing)
+			}
+		}
+
+		q := rt.SearchWithin(test.p, test.radius)
+		if len(q) != len(expected) {
+			t.Errorf("SearchWithin(%v, %v) found %d objects, expected %d", test.p, test.radius, len(q), len(expected))
+		}
+		for _, obj := range expected {
+			if indexOf(q, obj) < 0 {
+				t.Errorf("SearchWithin(%v, %v) failed to find %v", test.p, test.radius, obj)
+			}
+		}
+	}
+
+	if q := rt.SearchWithin(Point{0, 0}, 1000); len(q) != len(things) {
+		t.Errorf("expected SearchWithin to find all %d objects, got %d", len(things), len(q))
+	}
+	if q := rt.SearchWithin(things[0].min, -5); q == nil || len(q) != 0 {
+		t.Errorf("expected SearchWithin with a negative radius to find nothing, got %v", q)
+	}
+}
+
+func TestClear(t *testing.T) {
+	rt := NewTree(3, 3)
+	things := []*BBox{
+		mustBBox(Point{0, 0}, []float64{2, 1}),
+		mustBBox(Point{3, 1}, []float64{1, 2}),
+		mustBBox(Point{1, 2}, []float64{2, 2}),
+		mustBBox(Point{8, 6}, []float64{1, 1}),
+		mustBBox(Point{10, 3}, []float64{1, 2}),
+		mustBBox(Point{11, 7}, []float64{1, 1}),
+	}
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+
+	rt.Clear()
+	if rt.Size() != 0 {
+		t.Errorf("expected size 0 after Clear, got %d", rt.Size())
+	}
+	if rt.MinChildren != 3 || rt.MaxChildren != 3 {
+		t.Errorf("expected Clear to keep the branching factors")
+	}
+	bb := mustBBox(Point{-10, -10}, []float64{30, 30})
+	if q := rt.SearchIntersect(bb); len(q) != 0 {
+		t.Errorf("expected no results after Clear, got %v", q)
+	}
+
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+	if rt.Size() != len(things) {
+		t.Errorf("expected size %d after reinsertion, got %d", len(things), rt.Size())
+	}
+	if q := rt.SearchIntersect(bb); len(q) != len(things) {
+		t.Errorf("expected %d results after reinsertion, got %d", len(things), len(q))
+	}
+	verify(t, rt.root)
+}
+
+func TestWalk(t *testing.T) {
+	rt := NewTree(3, 3)
+	rt.Walk(func(level int, bb *BBox, isLeaf bool) {
+		t.Errorf("expected no visits for an empty tree")
+	})
+
+	things := []*BBox{
+		mustBBox(Point{0, 0}, []float64{2, 1}),
+		mustBBox(Point{3, 1}, []float64{1, 2}),
+		mustBBox(Point{1, 2}, []float64{2, 2}),
+		mustBBox(Point{8, 6}, []float64{1, 1}),
+		mustBBox(Point{10, 3}, []float64{1, 2}),
+		mustBBox(Point{11, 7}, []float64{1, 1}),
+	}
+	objs := []Spatial{}
+	for _, thing := range things {
+		rt.Insert(thing)
+		objs = append(objs, thing)
+	}
+
+	counts := map[int]int{}
+	leaves := 0
+	var root *BBox
+	rt.Walk(func(level int, bb *BBox, isLeaf bool) {
+		if root == nil {
+			root = bb
+		}
+		counts[level]++
+		if isLeaf {
+			leaves++
+			if level != 0 || indexOf(objs, bb) < 0 {
+				t.Errorf("unexpected leaf entry %v at level %d", bb, level)
+			}
+		}
+	})
+
+	if counts[2] != 1 || counts[1] != 2 || counts[0] != 6 || leaves != 6 {
+		t.Errorf("unexpected level counts %v", counts)
+	}
+	if root.min.dist(Point{0, 0}) >= EPS || root.max.dist(Point{12, 8}) >= EPS {
+		t.Errorf("expected root bb [0, 0]x[12, 8], got %v", root)
+	}
+}
+
+func TestAll(t *testing.T) {
+	rt := NewTree(3, 8)
+	if all := rt.All(); len(all) != 0 {
+		t.Errorf("expected no objects in an empty tree, got %v", all)
+	}
+
+	objs := randomBBoxes(rand.New(rand.NewSource(8)), 200)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	for _, obj := range objs[:120] {
+		rt.Delete(obj)
+	}
+	remaining := objs[120:]
+
+	all := rt.All()
+	if len(all) != len(remaining) {
+		t.Errorf("expected %d objects, got %d", len(remaining), len(all))
+	}
+	seen := map[Spatial]bool{}
+	for _, obj := range all {
+		if seen[obj] || indexOf(remaining, obj) < 0 {
+			t.Errorf("unexpected or repeated object %v", obj)
+		}
+		seen[obj] = true
+	}
+
+	visits := 0
+	rt.AllVisit(func(obj Spatial) bool {
+		visits++
+		return visits < 10
+	})
+	if visits != 10 {
+		t.Errorf("expected AllVisit to stop after 10 visits, got %d", visits)
+	}
+}
+
+func TestAllByArea(t *testing.T) {
+	rt := NewTree(2, 4)
+	if all := rt.AllByArea(false); len(all) != 0 {
+		t.Errorf("expected no objects in an empty tree, got %v", all)
+	}
+
+	// squares of side 1 to 30, inserted in shuffled order
+	r := rand.New(rand.NewSource(73))
+	objs := make([]*BBox, 30)
+	for i := range objs {
+		objs[i] = mustBBox(Point{r.Float64() * 100, r.Float64() * 100}, []float64{float64(i + 1), float64(i + 1)})
+	}
+	for _, i := range r.Perm(len(objs)) {
+		rt.Insert(objs[i])
+	}
+
+	ascending := rt.AllByArea(false)
+	if len(ascending) != len(objs) {
+		t.Fatalf("expected %d objects, got %d", len(objs), len(ascending))
+	}
+	for i, obj := range ascending {
+		if obj != objs[i] {
+			t.Errorf("ascending: expected %v at %d, got %v", objs[i], i, obj)
+		}
+	}
+	descending := rt.AllByArea(true)
+	for i, obj := range descending {
+		if expected := objs[len(objs)-1-i]; obj != expected {
+			t.Errorf("descending: expected %v at %d, got %v", expected, i, obj)
+		}
+	}
+}
+
+func TestDepthOf(t *testing.T) {
+	rt := NewTree(2, 4)
+	objs := randomBBoxes(rand.New(rand.NewSource(113)), 500)
+	if d, ok := rt.DepthOf(objs[0]); ok || d != 0 {
+		t.Errorf("expected no object in an empty tree, got depth %d", d)
+	}
+	rt.Insert(objs[0])
+	if d, ok := rt.DepthOf(objs[0]); !ok || d != 1 {
+		t.Errorf("expected depth 1 for a single object, got %d, %v", d, ok)
+	}
+
+	for _, obj := range objs[1:] {
+		rt.Insert(obj)
+	}
+	if rt.Depth() < 3 {
+		t.Fatalf("expected a tree of depth at least 3, got %d", rt.Depth())
+	}
+	for _, obj := range objs {
+		if d, ok := rt.DepthOf(obj); !ok || d != rt.Depth() {
+			t.Errorf("expected %v at depth %d, got %d, %v", obj, rt.Depth(), d, ok)
+		}
+	}
+	absent := mustBBox(Point{0, 0}, []float64{1, 1})
+	if d, ok := rt.DepthOf(absent); ok {
+		t.Errorf("expected %v not to be found, got depth %d", absent, d)
+	}
+	rt.Delete(objs[7])
+	if _, ok := rt.DepthOf(objs[7]); ok {
+		t.Errorf("expected a deleted object not to be found")
+	}
+}
+
+func TestDepth(t *testing.T) {
+	rt := NewTree(2, 4)
+	if d := rt.Depth(); d != 0 {
+		t.Errorf("expected depth 0 for an empty tree, got %d", d)
+	}
+
+	objs := randomBBoxes(rand.New(rand.NewSource(1)), 1000)
+	rt.Insert(objs[0])
+	if d := rt.Depth(); d != 1 {
+		t.Errorf("expected depth 1 for a single object, got %d", d)
+	}
+
+	for _, obj := range objs[1:] {
+		rt.Insert(obj)
+	}
+	// every node but the root has between 2 and 4 children
+	if d := rt.Depth(); d < 5 || d > 10 {
+		t.Errorf("expected depth between 5 and 10 for %d objects, got %d", len(objs), d)
+	}
+
+	packed := NewTree(2, 4)
+	packed.InsertBatch(objs)
+	if d := packed.Depth(); d != 5 {
+		t.Errorf("expected depth 5 for %d packed objects, got %d", len(objs), d)
+	}
+
+	for _, obj := range objs {
+		rt.Delete(obj)
+	}
+	if d := rt.Depth(); d != 0 {
+		t.Errorf("expected depth 0 after deleting everything, got %d", d)
+	}
+}
+
+func TestBoxItem(t *testing.T) {
+	if _, err := NewBoxItem(Point{0, 0}, -1, 1); err == nil {
+		t.Errorf("expected an error for a negative length")
+	}
+
+	rt := NewTree(2, 4)
+	var items []BoxItem
+	for i := 0; i < 20; i++ {
+		b, err := NewBoxItem(Point{float64(i), float64(i)}, 0.5, 0.5)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		items = append(items, b)
+		rt.Insert(b)
+	}
+	if obj := rt.NearestNeighbor(Point{7.2, 7.2}); obj != items[7] {
+		t.Errorf("expected %v to be nearest, got %v", items[7], obj)
+	}
+	// a copy of a BoxItem is the same item
+	if !rt.Delete(BoxItem{items[3].BBox}) {
+		t.Errorf("failed to delete %v", items[3])
+	}
+	if rt.Delete(BoxItem{mustBBox(Point{4, 4}, []float64{0.5, 0.5})}) {
+		t.Errorf("deleted an item holding a different box")
+	}
+	if rt.Size() != 19 {
+		t.Errorf("expected size 19, got %d", rt.Size())
+	}
+}
+
+func TestPointItem(t *testing.T) {
+	rt := NewTree(2, 4)
+	var items []PointItem
+	for i := 0; i < 30; i++ {
+		pi := NewPointItem(Point{float64(i % 6), float64(i / 6)})
+		if pi.Point() != (Point{float64(i % 6), float64(i / 6)}) {
+			t.Errorf("expected %v to hold its point", pi)
+		}
+		if bb := pi.Bounds(); bb.min != pi.Point() || bb.max != pi.Point() {
+			t.Errorf("expected degenerate bounds at %v, got %v", pi.Point(), bb)
+		}
+		items = append(items, pi)
+		rt.Insert(pi)
+	}
+
+	p := Point{2.2, 3.1}
+	nearest := rt.NearestNeighbors(3, p)
+	expected := []Point{{2, 3}, {3, 3}, {2, 4}}
+	for i, obj := range nearest {
+		pi, ok := obj.(PointItem)
+		if !ok {
+			t.Fatalf("expected a PointItem, got %T", obj)
+		}
+		if pi.Point() != expected[i] {
+			t.Errorf("expected neighbor %d of %v to be %v, got %v", i, p, expected[i], pi.Point())
+		}
+	}
+
+	// a PointItem holding the same point is the same item
+	if !rt.Delete(NewPointItem(Point{1, 1})) {
+		t.Errorf("failed to delete %v", items[7])
+	}
+	if rt.Delete(NewPointItem(Point{1.5, 1})) {
+		t.Errorf("deleted an item holding a different point")
+	}
+	if rt.Size() != 29 {
+		t.Errorf("expected size 29, got %d", rt.Size())
+	}
+}
+
+func TestRecord(t *testing.T) {
+	rt := NewTree(2, 4)
+	var records []Record
+	for i := 0; i < 25; i++ {
+		rec := Record{mustBBox(Point{float64(i % 5), float64(i / 5)}, []float64{0.5, 0.5}), fmt.Sprintf("cell %d", i)}
+		records = append(records, rec)
+		rt.Insert(rec)
+	}
+
+	results := rt.SearchIntersect(mustBBox(Point{2.2, 3.2}, []float64{0.1, 0.1}))
+	if len(results) != 1 {
+		t.Fatalf("expected one result, got %v", results)
+	}
+	if data := results[0].(Record).Data; data != "cell 17" {
+		t.Errorf("expected data %q, got %v", "cell 17", data)
+	}
+	if obj := rt.NearestNeighbor(Point{0.1, 4.9}); obj.(Record).Data != "cell 20" {
+		t.Errorf("expected the nearest record to hold %q, got %v", "cell 20", obj)
+	}
+
+	// a copy of a Record is the same record
+	if !rt.Delete(Record{records[4].BBox, "cell 4"}) {
+		t.Errorf("failed to delete %v", records[4])
+	}
+	if rt.Delete(Record{records[5].BBox, "cell 6"}) {
+		t.Errorf("deleted a record holding different data")
+	}
+	if rt.Size() != 24 {
+		t.Errorf("expected size 24, got %d", rt.Size())
+	}
+
+	// uncomparable data needs a custom equality
+	sameData := func(obj1, obj2 Spatial) bool {
+		r1, r2 := obj1.(Record), obj2.(Record)
+		return r1.BBox == r2.BBox && reflect.DeepEqual(r1.Data, r2.Data)
+	}
+	st := NewTree(2, 4, Equal(sameData))
+	bb := mustBBox(Point{0, 0}, []float64{1, 1})
+	st.Insert(Record{bb, []int{1, 2}})
+	if !st.Delete(Record{bb, []int{1, 2}}) {
+		t.Errorf("failed to delete a record holding a slice")
+	}
+}
+
+func TestOnSplit(t *testing.T) {
+	for _, rt := range []*Rtree{NewTree(2, 4), NewTreeRStar(2, 4)} {
+		type split struct {
+			level  int
+			before *BBox
+			a, b   *BBox
+			height int
+		}
+		var splits []split
+		rt.OnSplit = func(level int, before, a, b *BBox) {
+			splits = append(splits, split{level, before, a, b, rt.height})
+		}
+
+		objs := randomBBoxes(rand.New(rand.NewSource(53)), 200)
+		rt.Insert(objs[0])
+		for _, obj := range objs[1:5] {
+			rt.Insert(obj)
+		}
+		if len(splits) != 1 || splits[0].level != 1 {
+			t.Fatalf("expected the fifth insert to split the root leaf, got %v", splits)
+		}
+		for _, obj := range objs[5:] {
+			rt.Insert(obj)
+		}
+
+		levels := map[int]int{}
+		for _, s := range splits {
+			levels[s.level]++
+			if s.level < 1 || s.level > s.height {
+				t.Errorf("split at level %d of a tree of height %d", s.level, s.height)
+			}
+			if !s.before.containsBBox(s.a) || !s.before.containsBBox(s.b) {
+				t.Errorf("split halves %v and %v outside %v", s.a, s.b, s.before)
+			}
+			if !boundingBox(s.a, s.b).Equal(s.before, 0) {
+				t.Errorf("split halves %v and %v do not cover %v", s.a, s.b, s.before)
+			}
+		}
+		// every split but the root's adds a node; root splits add two
+		nodes := 0
+		rt.Walk(func(level int, bb *BBox, isLeaf bool) {
+			if !isLeaf {
+				nodes++
+			}
+		})
+		if expected := 1 + len(splits) + rt.Depth() - 1; nodes != expected {
+			t.Errorf("expected %d nodes after %d splits, got %d", expected, len(splits), nodes)
+		}
+		if levels[1] == 0 || levels[2] == 0 {
+			t.Errorf("expected splits of leaves and their parents, got %v", levels)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	build := func(newTree func() *Rtree) string {
+		rt := newTree()
+		objs := randomBBoxes(rand.New(rand.NewSource(59)), 500)
+		for _, obj := range objs {
+			rt.Insert(obj)
+		}
+		for _, obj := range objs[:200] {
+			rt.Delete(obj)
+		}
+		var buf bytes.Buffer
+		rt.Walk(func(level int, bb *BBox, isLeaf bool) {
+			fmt.Fprintf(&buf, "%d %v %v\n", level, bb, isLeaf)
+		})
+		return buf.String()
+	}
+
+	for name, newTree := range map[string]func() *Rtree{
+		"quadratic": func() *Rtree { return NewTree(3, 8) },
+		"rstar":     func() *Rtree { return NewTreeRStar(3, 8) },
+		"linear":    func() *Rtree { return NewTree(3, 8, Splitter(LinearSplit{})) },
+	} {
+		first := build(newTree)
+		for i := 0; i < 3; i++ {
+			if build(newTree) != first {
+				t.Errorf("%s: expected identical trees from identical inputs", name)
+			}
+		}
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	rt := NewTree(2, 4)
+	if !rt.IsEmpty() {
+		t.Errorf("expected a new tree to be empty")
+	}
+	objs := randomBBoxes(rand.New(rand.NewSource(67)), 20)
+	for _, obj := range objs {
+		rt.Insert(obj)
+		if rt.IsEmpty() {
+			t.Fatalf("expected tree to be non-empty after Insert")
+		}
+	}
+	for i, obj := range objs {
+		if !rt.Delete(obj) {
+			t.Fatalf("failed to delete %v", obj)
+		}
+		if empty := rt.IsEmpty(); empty != (i == len(objs)-1) {
+			t.Errorf("after %d deletes, expected IsEmpty %v, got %v", i+1, !empty, empty)
+		}
+	}
+}
+
+func TestTreeBounds(t *testing.T) {
+	rt := NewTree(2, 4)
+	if bb := rt.Bounds(); bb != nil {
+		t.Errorf("expected nil bounds for an empty tree, got %v", bb)
+	}
+
+	objs := randomBBoxes(rand.New(rand.NewSource(61)), 300)
+	check := func(objs []Spatial) {
+		var expected *BBox
+		for _, obj := range objs {
+			expected = boundingBoxN(expected, obj.Bounds())
+		}
+		if bb := rt.Bounds(); !bb.Equal(expected, 0) {
+			t.Errorf("expected bounds %v for %d objects, got %v", expected, len(objs), bb)
+		}
+	}
+	for i, obj := range objs {
+		rt.Insert(obj)
+		check(objs[:i+1])
+	}
+	// delete from the outside in, so that the bounds shrink
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].Bounds().center().dist(Point{}) > objs[j].Bounds().center().dist(Point{})
+	})
+	for i, obj := range objs[:299] {
+		rt.Delete(obj)
+		check(objs[i+1:])
+	}
+	rt.Delete(objs[299])
+	if bb := rt.Bounds(); bb != nil {
+		t.Errorf("expected nil bounds after deleting everything, got %v", bb)
+	}
+}
+
+func TestBoundsCache(t *testing.T) {
+	rt := NewTree(2, 4)
+	objs := randomBBoxes(rand.New(rand.NewSource(67)), 100)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	inner := rt.Bounds()
+
+	// extreme points far outside the random boxes grow the bounds, and
+	// deleting them shrinks the bounds back again
+	extremes := []Spatial{
+		NewPointItem(Point{-1000, 0}),
+		NewPointItem(Point{0, -1000}),
+		NewPointItem(Point{1000, 0}),
+		NewPointItem(Point{0, 1000}),
+	}
+	for _, p := range extremes {
+		rt.Insert(p)
+	}
+	if bb := rt.Bounds(); !bb.Equal(mustBBox(Point{-1000, -1000}, []float64{2000, 2000}), 0) {
+		t.Errorf("expected bounds [-1000, -1000]x[1000, 1000] with the extreme points, got %v", bb)
+	}
+	// modifying the result must not affect the cached bounds
+	rt.Bounds().max = Point{5000, 5000}
+	if bb := rt.Bounds(); bb.max != (Point{1000, 1000}) {
+		t.Errorf("modifying the result of Bounds changed the cache to %v", bb)
+	}
+
+	rt.Delete(extremes[0])
+	if bb := rt.Bounds(); !bb.Equal(NewBBoxFromCorners(Point{inner.min.X, -1000}, Point{1000, 1000}), 0) {
+		t.Errorf("expected bounds to shrink on the left after deleting %v, got %v", extremes[0], bb)
+	}
+	if n := rt.DeleteWithin(mustBBox(Point{-1, -1001}, []float64{1002, 2002})); n < 3 {
+		t.Fatalf("expected DeleteWithin to remove the remaining extreme points, removed %d", n)
+	}
+	for _, p := range extremes[1:] {
+		if q := rt.SearchIntersect(p.Bounds()); indexOf(q, p) >= 0 {
+			t.Fatalf("extreme point %v was not deleted", p)
+		}
+	}
+	var expected *BBox
+	for _, obj := range rt.All() {
+		expected = boundingBoxN(expected, obj.Bounds())
+	}
+	if bb := rt.Bounds(); !bb.Equal(expected, 0) || !inner.containsBBox(bb) {
+		t.Errorf("expected bounds %v after deleting the extreme points, got %v", expected, bb)
+	}
+
+	// bulk loading and merging replace the contents wholesale
+	rt.InsertBatch(extremes)
+	if bb := rt.Bounds(); bb.min != (Point{-1000, -1000}) {
+		t.Errorf("expected bounds to grow after InsertBatch, got %v", bb)
+	}
+	bulk := NewTree(2, 4)
+	bulk.InsertBatch(objs)
+	if bb := bulk.Bounds(); !bb.Equal(inner, 0) {
+		t.Errorf("expected bounds %v after bulk loading, got %v", inner, bb)
+	}
+	small := NewTree(2, 4)
+	small.Insert(extremes[2])
+	small.Merge(bulk)
+	if bb := small.Bounds(); !bb.Equal(NewBBoxFromCorners(inner.min, Point{1000, inner.max.Y}), 0) {
+		t.Errorf("expected merged bounds to cover both trees, got %v", bb)
+	}
+	if bb := bulk.Bounds(); bb != nil {
+		t.Errorf("expected nil bounds for the emptied tree, got %v", bb)
+	}
+}
+
+func TestInsertOrReplace(t *testing.T) {
+	r := rand.New(rand.NewSource(73))
+	centers := []Point{{0, 0}, {10, 0}, {0, 10}, {10, 10}, {5, 5}}
+
+	rt := NewTree(2, 4)
+	latest := map[int]Spatial{}
+	for i := 0; i < 200; i++ {
+		k := r.Intn(len(centers))
+		c := centers[k]
+		// jitter of at most 0.1 in each coordinate
+		p := Point{c.X + r.Float64()*0.2 - 0.1, c.Y + r.Float64()*0.2 - 0.1}
+		obj := &place{fmt.Sprint(i), p.X, p.Y}
+		replaced := rt.InsertOrReplace(obj, 0.5)
+		if _, ok := latest[k]; replaced != ok {
+			t.Errorf("insert %d: expected replaced to be %v, got %v", i, ok, replaced)
+		}
+		latest[k] = obj
+		if rt.Size() != len(latest) {
+			t.Fatalf("insert %d: expected one entry per cluster, %d, got %d", i, len(latest), rt.Size())
+		}
+	}
+	if err := rt.Validate(); err != nil {
+		t.Errorf("%v", err)
+	}
+	for k, obj := range latest {
+		if found := rt.NearestNeighbor(centers[k]); found != obj {
+			t.Errorf("expected the latest object %v near %v, got %v", obj, centers[k], found)
+		}
+	}
+
+	// only the closest object within eps is replaced
+	rt = NewTree(2, 4)
+	a := &place{"a", 0, 0}
+	b := &place{"b", 1, 0}
+	rt.Insert(a)
+	rt.Insert(b)
+	c := &place{"c", 0.7, 0}
+	if !rt.InsertOrReplace(c, 1) {
+		t.Errorf("expected a replacement")
+	}
+	if all := rt.All(); !sameObjects(all, []Spatial{a, c}) {
+		t.Errorf("expected b to be replaced, leaving a and c, got %v", all)
+	}
+	if rt.InsertOrReplace(&place{"d", 3, 3}, 1) {
+		t.Errorf("expected no replacement beyond eps")
+	}
+	if rt.Size() != 3 {
+		t.Errorf("expected size 3, got %d", rt.Size())
+	}
+}
+
+func TestSearchIntersectSortedByDist(t *testing.T) {
+	r := rand.New(rand.NewSource(79))
+	rt := NewTree(3, 8)
+	objs := randomBBoxes(r, 1000)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+
+	for i := 0; i < 20; i++ {
+		q := mustBBox(Point{r.Float64()*1000 - 500, r.Float64()*1000 - 500}, []float64{200, 200})
+		p := Point{r.Float64()*1000 - 500, r.Float64()*1000 - 500}
+
+		var expected []Spatial
+		for _, obj := range objs {
+			if Closed.Overlaps(obj.Bounds(), q) {
+				expected = append(expected, obj)
+			}
+		}
+		sort.SliceStable(expected, func(i, j int) bool {
+			return expected[i].Bounds().DistToPoint(p) < expected[j].Bounds().DistToPoint(p)
+		})
+
+		found := rt.SearchIntersectSortedByDist(q, p)
+		if len(found) != len(expected) {
+			t.Fatalf("expected %d results for %v, got %d", len(expected), q, len(found))
+		}
+		for i := range found {
+			// objects at equal distances may come in either order
+			if d, e := found[i].Bounds().DistToPoint(p), expected[i].Bounds().DistToPoint(p); d != e {
+				t.Errorf("result %d: expected distance %v, got %v", i, e, d)
+			}
+		}
+		if !sameObjects(found, expected) {
+			t.Errorf("expected the same results as SearchIntersect for %v", q)
+		}
+	}
+
+	if found := rt.SearchIntersectSortedByDist(mustBBox(Point{600, 600}, []float64{1, 1}), Point{}); len(found) != 0 {
+		t.Errorf("expected no results, got %v", found)
+	}
+}
+
+func TestLeafCapacity(t *testing.T) {
+	r := rand.New(rand.NewSource(89))
+	objs := randomBBoxes(r, 600)
+	trees := map[string]*Rtree{
+		"quadratic": NewTree(2, 4, LeafCapacity(8, 20)),
+		"rstar":     NewTreeRStar(2, 4, LeafCapacity(8, 20)),
+		"linear":    NewTree(4, 12, LeafCapacity(2, 4), Splitter(LinearSplit{})),
+	}
+	for name, rt := range trees {
+		for _, obj := range objs {
+			rt.Insert(obj)
+		}
+		if err := rt.Validate(); err != nil {
+			t.Fatalf("%s: after inserts: %v", name, err)
+		}
+		stats := rt.LevelStats()
+		if leaves := stats[len(stats)-1]; leaves.MaxFill > rt.maxChildren(1) || leaves.MaxFill <= rt.minChildren(1) {
+			t.Errorf("%s: expected leaves filled within %d-%d, got %+v", name, rt.minChildren(1), rt.maxChildren(1), leaves)
+		}
+		for _, s := range stats[1 : len(stats)-1] {
+			if s.MaxFill > rt.MaxChildren {
+				t.Errorf("%s: expected branch nodes with at most %d entries, got %+v", name, rt.MaxChildren, s)
+			}
+		}
+
+		for _, q := range randomBBoxes(r, 50) {
+			bb := q.Bounds().Expand(5)
+			expected := []Spatial{}
+			for _, obj := range objs {
+				if Closed.Overlaps(obj.Bounds(), bb) {
+					expected = append(expected, obj)
+				}
+			}
+			if actual := rt.SearchIntersect(bb); !sameObjects(actual, expected) {
+				t.Errorf("%s: expected %d objects intersecting %v, got %d", name, len(expected), bb, len(actual))
+			}
+		}
+
+		for i, obj := range objs[:450] {
+			if !rt.Delete(obj) {
+				t.Fatalf("%s: failed to delete %v", name, obj)
+			}
+			if i%50 == 0 {
+				if err := rt.Validate(); err != nil {
+					t.Fatalf("%s: after %d deletes: %v", name, i+1, err)
+				}
+			}
+		}
+		if err := rt.Validate(); err != nil {
+			t.Errorf("%s: after deletes: %v", name, err)
+		}
+	}
+
+	for _, fill := range []float64{1, DefaultFillFactor} {
+		rt := NewTreeBulk(2, 4, fill, objs, LeafCapacity(8, 20))
+		if err := rt.Validate(); err != nil {
+			t.Errorf("bulk loaded with fill %v: %v", fill, err)
+		}
+		stats := rt.LevelStats()
+		if leaves, capacity := stats[len(stats)-1], int(math.Round(fill*20)); leaves.MaxFill > capacity || leaves.MaxFill <= rt.MaxChildren {
+			t.Errorf("bulk loaded with fill %v: expected leaves of up to %d entries, got %+v", fill, capacity, leaves)
+		}
+	}
+}
+
+func TestLevelStats(t *testing.T) {
+	rt := NewTree(3, 8)
+	if stats := rt.LevelStats(); stats != nil {
+		t.Errorf("expected no stats for an empty tree, got %v", stats)
+	}
+
+	objs := randomBBoxes(rand.New(rand.NewSource(83)), 1000)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	stats := rt.LevelStats()
+	if len(stats) != rt.Depth() {
+		t.Fatalf("expected stats for %d levels, got %v", rt.Depth(), stats)
+	}
+
+	root := stats[0]
+	if root.Level != rt.Depth() || root.Nodes != 1 || root.MinFill != root.MaxFill || root.AvgFill != float64(root.MinFill) {
+		t.Errorf("expected a single root node, got %+v", root)
+	}
+	for i, s := range stats {
+		if s.Level != len(stats)-i {
+			t.Errorf("expected level %d, got %+v", len(stats)-i, s)
+		}
+		if i > 0 {
+			if s.MinFill < rt.MinChildren || s.MaxFill > rt.MaxChildren {
+				t.Errorf("fill outside %d-%d: %+v", rt.MinChildren, rt.MaxChildren, s)
+			}
+			// each level holds exactly the entries of the level above
+			if parents := stats[i-1]; float64(s.Nodes) != parents.AvgFill*float64(parents.Nodes) {
+				t.Errorf("expected %v nodes below %+v, got %+v", parents.AvgFill*float64(parents.Nodes), parents, s)
+			}
+		}
+		if s.AvgFill < float64(s.MinFill) || s.AvgFill > float64(s.MaxFill) {
+			t.Errorf("average fill outside the range: %+v", s)
+		}
+	}
+	leaves := stats[len(stats)-1]
+	if total := leaves.AvgFill * float64(leaves.Nodes); math.Abs(total-float64(len(objs))) > EPS {
+		t.Errorf("expected leaves to hold %d objects, got %v", len(objs), total)
+	}
+	if leaves.Nodes < len(objs)/rt.MaxChildren || leaves.Nodes > len(objs)/rt.MinChildren {
+		t.Errorf("implausible number of leaves: %+v", leaves)
+	}
+
+	packed := NewTreeBulk(3, 8, 1, objs)
+	if leaves := packed.LevelStats()[packed.Depth()-1]; leaves.MaxFill != 8 || leaves.AvgFill < 7 {
+		t.Errorf("expected nearly full leaves, got %+v", leaves)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	rt := NewTree(2, 4)
+	if leafArea, rootArea := rt.Coverage(); leafArea != 0 || rootArea != 0 {
+		t.Errorf("expected no coverage for an empty tree, got %v and %v", leafArea, rootArea)
+	}
+
+	// leaves spanning [0, 3]x[0, 3] and [5, 7]x[0, 4], under a root spanning
+	// [0, 7]x[0, 4]
+	left := &node{leaf: true, level: 1, entries: []entry{
+		{bb: mustBBox(Point{0, 0}, []float64{1, 1})},
+		{bb: mustBBox(Point{2, 2}, []float64{1, 1})},
+	}}
+	right := &node{leaf: true, level: 1, entries: []entry{
+		{bb: mustBBox(Point{5, 0}, []float64{2, 1})},
+		{bb: mustBBox(Point{6, 3}, []float64{1, 1})},
+	}}
+	rt.root = &node{level: 2, entries: []entry{
+		{bb: left.computeBoundingBox(), child: left},
+		{bb: right.computeBoundingBox(), child: right},
+	}}
+	left.parent, right.parent = rt.root, rt.root
+	rt.height, rt.size = 2, 4
+	if err := rt.Validate(); err != nil {
+		t.Fatalf("invalid test tree: %v", err)
+	}
+
+	leafArea, rootArea := rt.Coverage()
+	if math.Abs(leafArea-17) > EPS || math.Abs(rootArea-28) > EPS {
+		t.Errorf("expected coverage 17 and 28, got %v and %v", leafArea, rootArea)
+	}
+
+	// a tree that is a single leaf covers the same area at both levels
+	single := NewTree(2, 4)
+	single.Insert(mustBBox(Point{1, 1}, []float64{2, 3}))
+	single.Insert(mustBBox(Point{2, 2}, []float64{1, 1}))
+	if leafArea, rootArea := single.Coverage(); leafArea != 6 || rootArea != 6 {
+		t.Errorf("expected coverage 6 and 6, got %v and %v", leafArea, rootArea)
+	}
+}
+
+func TestDeleteShrinkThenGrow(t *testing.T) {
+	rt := NewTree(2, 4)
+	objs := randomBBoxes(rand.New(rand.NewSource(2)), 20)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	// shrink the tree down to its root, then grow it again
+	for _, obj := range objs[1:] {
+		rt.Delete(obj)
+	}
+	for _, obj := range objs[1:] {
+		rt.Insert(obj)
+	}
+
+	verify(t, rt.root)
+	if rt.root.parent != nil {
+		t.Errorf("expected root to have no parent")
+	}
+	if rt.root.level != rt.Depth() {
+		t.Errorf("expected root level %d to match depth %d", rt.root.level, rt.Depth())
+	}
+}
+
+type movingThing struct {
+	bb *BBox
+}
+
+func (m *movingThing) Bounds() *BBox {
+	return m.bb
+}
+
+func TestUpdate(t *testing.T) {
+	rt := NewTree(3, 3)
+	things := []*BBox{
+		mustBBox(Point{0, 0}, []float64{2, 1}),
+		mustBBox(Point{3, 1}, []float64{1, 2}),
+		mustBBox(Point{1, 2}, []float64{2, 2}),
+		mustBBox(Point{8, 6}, []float64{1, 1}),
+		mustBBox(Point{10, 3}, []float64{1, 2}),
+		mustBBox(Point{11, 7}, []float64{1, 1}),
+		mustBBox(Point{0, 6}, []float64{1, 2}),
+		mustBBox(Point{1, 6}, []float64{1, 2}),
+	}
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+	mover := &movingThing{mustBBox(Point{0.5, 0.5}, []float64{0.5, 0.5})}
+	rt.Insert(mover)
+
+	oldBounds := mover.bb
+	mover.bb = mustBBox(Point{10.5, 7.5}, []float64{0.25, 0.25})
+	if !rt.Update(mover, oldBounds) {
+		t.Fatalf("Update failed to find %v at %v", mover, oldBounds)
+	}
+
+	if rt.Size() != len(things)+1 {
+		t.Errorf("expected Update to keep size %d, got %d", len(things)+1, rt.Size())
+	}
+	if q := rt.SearchIntersect(oldBounds); indexOf(q, mover) >= 0 {
+		t.Errorf("expected %v to be gone from its old location", mover)
+	}
+	if q := rt.SearchIntersect(mover.bb); indexOf(q, mover) < 0 {
+		t.Errorf("expected %v to be found at its new location", mover)
+	}
+	verify(t, rt.root)
+
+	// the object is no longer at its old bounds
+	if rt.Update(mover, oldBounds) {
+		t.Errorf("expected Update with stale bounds to fail")
+	}
+	if rt.Size() != len(things)+1 {
+		t.Errorf("expected failed Update to keep size %d, got %d", len(things)+1, rt.Size())
+	}
+}
+
+func TestNearestNeighborFiltered(t *testing.T) {
+	rt := NewTree(3, 3)
+	things := []*BBox{
+		mustBBox(Point{1, 1}, []float64{1, 1}),
+		mustBBox(Point{1, 3}, []float64{1, 1}),
+		mustBBox(Point{3, 2}, []float64{1, 1}),
+		mustBBox(Point{-7, -7}, []float64{1, 1}),
+		mustBBox(Point{7, 7}, []float64{1, 1}),
+		mustBBox(Point{10, 2}, []float64{1, 1}),
+		mustBBox(Point{12, 2}, []float64{1, 1}),
+	}
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+
+	rejected := map[Spatial]bool{things[0]: true, things[1]: true, things[5]: true}
+	accept := func(obj Spatial) bool {
+		return !rejected[obj]
+	}
+
+	tests := []struct {
+		p        Point
+		expected Spatial
+	}{
+		{Point{0.5, 0.5}, things[2]},
+		{Point{1.5, 4.5}, things[2]},
+		{Point{10.5, 2.5}, things[6]},
+		{Point{-6, -6}, things[3]},
+	}
+	for _, test := range tests {
+		if obj := rt.NearestNeighborFiltered(test.p, accept); obj != test.expected {
+			t.Errorf("NearestNeighborFiltered(%v) = %v, expected %v", test.p, obj, test.expected)
+		}
+	}
+
+	none := func(obj Spatial) bool { return false }
+	if obj := rt.NearestNeighborFiltered(Point{0, 0}, none); obj != nil {
+		t.Errorf("expected nil when every object is rejected, got %v", obj)
+	}
+}
+
+func TestNearestNeighborsWithin(t *testing.T) {
+	rt := NewTree(3, 3)
+	things := []*BBox{
+		mustBBox(Point{1, 1}, []float64{1, 1}),
+		mustBBox(Point{-7, -7}, []float64{1, 1}),
+		mustBBox(Point{1, 3}, []float64{1, 1}),
+		mustBBox(Point{7, 7}, []float64{1, 1}),
+		mustBBox(Point{10, 2}, []float64{1, 1}),
+		mustBBox(Point{3, 3}, []float64{1, 1}),
+	}
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+
+	p := Point{0.5, 0.5}
+	tests := []struct {
+		k        int
+		maxDist  float64
+		expected []Spatial
+	}{
+		{3, 100, []Spatial{things[0], things[2], things[5]}},
+		{3, 3, []Spatial{things[0], things[2]}},
+		{1, 3, []Spatial{things[0]}},
+		{5, 0.5, []Spatial{}},
+		{0, 100, []Spatial{}},
+	}
+	for _, test := range tests {
+		objs := rt.NearestNeighborsWithin(test.k, p, test.maxDist)
+		if !reflect.DeepEqual(objs, test.expected) {
+			t.Errorf("NearestNeighborsWithin(%d, %v, %v) = %v, expected %v", test.k, p, test.maxDist, objs, test.expected)
+		}
+	}
+}
+
+func TestNearestNeighborsWithinRandom(t *testing.T) {
+	rt := NewTree(3, 8)
+	objs := randomBBoxes(rand.New(rand.NewSource(1)), 300)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+
+	p := Point{10, -20}
+	maxDist := 60.0
+	q := rt.NearestNeighborsWithin(20, p, maxDist)
+
+	within := 0
+	for _, obj := range objs {
+		if obj.Bounds().DistToPoint(p) <= maxDist {
+			within++
+		}
+	}
+	if within > 20 {
+		within = 20
+	}
+	if len(q) != within {
+		t.Errorf("expected %d results, got %d", within, len(q))
+	}
+
+	last := 0.0
+	for _, obj := range q {
+		d := obj.Bounds().DistToPoint(p)
+		if d > maxDist || d < last {
+			t.Errorf("expected sorted results within %v, got distance %v after %v", maxDist, d, last)
+		}
+		last = d
+	}
+	for _, obj := range objs {
+		if indexOf(q, obj) < 0 && obj.Bounds().DistToPoint(p) < last {
+			t.Errorf("missed %v at distance %v", obj, obj.Bounds().DistToPoint(p))
+		}
+	}
+}
+
+func TestClosePairs(t *testing.T) {
+	rt := NewTree(2, 4)
+	if pairs := rt.ClosePairs(10); len(pairs) != 0 {
+		t.Errorf("expected no pairs in an empty tree, got %v", pairs)
+	}
+
+	r := rand.New(rand.NewSource(137))
+	objs := randomBBoxes(r, 300)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	for _, d := range []float64{0, 5, 20} {
+		expected := map[[2]Spatial]bool{}
+		for i, x := range objs {
+			for _, y := range objs[i+1:] {
+				if BBoxDist(x.Bounds(), y.Bounds()) <= d {
+					expected[[2]Spatial{x, y}] = true
+				}
+			}
+		}
+		if d > 0 && len(expected) == 0 {
+			t.Fatalf("expected the test data to contain pairs within %v", d)
+		}
+
+		actual := map[[2]Spatial]bool{}
+		for _, pair := range rt.ClosePairs(d) {
+			if pair[0] == pair[1] {
+				t.Errorf("within %v: object %v paired with itself", d, pair[0])
+			}
+			// store pairs in the order of the brute-force scan
+			if indexOf(objs, pair[0]) > indexOf(objs, pair[1]) {
+				pair[0], pair[1] = pair[1], pair[0]
+			}
+			if actual[pair] {
+				t.Errorf("within %v: pair %v emitted twice", d, pair)
+			}
+			actual[pair] = true
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("within %v: expected %d pairs, got %d", d, len(expected), len(actual))
+		}
+	}
+}
+
+func TestSpatialJoin(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	objsA := randomBBoxes(r, 150)
+	objsB := randomBBoxes(r, 40)
+	for i := range objsB {
+		// make the second set larger so that there are plenty of pairs
+		objsB[i] = objsB[i].Bounds().Expand(20)
+	}
+
+	a, b := NewTree(3, 5), NewTree(2, 3)
+	for _, obj := range objsA {
+		a.Insert(obj)
+	}
+	for _, obj := range objsB {
+		b.Insert(obj)
+	}
+
+	expected := map[[2]Spatial]bool{}
+	for _, x := range objsA {
+		for _, y := range objsB {
+			if Closed.Overlaps(x.Bounds(), y.Bounds()) {
+				expected[[2]Spatial{x, y}] = true
+			}
+		}
+	}
+	if len(expected) == 0 {
+		t.Fatalf("expected the test data to contain intersecting pairs")
+	}
+
+	actual := map[[2]Spatial]bool{}
+	SpatialJoin(a, b, func(x, y Spatial) {
+		pair := [2]Spatial{x, y}
+		if actual[pair] {
+			t.Errorf("pair %v emitted twice", pair)
+		}
+		actual[pair] = true
+	})
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("SpatialJoin emitted %d pairs, expected %d", len(actual), len(expected))
+	}
+
+	SpatialJoin(a, NewTree(3, 5), func(x, y Spatial) {
+		t.Errorf("expected no pairs when joining with an empty tree")
+	})
+
+	// boxes that only touch are joined under the BoundaryMode of a
+	left, right := mustBBox(Point{0, 0}, []float64{1, 1}), mustBBox(Point{1, 0}, []float64{1, 1})
+	for _, mode := range []BoundaryMode{Closed, HalfOpen} {
+		a, b := NewTree(2, 3, Boundary(mode)), NewTree(2, 3)
+		a.Insert(left)
+		b.Insert(right)
+		pairs := 0
+		SpatialJoin(a, b, func(x, y Spatial) { pairs++ })
+		if expected := map[BoundaryMode]int{Closed: 1, HalfOpen: 0}[mode]; pairs != expected {
+			t.Errorf("%v: expected %d pairs of touching boxes, got %d", mode, expected, pairs)
+		}
+	}
+}
+
+func TestSpatialJoinLockOrder(t *testing.T) {
+	a, b := NewTree(3, 5), NewTree(3, 5)
+	a.Insert(mustBBox(Point{0, 0}, []float64{1, 1}))
+	b.Insert(mustBBox(Point{0, 0}, []float64{1, 1}))
+	first, second := a, b
+	if reflect.ValueOf(b).Pointer() < reflect.ValueOf(a).Pointer() {
+		first, second = b, a
+	}
+
+	// a join waiting for the first tree must not hold the second, whichever
+	// order the trees are passed in, or joins in opposite orders deadlock
+	// when writers are waiting on both trees
+	first.mu.Lock()
+	done := make(chan bool)
+	go func() {
+		SpatialJoin(second, first, func(x, y Spatial) {})
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if !second.mu.TryLock() {
+		t.Errorf("SpatialJoin locked its first argument before its second")
+	} else {
+		second.mu.Unlock()
+	}
+	first.mu.Unlock()
+	<-done
+}
+
+func TestQuery(t *testing.T) {
+	rt := NewTree(3, 8)
+	if q := rt.Query(nil, nil); len(q) != 0 {
+		t.Errorf("expected no objects in an empty tree, got %v", q)
+	}
+
+	r := rand.New(rand.NewSource(103))
+	objs := randomBBoxes(r, 500)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	if q := rt.Query(nil, nil); !sameObjects(q, objs) {
+		t.Errorf("expected all %d objects, got %d", len(objs), len(q))
+	}
+
+	pruned, accepted := 0, 0
+	for _, q := range randomBBoxes(r, 50) {
+		bb := q.Bounds().Expand(r.Float64() * 100)
+		// SearchIntersect in terms of Query
+		actual := rt.Query(
+			func(nb *BBox) bool {
+				pruned++
+				return !touches(nb, bb)
+			},
+			func(obj Spatial) bool {
+				accepted++
+				return Closed.Overlaps(obj.Bounds(), bb)
+			})
+		if expected := rt.SearchIntersect(bb); !sameObjects(actual, expected) {
+			t.Errorf("expected %d objects intersecting %v, got %d", len(expected), bb, len(actual))
+		}
+
+		contained := rt.Query(
+			func(nb *BBox) bool { return !touches(nb, bb) },
+			func(obj Spatial) bool { return bb.containsBBox(obj.Bounds()) })
+		if expected := rt.SearchContained(bb); !sameObjects(contained, expected) {
+			t.Errorf("expected %d objects contained in %v, got %d", len(expected), bb, len(contained))
+		}
+
+		p, radius := bb.center(), r.Float64()*100
+		within := rt.Query(func(nb *BBox) bool { return nb.DistToPoint(p) > radius }, nil)
+		if expected := rt.SearchWithin(p, radius); !sameObjects(within, expected) {
+			t.Errorf("expected %d objects within %v of %v, got %d", len(expected), radius, p, len(within))
+		}
+	}
+	if accepted >= 50*len(objs) || pruned == 0 {
+		t.Errorf("expected pruning to skip objects, got %d acceptance tests", accepted)
+	}
+}
+
+func TestSearchContained(t *testing.T) {
+	rt := NewTree(3, 3)
+	things := []*BBox{
+		mustBBox(Point{0, 0}, []float64{2, 1}),
+		mustBBox(Point{3, 1}, []float64{1, 2}),
+		mustBBox(Point{1, 2}, []float64{2, 2}),
+		mustBBox(Point{8, 6}, []float64{1, 1}),
+		mustBBox(Point{10, 3}, []float64{1, 2}),
+		mustBBox(Point{11, 7}, []float64{1, 1}),
+		mustBBox(Point{2, 6}, []float64{1, 2}),
+		mustBBox(Point{3, 6}, []float64{1, 2}),
+		mustBBox(Point{2, 8}, []float64{1, 2}),
+		mustBBox(Point{3, 8}, []float64{1, 2}),
+	}
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+
+	bb := mustBBox(Point{1, 1.5}, []float64{10, 7.5})
+	q := rt.SearchContained(bb)
+
+	// things 1, 8 and 9 overlap bb without being inside it
+	expected := []int{2, 3, 4, 6, 7}
+	if len(q) != len(expected) {
+		t.Errorf("SearchContained found %d objects, expected %d", len(q), len(expected))
+	}
+	for _, ind := range expected {
+		if indexOf(q, things[ind]) < 0 {
+			t.Errorf("SearchContained failed to find things[%d]", ind)
+		}
+	}
+
+	if q := rt.SearchContained(things[3]); len(q) != 1 || q[0] != things[3] {
+		t.Errorf("expected an object to be contained in its own bounds, got %v", q)
+	}
+}
+
+func TestSearchContainingPoint(t *testing.T) {
+	rt := NewTree(2, 3)
+	things := []*BBox{
+		mustBBox(Point{0, 0}, []float64{10, 10}),
+		mustBBox(Point{2, 2}, []float64{4, 4}),
+		mustBBox(Point{3, 3}, []float64{1, 1}),
+		mustBBox(Point{6, 2}, []float64{2, 2}),
+		mustBBox(Point{20, 20}, []float64{1, 1}),
+		mustBBox(Point{-5, -5}, []float64{2, 2}),
+		mustBBox(Point{15, 0}, []float64{5, 5}),
+	}
+	for _, thing := range things {
+		rt.Insert(thing)
+	}
+
+	tests := []struct {
+		p        Point
+		expected []int
+	}{
+		{Point{3.5, 3.5}, []int{0, 1, 2}},
+		{Point{6, 3}, []int{0, 1, 3}}, // on the edge shared by things 1 and 3
+		{Point{1, 1}, []int{0}},
+		{Point{10, 10}, []int{0}}, // a corner
+		{Point{12, 12}, []int{}},
+	}
+	for _, test := range tests {
+		q := rt.SearchContainingPoint(test.p)
+		if len(q) != len(test.expected) {
+			t.Errorf("SearchContainingPoint(%v) found %d objects, expected %d", test.p, len(q), len(test.expected))
+		}
+		for _, ind := range test.expected {
+			if indexOf(q, things[ind]) < 0 {
+				t.Errorf("SearchContainingPoint(%v) failed to find things[%d]", test.p, ind)
+			}
+		}
+	}
+}
+
+func TestSearchIntersectUnique(t *testing.T) {
+	objs := randomBBoxes(rand.New(rand.NewSource(71)), 100)
+	rt := NewTree(2, 4)
+	for _, obj := range objs {
+		rt.Insert(obj)
+	}
+	dup := objs[17]
+	rt.Insert(dup)
+
+	bb := dup.Bounds()
+	count := func(results []Spatial) int {
+		n := 0
+		for _, obj := range results {
+			if obj == dup {
+				n++
+			}
+		}
+		return n
+	}
+	plain, unique := rt.SearchIntersect(bb), rt.SearchIntersectUnique(bb)
+	if n := count(plain); n != 2 {
+		t.Errorf("expected SearchIntersect to return the duplicate twice, got %d", n)
+	}
+	if n := count(unique); n != 1 {
+		t.Errorf("expected SearchIntersectUnique to return the duplicate once, got %d", n)
+	}
+	if len(unique) != len(plain)-1 {
+		t.Errorf("expected %d unique results, got %d", len(plain)-1, len(unique))
+	}
+
+	// uncomparable objects are deduplicated by the configured equality
+	sameTags := func(obj1, obj2 Spatial) bool {
+		return reflect.DeepEqual(obj1.(tagged).tags, obj2.(tagged).tags)
+	}
+	tt := NewTree(2, 4, Equal(sameTags))
+	for i := 0; i < 10; i++ {
+		tt.Insert(tagged{mustBBox(Point{float64(i), 0}, []float64{1, 1}), []string{fmt.Sprint(i)}})
+	}
+	tt.Insert(tagged{mustBBox(Point{3, 0}, []float64{1, 1}), []string{"3"}})
+	query := mustBBox(Point{2.5, 0.5}, []float64{1, 0})
+	if n := len(tt.SearchIntersect(query)); n != 3 {
+		t.Errorf("expected 3 results, got %d", n)
+	}
+	if results := tt.SearchIntersectUnique(query); len(results) != 2 {
+		t.Errorf("expected 2 unique results, got %v", results)
+	}
+}
+
+func TestSearchIntersectSorted(t *testing.T) {
+	objs := randomBBoxes(rand.New(rand.NewSource(1)), 200)
+
+	forward, backward, batch := NewTree(3, 5), NewTree(2, 4), NewTree(3, 5)
+	for i := range objs {
+		forward.Insert(objs[i])
+		backward.Insert(objs[len(objs)-1-i])
+	}
+	batch.InsertBatch(objs)
+
+	less := func(a, b Spatial) bool {
+		p, q := a.Bounds().min, b.Bounds().min
+		return p.X < q.X || (p.X == q.X && p.Y < q.Y)
+	}
+
+	bb := mustBBox(Point{-300, -300}, []float64{500, 400})
+	expected := forward.SearchIntersectSorted(bb, less)
+	if len(expected) == 0 {
+		t.Fatalf("expected the query to find objects")
+	}
+	for i := 1; i < len(expected); i++ {
+		if less(expected[i], expected[i-1]) {
+			t.Errorf("results not sorted at index %d", i)
+		}
+	}
+	for _, rt := range []*Rtree{backward, batch} {
+		if q := rt.SearchIntersectSorted(bb, less); !reflect.DeepEqual(q, expected) {
+			t.Errorf("expected identical order across trees, got %v and %v", q, expected)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	rt := NewTree(1, 2)
+	if s := rt.String(); s != "empty\n" {
+		t.Errorf("expected empty dump, got %q", s)
+	}
+
+	a := mustBBox(Point{0, 0}, []float64{1, 1})
+	b := mustBBox(Point{2, 0}, []float64{1, 2})
+	c := mustBBox(Point{5, 5}, []float64{1, 1})
+	left := &node{leaf: true, level: 1, entries: []entry{{bb: a, obj: a}, {bb: b, obj: b}}}
+	right := &node{leaf: true, level: 1, entries: []entry{{bb: c, obj: c}}}
+	rt.root = &node{level: 2, entries: []entry{
+		{bb: left.computeBoundingBox(), child: left},
+		{bb: right.computeBoundingBox(), child: right},
+	}}
+	left.parent, right.parent = rt.root, rt.root
+	rt.height, rt.size = 2, 3
+
+	expected := `level 2 [0.00, 0.00]x[6.00, 6.00]
+  level 1 [0.00, 0.00]x[3.00, 2.00]
+    object [0.00, 0.00]x[1.00, 1.00]
+    object [2.00, 0.00]x[3.00, 2.00]
+  level 1 [5.00, 5.00]x[6.00, 6.00]
+    object [5.00, 5.00]x[6.00, 6.00]
+`
+	if s := rt.String(); s != expected {
+		t.Errorf("unexpected dump:\n%s\nexpected:\n%s", s, expected)
+	}
+
+	var buf bytes.Buffer
+	if err := rt.Dump(&buf, 1); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	expected = `level 2 [0.00, 0.00]x[6.00, 6.00]
+  ... 3 objects
+`
+	if s := buf.String(); s != expected {
+		t.Errorf("unexpected truncated dump:\n%s\nexpected:\n%s", s, expected)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	rt := NewTree(1, 2)
+	var buf bytes.Buffer
+	if err := rt.WriteDOT(&buf); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	if s := buf.String(); s != "digraph rtree {\n\tnode [shape=box];\n}\n" {
+		t.Errorf("unexpected DOT for empty tree: %q", s)
+	}
+
+	a := mustBBox(Point{0, 0}, []float64{1, 1})
+	b := mustBBox(Point{2, 0}, []float64{1, 2})
+	c := mustBBox(Point{5, 5}, []float64{1, 1})
+	left := &node{leaf: true, level: 1, entries: []entry{{bb: a, obj: a}, {bb: b, obj: b}}}
+	right := &node{leaf: true, level: 1, entries: []entry{{bb: c, obj: c}}}
+	rt.root = &node{level: 2, entries: []entry{
+		{bb: left.computeBoundingBox(), child: left},
+		{bb: right.computeBoundingBox(), child: right},
+	}}
+	left.parent, right.parent = rt.root, rt.root
+	rt.height, rt.size = 2, 3
+
+	buf.Reset()
+	if err := rt.WriteDOT(&buf); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	s := buf.String()
+	if !strings.HasPrefix(s, "digraph rtree {\n") || !strings.HasSuffix(s, "}\n") {
+		t.Errorf("DOT output is not a digraph:\n%s", s)
+	}
+	for _, line := range []string{
+		`n0 [label="level 2\n[0.00, 0.00]x[6.00, 6.00]"];`,
+		`n1 [label="level 1\n[0.00, 0.00]x[3.00, 2.00]\n[0.00, 0.00]x[1.00, 1.00]\n[2.00, 0.00]x[3.00, 2.00]"];`,
+		`n2 [label="level 1\n[5.00, 5.00]x[6.00, 6.00]\n[5.00, 5.00]x[6.00, 6.00]"];`,
+		"n0 -> n1;",
+		"n0 -> n2;",
+	} {
+		if !strings.Contains(s, "\t"+line+"\n") {
+			t.Errorf("DOT output missing line %s:\n%s", line, s)
+		}
+	}
+	if strings.Contains(s, "n1 ->") || strings.Contains(s, "n2 ->") {
+		t.Errorf("DOT output has edges out of leaves:\n%s", s)
+	}
+
+	// only quotes and backslashes are escaped in labels, not tabs as by %q
+	rt = NewTree(1, 2)
+	rt.Insert(place{`say "héllo"` + "\t" + `C:\tmp`, 1, 2})
+	buf.Reset()
+	if err := rt.WriteDOT(&buf); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	line := `n0 [label="level 1\n[0.50, 1.50]x[1.50, 2.50]\n{say \"héllo\"` + "\t" + `C:\\tmp 1 2}"];`
+	if !strings.Contains(buf.String(), "\t"+line+"\n") {
+		t.Errorf("DOT output missing line %s:\n%s", line, buf.String())
+	}
+}
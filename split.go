@@ -0,0 +1,207 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"fmt"
+	"math"
+)
+
+// SplitStrategy divides the entries of an overflowing node between two new
+// nodes.
+type SplitStrategy interface {
+	// Split partitions boxes, the bounding boxes of the entries of an
+	// overflowing node, into two groups given as indices into boxes.  Every
+	// index must appear in exactly one group and neither group may be empty,
+	// or the tree panics; each group should also hold at least minFill
+	// indices.
+	Split(boxes []*BBox, minFill int) (left, right []int)
+}
+
+// Splitter selects the algorithm used to split overflowing nodes.  By
+// default, trees created by NewTree use QuadraticSplit and trees created by
+// NewTreeRStar use the R*-tree split.
+func Splitter(s SplitStrategy) Option {
+	return func(tree *Rtree) {
+		tree.splitter = s
+	}
+}
+
+// splitWith splits a node into the two groups chosen by s.
+func (n *node) splitWith(s SplitStrategy, minGroupSize int) (left, right *node) {
+	boxes := make([]*BBox, len(n.entries))
+	for i, e := range n.entries {
+		boxes[i] = e.bb
+	}
+	l, r := s.Split(boxes, minGroupSize)
+	if err := checkPartition(len(boxes), l, r); err != nil {
+		panic(fmt.Errorf("rtree: split strategy %T: %v", s, err))
+	}
+
+	// setup the new split nodes, but re-use n as the left node
+	entries := n.entries
+	left = n
+	left.entries = make([]entry, 0, len(l))
+	right = &node{
+		parent:  n.parent,
+		leaf:    n.leaf,
+		level:   n.level,
+		entries: make([]entry, 0, len(r)),
+	}
+	for _, i := range l {
+		assign(entries[i], left)
+	}
+	for _, i := range r {
+		assign(entries[i], right)
+	}
+	return
+}
+
+// checkPartition returns an error unless the non-empty groups l and r
+// together hold each of the indices 0 to n-1 exactly once.
+func checkPartition(n int, l, r []int) error {
+	if len(l) == 0 || len(r) == 0 {
+		return fmt.Errorf("empty group in split of %d entries", n)
+	}
+	seen := make([]bool, n)
+	for _, group := range [][]int{l, r} {
+		for _, i := range group {
+			if i < 0 || i >= n {
+				return fmt.Errorf("index %d out of range in split of %d entries", i, n)
+			}
+			if seen[i] {
+				return fmt.Errorf("index %d assigned twice", i)
+			}
+			seen[i] = true
+		}
+	}
+	if len(l)+len(r) != n {
+		return fmt.Errorf("%d of %d entries assigned", len(l)+len(r), n)
+	}
+	return nil
+}
+
+// QuadraticSplit is the quadratic-cost split algorithm of Guttman's R-tree.
+// It seeds the two groups with the pair of entries that would waste the most
+// area if grouped together, then repeatedly assigns the entry with the
+// strongest preference for one group.
+type QuadraticSplit struct{}
+
+// splitIndex marks the position of an entry handed to node.split, so that
+// the resulting groups can be reported as indices.
+type splitIndex int
+
+func (splitIndex) Bounds() *BBox { return nil }
+
+// Split implements SplitStrategy.
+func (QuadraticSplit) Split(boxes []*BBox, minFill int) (left, right []int) {
+	n := &node{entries: make([]entry, len(boxes)), leaf: true}
+	for i, bb := range boxes {
+		n.entries[i] = entry{bb: bb, obj: splitIndex(i)}
+	}
+	l, r := n.split(minFill)
+	for _, e := range l.entries {
+		left = append(left, int(e.obj.(splitIndex)))
+	}
+	for _, e := range r.entries {
+		right = append(right, int(e.obj.(splitIndex)))
+	}
+	return
+}
+
+// LinearSplit is the linear-cost split algorithm of Guttman's R-tree.  It
+// seeds the two groups with the pair of entries that are farthest apart
+// relative to the extent of all entries along some axis, then assigns the
+// remaining entries in order to the group needing the least enlargement.
+// It splits faster than QuadraticSplit but tends to produce more overlap.
+type LinearSplit struct{}
+
+// Split implements SplitStrategy.
+func (LinearSplit) Split(boxes []*BBox, minFill int) (left, right []int) {
+	l, r := linearPickSeeds(boxes)
+	left, right = []int{l}, []int{r}
+	leftBB, rightBB := boxes[l], boxes[r]
+
+	remaining := len(boxes) - 2
+	for i, bb := range boxes {
+		if i == l || i == r {
+			continue
+		}
+
+		// honor the minimum fill by handing the rest to a short group
+		toLeft := false
+		if remaining+len(left) <= minFill {
+			toLeft = true
+		} else if remaining+len(right) <= minFill {
+			toLeft = false
+		} else {
+			leftEnlarged, rightEnlarged := boundingBox(leftBB, bb), boundingBox(rightBB, bb)
+			leftDiff := enlargement(leftBB, bb)
+			rightDiff := enlargement(rightBB, bb)
+			leftMargin := leftEnlarged.margin() - leftBB.margin()
+			rightMargin := rightEnlarged.margin() - rightBB.margin()
+			switch {
+			case leftDiff != rightDiff:
+				toLeft = leftDiff < rightDiff
+			case leftBB.size() != rightBB.size():
+				toLeft = leftBB.size() < rightBB.size()
+			case leftMargin != rightMargin:
+				toLeft = leftMargin < rightMargin
+			default:
+				toLeft = len(left) <= len(right)
+			}
+		}
+
+		if toLeft {
+			left = append(left, i)
+			leftBB = boundingBox(leftBB, bb)
+		} else {
+			right = append(right, i)
+			rightBB = boundingBox(rightBB, bb)
+		}
+		remaining--
+	}
+	return
+}
+
+// linearPickSeeds chooses the two boxes with the greatest normalized
+// separation along either axis.
+func linearPickSeeds(boxes []*BBox) (int, int) {
+	axes := [2]func(p Point) float64{
+		func(p Point) float64 { return p.X },
+		func(p Point) float64 { return p.Y },
+	}
+
+	left, right := 0, 1
+	maxSeparation := math.Inf(-1)
+	for _, coord := range axes {
+		// highLow has the highest low side, lowHigh the lowest high side
+		highLow, lowHigh := 0, 0
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for i, bb := range boxes {
+			if coord(bb.min) > coord(boxes[highLow].min) {
+				highLow = i
+			}
+			if coord(bb.max) < coord(boxes[lowHigh].max) {
+				lowHigh = i
+			}
+			lo = math.Min(lo, coord(bb.min))
+			hi = math.Max(hi, coord(bb.max))
+		}
+		if highLow == lowHigh {
+			continue
+		}
+
+		separation := coord(boxes[highLow].min) - coord(boxes[lowHigh].max)
+		if width := hi - lo; width > 0 {
+			separation /= width
+		}
+		if separation > maxSeparation {
+			maxSeparation = separation
+			left, right = lowHigh, highLow
+		}
+	}
+	return left, right
+}
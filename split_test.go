@@ -0,0 +1,134 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+var splitStrategies = map[string]SplitStrategy{
+	"quadratic": QuadraticSplit{},
+	"linear":    LinearSplit{},
+}
+
+func TestSplitStrategyPartitions(t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	for name, s := range splitStrategies {
+		for _, minFill := range []int{1, 2, 4} {
+			for trial := 0; trial < 20; trial++ {
+				objs := randomBBoxes(r, 9)
+				boxes := make([]*BBox, len(objs))
+				for i, obj := range objs {
+					boxes[i] = obj.Bounds()
+				}
+
+				left, right := s.Split(boxes, minFill)
+				if len(left) < minFill || len(right) < minFill {
+					t.Errorf("%s: groups of %d and %d violate min fill %d", name, len(left), len(right), minFill)
+				}
+				all := append(append([]int{}, left...), right...)
+				sort.Ints(all)
+				for i := range boxes {
+					if i >= len(all) || all[i] != i {
+						t.Fatalf("%s: %v and %v do not partition %d boxes", name, left, right, len(boxes))
+					}
+				}
+				if len(all) != len(boxes) {
+					t.Fatalf("%s: %v and %v do not partition %d boxes", name, left, right, len(boxes))
+				}
+			}
+		}
+	}
+}
+
+func TestLinearSplitSeeds(t *testing.T) {
+	boxes := []*BBox{
+		mustBBox(Point{0, 0}, []float64{1, 1}),
+		mustBBox(Point{1, 0.5}, []float64{1, 1}),
+		mustBBox(Point{9, 0}, []float64{1, 1}),
+		mustBBox(Point{2, 0}, []float64{1, 1}),
+	}
+	l, r := linearPickSeeds(boxes)
+	if l != 0 || r != 2 {
+		t.Errorf("expected seeds 0 and 2, got %d and %d", l, r)
+	}
+
+	left, right := LinearSplit{}.Split(boxes, 1)
+	if len(left) != 3 || len(right) != 1 || right[0] != 2 {
+		t.Errorf("expected the far box alone, got %v and %v", left, right)
+	}
+}
+
+func TestSplitStrategyTrees(t *testing.T) {
+	objs := randomBBoxes(rand.New(rand.NewSource(7)), 500)
+	trees := map[string]*Rtree{}
+	for name, s := range splitStrategies {
+		trees[name] = NewTree(3, 8, Splitter(s))
+		trees[name+" R*"] = NewTreeRStar(3, 8, Splitter(s))
+	}
+
+	for name, rt := range trees {
+		for _, obj := range objs {
+			rt.Insert(obj)
+		}
+		if rt.Size() != len(objs) {
+			t.Errorf("%s: expected size %d, got %d", name, len(objs), rt.Size())
+		}
+		verify(t, rt.root)
+		verifyStructure(t, rt, rt.root)
+		for _, obj := range objs {
+			if q := rt.SearchIntersect(obj.Bounds()); indexOf(q, obj) < 0 {
+				t.Errorf("%s: SearchIntersect failed to find %v", name, obj)
+			}
+		}
+	}
+}
+
+// fixedSplitter returns the same groups for every split.
+type fixedSplitter struct {
+	left, right []int
+}
+
+func (s fixedSplitter) Split(boxes []*BBox, minFill int) (left, right []int) {
+	return s.left, s.right
+}
+
+func TestSplitStrategyInvalid(t *testing.T) {
+	tests := []struct {
+		left, right []int
+		valid       bool
+	}{
+		{[]int{0, 2}, []int{1, 3}, true},
+		{[]int{0, 1, 2}, []int{3}, true},
+		{[]int{0, 1, 2, 3}, nil, false},
+		{[]int{0, 1}, []int{1, 3}, false},
+		{[]int{0, 1}, []int{2}, false},
+		{[]int{0, 1}, []int{2, 4}, false},
+		{[]int{-1, 1}, []int{2, 3}, false},
+	}
+	for _, test := range tests {
+		if err := checkPartition(4, test.left, test.right); (err == nil) != test.valid {
+			t.Errorf("checkPartition(4, %v, %v) = %v, expected valid %v", test.left, test.right, err, test.valid)
+		}
+
+		// a tree of capacity 3 splits when the fourth object is inserted
+		rt := NewTree(1, 3, Splitter(fixedSplitter{test.left, test.right}))
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			for _, obj := range randomBBoxes(rand.New(rand.NewSource(8)), 4) {
+				rt.Insert(obj)
+			}
+			return false
+		}()
+		if panicked == test.valid {
+			t.Errorf("split into %v and %v: expected panic %v, got %v", test.left, test.right, !test.valid, panicked)
+		}
+		if test.valid {
+			verify(t, rt.root)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+// TreeOf is an R-tree holding values of type T, which need not implement
+// Spatial.  It wraps an Rtree, computing the bounds of each value with the
+// function given to NewTreeOf, and returns query results as []T so that
+// callers need no type assertions.
+type TreeOf[T any] struct {
+	tree   *Rtree
+	bounds func(T) *BBox
+}
+
+// item adapts a value stored in a TreeOf to the Spatial interface.
+type item[T any] struct {
+	value T
+	bb    *BBox
+}
+
+func (it *item[T]) Bounds() *BBox {
+	return it.bb
+}
+
+// NewTreeOf creates a new typed R-tree with the given branching factors,
+// using bounds to compute the bounding box of each inserted value.
+func NewTreeOf[T any](MinChildren, MaxChildren int, bounds func(T) *BBox) *TreeOf[T] {
+	return &TreeOf[T]{tree: NewTree(MinChildren, MaxChildren), bounds: bounds}
+}
+
+// Size returns the number of values currently stored in t.
+func (t *TreeOf[T]) Size() int {
+	return t.tree.Size()
+}
+
+// Insert inserts v into t.  Its bounds are computed once, on insertion.
+func (t *TreeOf[T]) Insert(v T) {
+	t.tree.Insert(&item[T]{value: v, bb: t.bounds(v)})
+}
+
+// SearchIntersect returns all values whose bounds intersect bb.
+func (t *TreeOf[T]) SearchIntersect(bb *BBox) []T {
+	return values[T](t.tree.SearchIntersect(bb))
+}
+
+// NearestNeighbor returns the value closest to p.  The boolean result is
+// false if t is empty.
+func (t *TreeOf[T]) NearestNeighbor(p Point) (T, bool) {
+	obj := t.tree.NearestNeighbor(p)
+	if obj == nil {
+		var zero T
+		return zero, false
+	}
+	return obj.(*item[T]).value, true
+}
+
+// NearestNeighbors returns up to k values closest to p, nearest first.
+func (t *TreeOf[T]) NearestNeighbors(k int, p Point) []T {
+	return values[T](t.tree.NearestNeighbors(k, p))
+}
+
+// values unwraps the items in objs, skipping nil results.
+func values[T any](objs []Spatial) []T {
+	vs := make([]T, 0, len(objs))
+	for _, obj := range objs {
+		if obj != nil {
+			vs = append(vs, obj.(*item[T]).value)
+		}
+	}
+	return vs
+}
@@ -0,0 +1,60 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"sort"
+	"testing"
+)
+
+type city struct {
+	name     string
+	location Point
+}
+
+func cityBounds(c city) *BBox {
+	return c.location.ToBBox(0.01)
+}
+
+func TestTreeOf(t *testing.T) {
+	rt := NewTreeOf(2, 4, cityBounds)
+	if _, ok := rt.NearestNeighbor(Point{0, 0}); ok {
+		t.Errorf("expected no nearest neighbor in an empty tree")
+	}
+
+	cities := []city{
+		{"a", Point{0, 0}},
+		{"b", Point{1, 1}},
+		{"c", Point{5, 5}},
+		{"d", Point{6, 5}},
+		{"e", Point{-4, 3}},
+		{"f", Point{9, -2}},
+	}
+	for _, c := range cities {
+		rt.Insert(c)
+	}
+	if rt.Size() != len(cities) {
+		t.Errorf("expected size %d, got %d", len(cities), rt.Size())
+	}
+
+	found := rt.SearchIntersect(mustBBox(Point{-1, -1}, []float64{8, 7}))
+	names := []string{}
+	for _, c := range found {
+		names = append(names, c.name)
+	}
+	sort.Strings(names)
+	if len(names) != 4 || names[0] != "a" || names[1] != "b" || names[2] != "c" || names[3] != "d" {
+		t.Errorf("unexpected search results %v", names)
+	}
+
+	if c, ok := rt.NearestNeighbor(Point{5.8, 5.2}); !ok || c.name != "d" {
+		t.Errorf("expected nearest neighbor d, got %v", c)
+	}
+
+	near := rt.NearestNeighbors(10, Point{0.1, 0.1})
+	if len(near) != len(cities) || near[0].name != "a" || near[1].name != "b" {
+		t.Errorf("unexpected nearest neighbors %v", near)
+	}
+}
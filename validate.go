@@ -0,0 +1,93 @@
+// Copyright 2012 Daniel Connelly.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rtree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate checks the structural invariants of tree and returns an error
+// describing the first violation found, or nil if there is none.  It checks
+// that all leaves are at the same depth, that every node other than the root
+// has between MinChildren and MaxChildren entries, or those set by
+// LeafCapacity for leaves, that the bounding box recorded for each node is
+// exactly the union of its entries' bounding boxes, and that Size matches the
+// number of stored objects.  It is intended for tests, for example of a
+// custom SplitStrategy.
+func (tree *Rtree) Validate() error {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.root == nil {
+		return errors.New("rtree: tree has no root")
+	}
+	if tree.root.parent != nil {
+		return errors.New("rtree: root has a parent")
+	}
+	count := 0
+	if err := tree.validate(tree.root, nil, 1, &count); err != nil {
+		return err
+	}
+	if count != tree.size {
+		return fmt.Errorf("rtree: size is %d but tree stores %d objects", tree.size, count)
+	}
+	return nil
+}
+
+// validate checks the subtree rooted at n, which is at the given depth and
+// whose bounding box is recorded as bb in its parent, adding the number of
+// objects stored in it to count.
+func (tree *Rtree) validate(n *node, bb *BBox, depth int, count *int) error {
+	if n.leaf && depth != tree.height {
+		return fmt.Errorf("rtree: leaf at depth %d, expected all leaves at depth %d", depth, tree.height)
+	}
+	if !n.leaf && depth >= tree.height {
+		return fmt.Errorf("rtree: non-leaf node at depth %d, below the leaves at depth %d", depth, tree.height)
+	}
+	if n.level != tree.height-depth+1 {
+		return fmt.Errorf("rtree: node at depth %d has level %d, expected %d", depth, n.level, tree.height-depth+1)
+	}
+
+	if n == tree.root {
+		if len(n.entries) > tree.maxChildren(n.level) {
+			return fmt.Errorf("rtree: root has %d children, more than %d", len(n.entries), tree.maxChildren(n.level))
+		}
+		if !n.leaf && len(n.entries) < 2 {
+			return fmt.Errorf("rtree: non-leaf root has %d children, fewer than 2", len(n.entries))
+		}
+	} else {
+		if min, max := tree.minChildren(n.level), tree.maxChildren(n.level); len(n.entries) < min || len(n.entries) > max {
+			return fmt.Errorf("rtree: node at level %d has %d children, outside %d-%d",
+				n.level, len(n.entries), min, max)
+		}
+		if actual := n.computeBoundingBox(); !bb.Equal(actual, 0) {
+			return fmt.Errorf("rtree: node at level %d has bounding box %v, but its children span %v", n.level, bb, actual)
+		}
+	}
+
+	for _, e := range n.entries {
+		if e.bb == nil {
+			return fmt.Errorf("rtree: node at level %d has an entry with no bounding box", n.level)
+		}
+		if n.leaf {
+			if e.child != nil {
+				return errors.New("rtree: leaf has a child node")
+			}
+			*count++
+			continue
+		}
+		if e.child == nil {
+			return fmt.Errorf("rtree: node at level %d has an entry with no child", n.level)
+		}
+		if e.child.parent != n {
+			return fmt.Errorf("rtree: node at level %d has the wrong parent", e.child.level)
+		}
+		if err := tree.validate(e.child, e.bb, depth+1, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
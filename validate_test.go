@@ -0,0 +1,151 @@
+package rtree
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	r := rand.New(rand.NewSource(19))
+	trees := map[string]*Rtree{
+		"quadratic": NewTree(3, 7),
+		"rstar":     NewTreeRStar(3, 7),
+		"linear":    NewTree(3, 7, Splitter(LinearSplit{})),
+	}
+	for name, rt := range trees {
+		if err := rt.Validate(); err != nil {
+			t.Errorf("%s: empty tree: %v", name, err)
+		}
+		objs := randomBBoxes(r, 400)
+		for _, obj := range objs {
+			rt.Insert(obj)
+		}
+		if err := rt.Validate(); err != nil {
+			t.Fatalf("%s: after inserts: %v", name, err)
+		}
+		for i, obj := range objs[:300] {
+			if !rt.Delete(obj) {
+				t.Fatalf("%s: failed to delete %v", name, obj)
+			}
+			if err := rt.Validate(); err != nil {
+				t.Fatalf("%s: after %d deletes: %v", name, i+1, err)
+			}
+		}
+		rt.DeleteIntersecting(mustBBox(Point{-5, -5}, []float64{10, 10}))
+		if err := rt.Validate(); err != nil {
+			t.Errorf("%s: after region delete: %v", name, err)
+		}
+	}
+
+	for _, n := range []int{1, 7, 8, 50, 301} {
+		rt := NewTree(3, 7)
+		rt.InsertBatch(randomBBoxes(r, n))
+		if err := rt.Validate(); err != nil {
+			t.Errorf("bulk loaded %d objects: %v", n, err)
+		}
+	}
+}
+
+func TestValidateCorrupt(t *testing.T) {
+	build := func() *Rtree {
+		rt := NewTree(2, 4)
+		for _, obj := range randomBBoxes(rand.New(rand.NewSource(23)), 100) {
+			rt.Insert(obj)
+		}
+		if rt.Depth() < 3 {
+			t.Fatalf("expected a tree of depth at least 3, got %d", rt.Depth())
+		}
+		if err := rt.Validate(); err != nil {
+			t.Fatalf("unexpected error before corruption: %v", err)
+		}
+		return rt
+	}
+	firstLeaf := func(rt *Rtree) *node {
+		n := rt.root
+		for !n.leaf {
+			n = n.entries[0].child
+		}
+		return n
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(rt *Rtree)
+		want    string
+	}{
+		{
+			"unbalanced",
+			func(rt *Rtree) {
+				// hoist a leaf up to replace its parent
+				leaf := firstLeaf(rt)
+				parent := leaf.parent
+				*parent.getEntry() = entry{bb: leaf.computeBoundingBox(), child: leaf}
+				leaf.parent = parent.parent
+			},
+			"depth",
+		},
+		{
+			"underfull",
+			func(rt *Rtree) {
+				leaf := firstLeaf(rt)
+				leaf.entries = leaf.entries[:1]
+			},
+			"children",
+		},
+		{
+			"overfull",
+			func(rt *Rtree) {
+				leaf := firstLeaf(rt)
+				for len(leaf.entries) <= rt.MaxChildren {
+					leaf.entries = append(leaf.entries, leaf.entries[0])
+				}
+			},
+			"children",
+		},
+		{
+			"loose bounding box",
+			func(rt *Rtree) {
+				e := firstLeaf(rt).parent.getEntry()
+				bb := *e.bb
+				bb.max.X++
+				e.bb = &bb
+			},
+			"bounding box",
+		},
+		{
+			"tight bounding box",
+			func(rt *Rtree) {
+				leaf := firstLeaf(rt)
+				e := leaf.getEntry()
+				e.bb = leaf.entries[0].bb
+			},
+			"bounding box",
+		},
+		{
+			"size",
+			func(rt *Rtree) {
+				rt.size++
+			},
+			"size",
+		},
+		{
+			"parent",
+			func(rt *Rtree) {
+				firstLeaf(rt).parent = rt.root
+			},
+			"parent",
+		},
+	}
+
+	for _, test := range tests {
+		rt := build()
+		test.corrupt(rt)
+		err := rt.Validate()
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: expected an error about %s, got %v", test.name, test.want, err)
+		}
+	}
+}